@@ -1,6 +1,7 @@
 package roaring
 
 import (
+	"context"
 	"fmt"
 	"math/bits"
 	"runtime"
@@ -148,88 +149,116 @@ func (b *BSI) GetValue(columnID uint64) (int64, bool) {
 
 type action func(t *task, batch []uint32, resultsChan chan *roaring.Bitmap, wg *sync.WaitGroup)
 
-func parallelExecutor(parallelism int, t *task, e action,
-	foundSet *roaring.Bitmap) *roaring.Bitmap {
+// cancellableBatchSize is the number of columns handled between two checks of
+// the context, when it can be cancelled.
+const cancellableBatchSize = 1 << 16
+
+// runBatches splits the columns of foundSet into parallelism tasks (as many as
+// the pool has workers if it is zero), which call run on them on the workers
+// of the pool, and collects the results. If ctx can be
+// cancelled, every task cuts its columns into batches of cancellableBatchSize
+// and stops calling run once ctx is done, in which case ctx.Err() is returned
+// after all of them have returned.
+func runBatches[T any](ctx context.Context, pool *roaring.Pool, parallelism int, foundSet *roaring.Bitmap,
+	run func(batch []uint32, resultsChan chan T, wg *sync.WaitGroup)) ([]T, error) {
 
 	var n int = parallelism
 	if n == 0 {
-		n = runtime.NumCPU()
+		n = pool.Workers()
 	}
 
-	resultsChan := make(chan *roaring.Bitmap, n)
-
 	card := foundSet.GetCardinality()
 	x := card / uint64(n)
 
 	remainder := card - (x * uint64(n))
-	var batch []uint32
+	batchSize := max(card, 1)
+	if ctx.Done() != nil {
+		batchSize = cancellableBatchSize
+	}
+	resultsChan := make(chan T, uint64(n)+card/batchSize)
+
 	var wg sync.WaitGroup
 	iter := foundSet.ManyIterator()
 	for i := 0; i < n; i++ {
+		size := x
 		if i == n-1 {
-			batch = make([]uint32, x+remainder)
-		} else {
-			batch = make([]uint32, x)
+			size += remainder
 		}
+		batch := make([]uint32, size)
 		iter.NextMany(batch)
 		wg.Add(1)
-		go e(t, batch, resultsChan, &wg)
+		pool.Go(func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				part := batch[:min(uint64(len(batch)), batchSize)]
+				batch = batch[len(part):]
+				var partWg sync.WaitGroup
+				partWg.Add(1)
+				run(part, resultsChan, &partWg)
+				if len(batch) == 0 {
+					return
+				}
+			}
+		})
 	}
 
 	wg.Wait()
 
 	close(resultsChan)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-	ba := make([]*roaring.Bitmap, 0)
-	for bm := range resultsChan {
-		ba = append(ba, bm)
+	results := make([]T, 0, len(resultsChan))
+	for r := range resultsChan {
+		results = append(results, r)
 	}
+	return results, nil
+}
+
+func parallelExecutor(parallelism int, t *task, e action,
+	foundSet *roaring.Bitmap) *roaring.Bitmap {
 
-	results := roaring.ParOr(0, ba...)
+	results, _ := parallelExecutorContext(context.Background(), roaring.DefaultPool(), parallelism, t, e, foundSet)
+	return results
+}
+
+func parallelExecutorContext(ctx context.Context, pool *roaring.Pool, parallelism int, t *task, e action,
+	foundSet *roaring.Bitmap) (*roaring.Bitmap, error) {
+
+	ba, err := runBatches(ctx, pool, parallelism, foundSet, func(batch []uint32, resultsChan chan *roaring.Bitmap, wg *sync.WaitGroup) {
+		e(t, batch, resultsChan, wg)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := pool.ParOr(ctx, 0, ba...)
+	if err != nil {
+		return nil, err
+	}
 	// Optimize the aggregate returned to the caller after it has been populated.
 	if t.bsi.runOptimized && !results.IsEmpty() {
 		results.RunOptimize()
 	}
-	return results
-
+	return results, nil
 }
 
 type bsiAction func(input *BSI, batch []uint32, resultsChan chan *BSI, wg *sync.WaitGroup)
 
 func parallelExecutorBSIResults(parallelism int, input *BSI, e bsiAction, foundSet *roaring.Bitmap, sumResults bool) *BSI {
+	results, _ := parallelExecutorBSIResultsContext(context.Background(), roaring.DefaultPool(), parallelism, input, e, foundSet, sumResults)
+	return results
+}
 
-	var n int = parallelism
-	if n == 0 {
-		n = runtime.NumCPU()
-	}
-
-	resultsChan := make(chan *BSI, n)
-
-	card := foundSet.GetCardinality()
-	x := card / uint64(n)
-
-	remainder := card - (x * uint64(n))
-	var batch []uint32
-	var wg sync.WaitGroup
-	iter := foundSet.ManyIterator()
-	for i := 0; i < n; i++ {
-		if i == n-1 {
-			batch = make([]uint32, x+remainder)
-		} else {
-			batch = make([]uint32, x)
-		}
-		iter.NextMany(batch)
-		wg.Add(1)
-		go e(input, batch, resultsChan, &wg)
-	}
-
-	wg.Wait()
-
-	close(resultsChan)
+func parallelExecutorBSIResultsContext(ctx context.Context, pool *roaring.Pool, parallelism int, input *BSI, e bsiAction,
+	foundSet *roaring.Bitmap, sumResults bool) (*BSI, error) {
 
-	ba := make([]*BSI, 0)
-	for bm := range resultsChan {
-		ba = append(ba, bm)
+	ba, err := runBatches(ctx, pool, parallelism, foundSet, func(batch []uint32, resultsChan chan *BSI, wg *sync.WaitGroup) {
+		e(input, batch, resultsChan, wg)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	results := NewDefaultBSI()
@@ -244,8 +273,7 @@ func parallelExecutorBSIResults(parallelism int, input *BSI, e bsiAction, foundS
 	if input.runOptimized && !results.eBM.IsEmpty() {
 		results.RunOptimize()
 	}
-	return results
-
+	return results, nil
 }
 
 // Operation identifier
@@ -295,6 +323,25 @@ func (b *BSI) CompareValue(parallelism int, op Operation, valueOrStart, end int6
 	return parallelExecutor(parallelism, comp, compareValue, foundSet)
 }
 
+// CompareValueContext is CompareValue stopping early when ctx is done, in
+// which case the workers return and ctx.Err() is reported.
+func (b *BSI) CompareValueContext(ctx context.Context, parallelism int, op Operation, valueOrStart, end int64,
+	foundSet *roaring.Bitmap) (*roaring.Bitmap, error) {
+
+	return b.CompareValueOnPool(ctx, roaring.DefaultPool(), parallelism, op, valueOrStart, end, foundSet)
+}
+
+// CompareValueOnPool is CompareValueContext running on the workers of pool.
+func (b *BSI) CompareValueOnPool(ctx context.Context, pool *roaring.Pool, parallelism int, op Operation, valueOrStart, end int64,
+	foundSet *roaring.Bitmap) (*roaring.Bitmap, error) {
+
+	comp := &task{bsi: b, op: op, valueOrStart: valueOrStart, end: end}
+	if foundSet == nil {
+		return parallelExecutorContext(ctx, pool, parallelism, comp, compareValue, b.eBM)
+	}
+	return parallelExecutorContext(ctx, pool, parallelism, comp, compareValue, foundSet)
+}
+
 func compareValue(e *task, batch []uint32, resultsChan chan *roaring.Bitmap, wg *sync.WaitGroup) {
 
 	defer wg.Done()
@@ -605,6 +652,24 @@ func (b *BSI) IntersectAndTranspose(parallelism int, foundSet *roaring.Bitmap) *
 	return parallelExecutor(parallelism, trans, transpose, foundSet)
 }
 
+// IntersectAndTransposeContext is IntersectAndTranspose stopping early when ctx
+// is done, in which case the workers return and ctx.Err() is reported.
+func (b *BSI) IntersectAndTransposeContext(ctx context.Context, parallelism int, foundSet *roaring.Bitmap) (*roaring.Bitmap, error) {
+	return b.IntersectAndTransposeOnPool(ctx, roaring.DefaultPool(), parallelism, foundSet)
+}
+
+// IntersectAndTransposeOnPool is IntersectAndTransposeContext running on the
+// workers of pool.
+func (b *BSI) IntersectAndTransposeOnPool(ctx context.Context, pool *roaring.Pool, parallelism int,
+	foundSet *roaring.Bitmap) (*roaring.Bitmap, error) {
+
+	if foundSet == nil {
+		foundSet = b.eBM
+	}
+	trans := &task{bsi: b}
+	return parallelExecutorContext(ctx, pool, parallelism, trans, transpose, foundSet)
+}
+
 func transpose(e *task, batch []uint32, resultsChan chan *roaring.Bitmap, wg *sync.WaitGroup) {
 
 	defer wg.Done()
@@ -1023,6 +1088,23 @@ func (b *BSI) TransposeWithCounts(parallelism int, foundSet *roaring.Bitmap) *BS
 	return parallelExecutorBSIResults(parallelism, b, transposeWithCounts, foundSet, true)
 }
 
+// TransposeWithCountsContext is TransposeWithCounts stopping early when ctx is
+// done, in which case the workers return and ctx.Err() is reported.
+func (b *BSI) TransposeWithCountsContext(ctx context.Context, parallelism int, foundSet *roaring.Bitmap) (*BSI, error) {
+	return b.TransposeWithCountsOnPool(ctx, roaring.DefaultPool(), parallelism, foundSet)
+}
+
+// TransposeWithCountsOnPool is TransposeWithCountsContext running on the
+// workers of pool.
+func (b *BSI) TransposeWithCountsOnPool(ctx context.Context, pool *roaring.Pool, parallelism int,
+	foundSet *roaring.Bitmap) (*BSI, error) {
+
+	if foundSet == nil {
+		foundSet = b.eBM
+	}
+	return parallelExecutorBSIResultsContext(ctx, pool, parallelism, b, transposeWithCounts, foundSet, true)
+}
+
 func transposeWithCounts(input *BSI, batch []uint32, resultsChan chan *BSI, wg *sync.WaitGroup) {
 
 	defer wg.Done()
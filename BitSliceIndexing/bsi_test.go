@@ -1,6 +1,7 @@
 package roaring
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"os"
@@ -378,6 +379,57 @@ func TestTransposeWithCounts(t *testing.T) {
 	assert.Equal(t, int64(2), a)
 }
 
+func TestParallelExecutorContext(t *testing.T) {
+	bsi := NewDefaultBSI()
+	for i := 0; i < 3*cancellableBatchSize+10; i++ {
+		bsi.SetValue(uint64(i), int64(i%100))
+	}
+
+	// a context that can be cancelled cuts the work into more batches
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	compared, err := bsi.CompareValueContext(ctx, 2, LT, 10, 0, nil)
+	require.NoError(t, err)
+	assert.True(t, compared.Equals(bsi.CompareValue(2, LT, 10, 0, nil)))
+	transposed, err := bsi.IntersectAndTransposeContext(ctx, 2, nil)
+	require.NoError(t, err)
+	assert.True(t, transposed.Equals(bsi.IntersectAndTranspose(2, nil)))
+	counts, err := bsi.TransposeWithCountsContext(ctx, 2, nil)
+	require.NoError(t, err)
+	a, ok := counts.GetValue(42)
+	assert.True(t, ok)
+	assert.Equal(t, int64(bsi.CompareValue(0, EQ, 42, 0, nil).GetCardinality()), a)
+
+	// the executors run on the pool they are given
+	pool := roaring.NewPool(2)
+	defer pool.Close()
+	compared, err = bsi.CompareValueOnPool(ctx, pool, 2, LT, 10, 0, nil)
+	require.NoError(t, err)
+	assert.True(t, compared.Equals(bsi.CompareValue(2, LT, 10, 0, nil)))
+	transposed, err = bsi.IntersectAndTransposeOnPool(ctx, pool, 2, nil)
+	require.NoError(t, err)
+	assert.True(t, transposed.Equals(bsi.IntersectAndTranspose(2, nil)))
+	counts, err = bsi.TransposeWithCountsOnPool(ctx, pool, 2, nil)
+	require.NoError(t, err)
+	a, ok = counts.GetValue(42)
+	assert.True(t, ok)
+	assert.Equal(t, int64(bsi.CompareValue(0, EQ, 42, 0, nil).GetCardinality()), a)
+	stats := pool.Stats()
+	assert.GreaterOrEqual(t, stats.Submitted, uint64(3*2))
+	assert.Equal(t, stats.Submitted, stats.Completed)
+
+	cancel()
+	compared, err = bsi.CompareValueContext(ctx, 2, LT, 10, 0, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, compared)
+	transposed, err = bsi.IntersectAndTransposeContext(ctx, 2, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, transposed)
+	counts, err = bsi.TransposeWithCountsContext(ctx, 2, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, counts)
+}
+
 func TestRunOptimizedBitmapQueryResults(t *testing.T) {
 	expected := roaring.NewBitmap()
 	expected.AddRange(0, runOptimizedQueryResultCardinality)
@@ -3,9 +3,12 @@ package roaring
 // to run just these tests: go test -run TestParAggregations
 
 import (
+	"context"
 	"fmt"
+	"runtime"
 	"slices"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -243,13 +246,75 @@ func TestParAggregations(t *testing.T) {
 		orFunc := func(bitmaps ...*Bitmap) *Bitmap {
 			return ParOr(p, bitmaps...)
 		}
+		xorFunc := func(bitmaps ...*Bitmap) *Bitmap {
+			return ParXor(p, bitmaps...)
+		}
 
 		t.Run(fmt.Sprintf("par%d", p), func(t *testing.T) {
-			testAggregations(t, andFunc, orFunc, nil)
+			testAggregations(t, andFunc, orFunc, xorFunc)
 		})
 	}
 }
 
+func TestParDifferences(t *testing.T) {
+	x := NewBitmap()
+	x.AddRange(0, 40<<16)
+	for k := uint32(40); k < 60; k++ {
+		x.Add(k<<16 + k)
+	}
+	x.RunOptimize()
+	bitmaps := make([]*Bitmap, 6)
+	for i := range bitmaps {
+		bitmaps[i] = NewBitmap()
+		for k := uint32(i); k < 80; k += 3 {
+			bitmaps[i].AddRange(uint64(k)<<16+uint64(i*1000), uint64(k)<<16+uint64(i*1000+7000))
+			bitmaps[i].Add(k<<16 + k)
+			for v := uint32(0); v < 1<<16; v += uint32(i + 2) {
+				bitmaps[i].Add(k<<16 + v)
+			}
+		}
+	}
+	bitmaps = append(bitmaps, NewBitmap())
+
+	or := FastOr(bitmaps...)
+	wantAndNot := AndNot(x, or)
+	wantAndAny := x.Clone()
+	wantAndAny.AndAny(bitmaps...)
+	wantXor := HeapXor(append([]*Bitmap{x}, bitmaps...)...)
+	for _, p := range []int{0, 1, 3} {
+		andNot := ParAndNot(p, x, bitmaps...)
+		assert.NoError(t, andNot.Validate())
+		assert.True(t, andNot.Equals(wantAndNot), "parallelism %d", p)
+		andAny := ParAndAny(p, x, bitmaps...)
+		assert.NoError(t, andAny.Validate())
+		assert.True(t, andAny.Equals(wantAndAny), "parallelism %d", p)
+		xor := ParXor(p, append([]*Bitmap{x}, bitmaps...)...)
+		assert.NoError(t, xor.Validate())
+		assert.True(t, xor.Equals(wantXor), "parallelism %d", p)
+	}
+
+	assert.True(t, ParAndNot(0, x).Equals(x))
+	assert.True(t, ParAndAny(0, x).Equals(x))
+	assert.True(t, ParAndNot(0, NewBitmap(), bitmaps...).IsEmpty())
+	assert.True(t, ParAndAny(0, NewBitmap(), bitmaps...).IsEmpty())
+	assert.True(t, ParAndNot(0, x, x).IsEmpty())
+	assert.True(t, ParAndAny(0, x, x).Equals(x))
+	assert.True(t, ParXor(0, x, x).IsEmpty())
+
+	// the inputs are left untouched
+	assert.True(t, FastOr(bitmaps...).Equals(or))
+	assert.True(t, ParAndNot(0, x, bitmaps...).Equals(wantAndNot))
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := DefaultPool().ParXor(cancelled, 0, x, bitmaps[0])
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = DefaultPool().ParAndNot(cancelled, 0, x, bitmaps...)
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = DefaultPool().ParAndAny(cancelled, 0, x, bitmaps...)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
 func TestParHeapAggregations(t *testing.T) {
 	orFunc := func(bitmaps ...*Bitmap) *Bitmap {
 		return ParHeapOr(0, bitmaps...)
@@ -258,6 +323,65 @@ func TestParHeapAggregations(t *testing.T) {
 	testAggregations(t, nil, orFunc, nil)
 }
 
+func TestParAggregationsContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	aggregations := map[string]func(ctx context.Context, parallelism int, bitmaps ...*Bitmap) (*Bitmap, error){
+		"and":     ParAndContext,
+		"or":      ParOrContext,
+		"heap or": ParHeapOrContext,
+	}
+	withContext := func(aggr func(ctx context.Context, parallelism int, bitmaps ...*Bitmap) (*Bitmap, error)) func(bitmaps ...*Bitmap) *Bitmap {
+		return func(bitmaps ...*Bitmap) *Bitmap {
+			bitmap, err := aggr(ctx, 2, bitmaps...)
+			assert.NoError(t, err)
+			return bitmap
+		}
+	}
+	testAggregations(t, withContext(ParAndContext), withContext(ParOrContext), nil)
+	t.Run("heap", func(t *testing.T) {
+		testAggregations(t, nil, withContext(ParHeapOrContext), nil)
+	})
+
+	bitmaps := make([]*Bitmap, 20)
+	for i := range bitmaps {
+		bitmaps[i] = NewBitmap()
+		for k := uint32(0); k < 200; k++ {
+			bitmaps[i].AddRange(uint64(k)<<16, uint64(k)<<16+uint64(1000*(i+1)))
+			bitmaps[i].Add(k<<16 + 60000 + uint32(i))
+		}
+	}
+	wantAnd, wantOr := FastAnd(bitmaps...), FastOr(bitmaps...)
+
+	for name, aggr := range aggregations {
+		t.Run(name, func(t *testing.T) {
+			cancelled, cancel := context.WithCancel(context.Background())
+			cancel()
+			bitmap, err := aggr(cancelled, 4, bitmaps...)
+			assert.ErrorIs(t, err, context.Canceled)
+			assert.Nil(t, bitmap)
+
+			// cancelled while running: either the complete result or the
+			// error, and no worker left behind
+			before := runtime.NumGoroutine()
+			running, cancel := context.WithCancel(context.Background())
+			time.AfterFunc(time.Millisecond, cancel)
+			bitmap, err = aggr(running, 4, bitmaps...)
+			if err != nil {
+				assert.ErrorIs(t, err, context.Canceled)
+			} else if name == "and" {
+				assert.True(t, bitmap.Equals(wantAnd))
+			} else {
+				assert.True(t, bitmap.Equals(wantOr))
+			}
+			for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > before && time.Now().Before(deadline); {
+				time.Sleep(time.Millisecond)
+			}
+			assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+		})
+	}
+}
+
 func TestFastAggregations(t *testing.T) {
 	testAggregations(t, FastAnd, FastOr, nil)
 }
@@ -300,3 +424,82 @@ func TestIssue330(t *testing.T) {
 	checkValidity(t, FastOr(bitmaps[0], bitmaps[1], bitmaps[2]))
 	checkValidity(t, FastOr(bitmaps[2], bitmaps[1], bitmaps[0]))
 }
+
+func TestCardinalityAggregations(t *testing.T) {
+	// array, bitmap, run and full containers, in various combinations
+	var bitmaps []*Bitmap
+	for i := 0; i < 6; i++ {
+		rb := NewBitmap()
+		for x := uint32(i); x < 1<<18; x += uint32(3 + i) {
+			rb.Add(x)
+		}
+		rb.AddRange(uint64(5<<16+i*1000), uint64(5<<16+50000+i*1000))
+		rb.AddRange(7<<16, 8<<16)
+		rb.Add(uint32(9<<16 + i))
+		if i%2 == 0 {
+			rb.RunOptimize()
+		}
+		bitmaps = append(bitmaps, rb)
+	}
+	bitmaps = append(bitmaps, BitmapOf(1, 5<<16+30000, 7<<16+3, 9<<16))
+
+	for n := 0; n <= len(bitmaps); n++ {
+		subset := bitmaps[:n]
+		or := FastOr(subset...).GetCardinality()
+		and := FastAnd(subset...).GetCardinality()
+		assert.Equal(t, or, FastOrCardinality(subset...), n)
+		assert.Equal(t, and, FastAndCardinality(subset...), n)
+		for _, p := range []int{0, 1, 3} {
+			assert.Equal(t, or, ParOrCardinality(p, subset...), n)
+			assert.Equal(t, and, ParAndCardinality(p, subset...), n)
+		}
+	}
+
+	withEmpty := append([]*Bitmap{NewBitmap()}, bitmaps...)
+	assert.Zero(t, FastAndCardinality(withEmpty...))
+	assert.Zero(t, ParAndCardinality(2, withEmpty...))
+	assert.Equal(t, FastOr(bitmaps...).GetCardinality(), ParOrCardinality(2, withEmpty...))
+}
+
+func TestThresholdOr(t *testing.T) {
+	var bitmaps []*Bitmap
+	for i := 0; i < 7; i++ {
+		rb := NewBitmap()
+		for x := uint32(i); x < 1<<18; x += uint32(2 + i) {
+			rb.Add(x)
+		}
+		rb.AddRange(uint64(5<<16+i*3000), uint64(5<<16+20000+i*3000))
+		rb.AddRange(7<<16, 8<<16)
+		rb.Add(uint32(9<<16 + i%3))
+		if i%2 == 0 {
+			rb.RunOptimize()
+		}
+		bitmaps = append(bitmaps, rb)
+	}
+	bitmaps = append(bitmaps, NewBitmap(), BitmapOf(1, 5<<16+30000, 9<<16+1, 11<<16))
+
+	counts := make(map[uint32]int)
+	for _, rb := range bitmaps {
+		rb.Iterate(func(x uint32) bool {
+			counts[x]++
+			return true
+		})
+	}
+
+	for k := 0; k <= len(bitmaps)+1; k++ {
+		expected := NewBitmap()
+		for x, count := range counts {
+			if count >= k {
+				expected.Add(x)
+			}
+		}
+
+		actual := ThresholdOr(k, bitmaps...)
+		assert.True(t, expected.Equals(actual), "k=%d", k)
+		checkValidity(t, actual)
+		for _, p := range []int{0, 1, 3} {
+			assert.True(t, expected.Equals(ParThresholdOr(p, k, bitmaps...)), "k=%d p=%d", k, p)
+		}
+	}
+	assert.True(t, ThresholdOr(2).IsEmpty())
+}
@@ -938,6 +938,53 @@ func (ac *arrayContainer) intersectsArray(value2 *arrayContainer) bool {
 		value2.content)
 }
 
+func (ac *arrayContainer) isSubset(a container) bool {
+	switch x := a.(type) {
+	case *arrayContainer:
+		return ac.isSubsetArray(x)
+	case *bitmapContainer:
+		for _, v := range ac.content {
+			if !x.contains(v) {
+				return false
+			}
+		}
+		return true
+	case *runContainer16:
+		return ac.isSubsetRun(x)
+	}
+	panic("unsupported container type")
+}
+
+func (ac *arrayContainer) isSubsetArray(value2 *arrayContainer) bool {
+	if len(ac.content) > len(value2.content) {
+		return false
+	}
+	pos := 0
+	for _, v := range ac.content {
+		for pos < len(value2.content) && value2.content[pos] < v {
+			pos++
+		}
+		if pos == len(value2.content) || value2.content[pos] != v {
+			return false
+		}
+		pos++
+	}
+	return true
+}
+
+func (ac *arrayContainer) isSubsetRun(rc *runContainer16) bool {
+	i := 0
+	for _, v := range ac.content {
+		for i < len(rc.iv) && rc.iv[i].last() < v {
+			i++
+		}
+		if i == len(rc.iv) || rc.iv[i].start > v {
+			return false
+		}
+	}
+	return true
+}
+
 func (ac *arrayContainer) iandArray(value2 *arrayContainer) container {
 	length := intersection2by2(
 		ac.content,
@@ -1061,8 +1108,8 @@ func (ac *arrayContainer) previousValue(target uint16) int {
 	return int(result.value)
 }
 
-// previousAbsentValue returns either the target if not found or the next larger missing value.
-// If the target is out of bounds a -1 is returned
+// previousAbsentValue returns either the target if not found or the next smaller missing value.
+// If the container is full from its start to target a -1 is returned
 // Ex: target=4 ac=[1,2,3,4,6,7] returns 0
 // Ex: target=5 ac=[1,2,3,4,6,7] returns 5
 // Ex: target=6 ac=[1,2,3,4,6,7] returns 5
@@ -1119,7 +1166,7 @@ func (ac *arrayContainer) previousAbsentValue(target uint16) int {
 }
 
 // nextAbsentValue returns either the target if not found or the next larger missing value.
-// If the target is out of bounds a -1 is returned
+// If the container is full from target to its end 1<<16 is returned
 // Ex: target=4 ac=[1,2,3,4,6,7] returns 5
 // Ex: target=5 ac=[1,2,3,4,6,7] returns 5
 // Ex: target=0 ac=[1,2,3,4,6,7] returns 0
@@ -1166,11 +1213,8 @@ func (ac *arrayContainer) nextAbsentValue(target uint16) int {
 		}
 	}
 
-	if low == cardinality-1 {
-		return int(ac.content[cardinality-1] + 1)
-	}
-
-	return int(ac.content[low] + 1)
+	// may return 1<<16 if the container is full from target to its end
+	return int(ac.content[low]) + 1
 }
 
 // nextValue returns either the target if found or the next larger value.
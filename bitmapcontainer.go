@@ -900,6 +900,47 @@ func (bc *bitmapContainer) intersectsBitmap(value2 *bitmapContainer) bool {
 	return false
 }
 
+func (bc *bitmapContainer) isSubset(a container) bool {
+	switch x := a.(type) {
+	case *arrayContainer:
+		if bc.cardinality > len(x.content) {
+			return false
+		}
+		return bc.iterate(x.contains)
+	case *bitmapContainer:
+		return bc.isSubsetBitmap(x)
+	case *runContainer16:
+		return bc.isSubsetRun(x)
+	}
+	panic("unsupported container type")
+}
+
+func (bc *bitmapContainer) isSubsetBitmap(value2 *bitmapContainer) bool {
+	if bc.cardinality > value2.cardinality {
+		return false
+	}
+	for k := 0; k < len(bc.bitmap); k++ {
+		if bc.bitmap[k]&^value2.bitmap[k] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// isSubsetRun checks that no value of bc falls in a gap between the runs.
+func (bc *bitmapContainer) isSubsetRun(rc *runContainer16) bool {
+	start := 0 // start of the current gap
+	for _, iv := range rc.iv {
+		if start < int(iv.start) {
+			if v := bc.NextSetBit(uint(start)); v >= 0 && v < int(iv.start) {
+				return false
+			}
+		}
+		start = int(iv.last()) + 1
+	}
+	return start == 1<<16 || bc.NextSetBit(uint(start)) < 0
+}
+
 func (bc *bitmapContainer) iandBitmap(value2 *bitmapContainer) container {
 	newcardinality := int(popcntAndSlice(bc.bitmap, value2.bitmap))
 	for k := 0; k < len(bc.bitmap); k++ {
@@ -1381,53 +1422,22 @@ func (bc *bitmapContainer) nextValue(target uint16) int {
 	return bc.NextSetBit(uint(target))
 }
 
-// nextAbsentValue returns the next absent value.
-// if the target is out of bounds a -1 is returned
+// nextAbsentValue returns the smallest absent value greater than or equal
+// to target, or 1<<16 if the container is full from target to its end.
 func (bc *bitmapContainer) nextAbsentValue(target uint16) int {
-	if bc.cardinality == 0 {
-		return -1
-	}
-
-	var (
-		x      = target >> 6
-		length = uint(len(bc.bitmap))
-	)
-	if uint(x) >= length {
-		return -1
-	}
-	w := bc.bitmap[x]
-	w = w >> uint(target%64)
-	if w == 0 {
+	x := int(target >> 6)
+	if x >= len(bc.bitmap) {
 		return int(target)
 	}
-
-	// Check if all 1's
-	// if statement - we skip the if we have all ones [1,1,1,1...1]
-	if ^w != 0 {
-
-		if bits.TrailingZeros64(w) > 0 {
-			// we have something like [X,Y,Z, 0,0,0]. This means the target bit is zero
-			return int(target)
-		}
-
-		// other wise something like [X,Y,0,1,1,1..1], where x and y can be either 1 or 0.
-
-		trailing := bits.TrailingZeros64(^w)
-		return int(target) + trailing
-
+	if w := ^bc.bitmap[x] >> (target % 64); w != 0 {
+		return int(target) + bits.TrailingZeros64(w)
 	}
-	x++
-	for ; uint(x) < length; x++ {
-		if bc.bitmap[x] == 0 {
-			return int(x * 64)
-		}
-		if ^bc.bitmap[x] != 0 {
-			trailing := bits.TrailingZeros64(^bc.bitmap[x])
-			return int(x*64) + trailing
+	for x++; x < len(bc.bitmap); x++ {
+		if w := ^bc.bitmap[x]; w != 0 {
+			return x*64 + bits.TrailingZeros64(w)
 		}
-
 	}
-	return -1
+	return 1 << 16
 }
 
 // previousValue returns either the `target` if found or the previous largest value.
@@ -1449,63 +1459,20 @@ func (bc *bitmapContainer) previousValue(target uint16) int {
 	return bc.uPrevSetBit(uint(target))
 }
 
-// previousAbsentValue returns the next absent value.
+// previousAbsentValue returns the largest absent value smaller than or equal
+// to target, or -1 if the container is full from its start to target.
 func (bc *bitmapContainer) previousAbsentValue(target uint16) int {
-	if bc.cardinality == 0 {
-		return -1
-	}
-
-	var (
-		x      = target >> 6
-		length = uint(len(bc.bitmap))
-	)
-	if uint(x) >= length {
-		return -1
-	}
-	w := bc.bitmap[x]
-	shifted := w >> uint(target%64)
-	if shifted == 0 {
+	x := int(target >> 6)
+	if x >= len(bc.bitmap) {
 		return int(target)
 	}
-
-	// Check if all 1's
-	// if statement - we skip if we have all ones [1,1,1,1...1] as no value is absent
-	if ^shifted != 0 {
-
-		if bits.TrailingZeros64(shifted) > 0 {
-			// we have something like shifted=[X,Y,Z,..., 0,0,0]. This means the target bit is zero
-			return int(target)
-		}
-
-		// The rotate will rotate the target bit into the leading position.
-		// We know the target bit is not zero because of the TrailingZeros64 check above
-		// We then shift the target bit out of the way.
-		// Assume a structure like an original structure like [X,Y,Z,..., Target, A, B,C...]
-		// shifted will be [X,Y,Z...Target]
-		// shiftedRotated will be [A,B,C....]
-		// If LeadingZeros64 > 0 then A is zero, if not at least A is 1 return
-		// Else count the number of ones's until a 0
-		shiftedRotated := bits.RotateLeft64(w, int(64-uint(target%64))-1) << 1
-		leadingZeros := bits.LeadingZeros64(shiftedRotated)
-		if leadingZeros > 0 {
-			return int(target) - 1
-		}
-		leadingOnes := bits.LeadingZeros64(^shiftedRotated)
-		if leadingOnes > 0 {
-			return int(target) - leadingOnes - 1
-		}
-
+	if w := ^bc.bitmap[x] << (63 - target%64); w != 0 {
+		return int(target) - bits.LeadingZeros64(w)
 	}
-	x++
-	for ; uint(x) < length; x++ {
-		if bc.bitmap[x] == 0 {
-			return int(x * 64)
+	for x--; x >= 0; x-- {
+		if w := ^bc.bitmap[x]; w != 0 {
+			return x*64 + 63 - bits.LeadingZeros64(w)
 		}
-		if ^bc.bitmap[x] != 0 {
-			trailing := bits.TrailingZeros64(^bc.bitmap[x])
-			return int(x*64) + trailing
-		}
-
 	}
 	return -1
 }
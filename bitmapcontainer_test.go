@@ -412,6 +412,31 @@ func TestNextAbsent(t *testing.T) {
 	assert.Equal(t, v, 65536)
 }
 
+func TestAbsentValueAcrossWords(t *testing.T) {
+	bc := newBitmapContainer()
+	bc.iaddRange(0, 10)
+	bc.iaddRange(60, 200)
+	bc.iaddRange(1<<16-100, 1<<16)
+	ac := bc.toArrayContainer()
+	rc := newRunContainer16FromBitmapContainer(bc)
+	for i := 0; i < 1<<16; i++ {
+		next := i
+		for next < 1<<16 && bc.contains(uint16(next)) {
+			next++
+		}
+		prev := i
+		for prev >= 0 && bc.contains(uint16(prev)) {
+			prev--
+		}
+		assert.Equal(t, next, bc.nextAbsentValue(uint16(i)), i)
+		assert.Equal(t, prev, bc.previousAbsentValue(uint16(i)), i)
+		assert.Equal(t, next, ac.nextAbsentValue(uint16(i)), i)
+		assert.Equal(t, prev, ac.previousAbsentValue(uint16(i)), i)
+		assert.Equal(t, next, rc.nextAbsentValue(uint16(i)), i)
+		assert.Equal(t, prev, rc.previousAbsentValue(uint16(i)), i)
+	}
+}
+
 func TestBitMapContainerValidate(t *testing.T) {
 	bc := newBitmapContainer()
 
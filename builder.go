@@ -0,0 +1,167 @@
+package roaring
+
+// Builder constructs a bitmap from values added in ascending order, as when
+// ingesting sorted identifiers. Rather than searching for a container and
+// checking its type on every insertion, as Add does, the builder fills a
+// buffer for the current key and only turns it into a container, of the best
+// type, when a value with a larger key arrives or when Build is called.
+//
+// Values need only be mostly ascending: within the current key they may come
+// in any order, and a value whose key precedes the current key is added to the
+// bitmap under construction with Add, at the usual cost.
+//
+// A Builder is not safe for concurrent use.
+type Builder struct {
+	answer      *Bitmap
+	runOptimize bool
+	unordered   bool // whether values were added to answer directly
+
+	key    uint16
+	values []uint16 // values of the current key, while they are ascending and few
+	words  []uint64 // values of the current key as a bitmap, once values is abandoned
+	dense  bool     // whether the current key is held in words
+}
+
+// NewBuilder returns an empty builder. If runOptimize is true, every container
+// is also considered for run compression when it is flushed, as RunOptimize
+// would do; values added out of order are run-optimized by Build.
+func NewBuilder(runOptimize bool) *Builder {
+	return &Builder{
+		answer:      NewBitmap(),
+		runOptimize: runOptimize,
+		values:      make([]uint16, 0, arrayDefaultMaxSize),
+	}
+}
+
+// Add adds the integer x to the bitmap under construction.
+func (b *Builder) Add(x uint32) {
+	hb := highbits(x)
+	if hb != b.key {
+		if hb < b.key {
+			b.answer.Add(x)
+			b.unordered = true
+			return
+		}
+		b.flush()
+		b.key = hb
+	}
+
+	lb := lowbits(x)
+	if !b.dense {
+		n := len(b.values)
+		if n == 0 || lb > b.values[n-1] {
+			if n < arrayDefaultMaxSize {
+				b.values = append(b.values, lb)
+				return
+			}
+		} else if lb == b.values[n-1] {
+			return
+		}
+		b.toDense()
+	}
+	b.words[lb>>6] |= 1 << (lb % 64)
+}
+
+// AddMany adds all of the values in dat to the bitmap under construction.
+func (b *Builder) AddMany(dat []uint32) {
+	for _, x := range dat {
+		b.Add(x)
+	}
+}
+
+// AddRange adds the integers in [rangeStart, rangeEnd) to the bitmap under
+// construction.
+func (b *Builder) AddRange(rangeStart, rangeEnd uint64) {
+	if rangeStart >= rangeEnd {
+		return
+	}
+	if rangeEnd-1 > MaxUint32 {
+		panic("rangeEnd-1 > MaxUint32")
+	}
+
+	hbStart := uint32(highbits(uint32(rangeStart)))
+	lbStart := uint32(lowbits(uint32(rangeStart)))
+	hbLast := uint32(highbits(uint32(rangeEnd - 1)))
+	lbLast := uint32(lowbits(uint32(rangeEnd - 1)))
+
+	for hb := hbStart; hb <= hbLast; hb++ {
+		containerStart := uint32(0)
+		if hb == hbStart {
+			containerStart = lbStart
+		}
+		containerLast := uint32(MaxUint16)
+		if hb == hbLast {
+			containerLast = lbLast
+		}
+
+		if uint16(hb) < b.key {
+			b.answer.AddRange(uint64(hb)<<16|uint64(containerStart), uint64(hb)<<16|uint64(containerLast)+1)
+			b.unordered = true
+			continue
+		}
+		if uint16(hb) != b.key {
+			b.flush()
+			b.key = uint16(hb)
+		}
+		if !b.dense {
+			b.toDense()
+		}
+		setBitmapRange(b.words, int(containerStart), int(containerLast)+1)
+	}
+}
+
+// Build returns the bitmap holding all the values added so far and resets the
+// builder, which can then be used to construct another bitmap.
+func (b *Builder) Build() *Bitmap {
+	b.flush()
+	answer := b.answer
+	if b.runOptimize && b.unordered {
+		answer.RunOptimize()
+	}
+	b.answer = NewBitmap()
+	b.key = 0
+	b.unordered = false
+	return answer
+}
+
+// toDense moves the values of the current key to words.
+func (b *Builder) toDense() {
+	if b.words == nil {
+		b.words = make([]uint64, bitmapContainerSize)
+	}
+	for _, v := range b.values {
+		b.words[v>>6] |= 1 << (v % 64)
+	}
+	b.values = b.values[:0]
+	b.dense = true
+}
+
+// flush appends the values of the current key to the bitmap under
+// construction and empties the buffers.
+func (b *Builder) flush() {
+	var c container
+	if b.dense {
+		bc := newBitmapContainer()
+		copy(bc.bitmap, b.words)
+		bc.computeCardinality()
+		fill(b.words, 0)
+		b.dense = false
+		if bc.isEmpty() {
+			return
+		}
+		c = repairAfterLazy(bc)
+	} else {
+		if len(b.values) == 0 {
+			return
+		}
+		ac := newArrayContainerSize(len(b.values))
+		copy(ac.content, b.values)
+		b.values = b.values[:0]
+		c = ac
+	}
+
+	if b.runOptimize {
+		c = c.toEfficientContainer()
+	}
+	b.answer.highlowcontainer.appendContainer(b.key, c, false)
+}
@@ -0,0 +1,90 @@
+package roaring
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuilder(t *testing.T) {
+	var values []uint32
+	for i := uint32(0); i < 100; i++ {
+		values = append(values, i*7)
+	}
+	for i := uint32(0); i < 5000; i++ { // more than an array container holds
+		values = append(values, 1<<16+i*3)
+	}
+	for i := uint32(0); i < 1<<16; i++ { // a full container
+		values = append(values, 2<<16+i)
+	}
+	values = append(values, 9<<16, 9<<16, 1000<<16+5, MaxUint32)
+
+	for _, runOptimize := range []bool{false, true} {
+		expected := BitmapOf(values...)
+		if runOptimize {
+			expected.RunOptimize()
+		}
+
+		b := NewBuilder(runOptimize)
+		b.AddMany(values)
+		rb := b.Build()
+		require.NoError(t, rb.Validate())
+		assert.True(t, expected.Equals(rb))
+		assert.Equal(t, expected.HasRunCompression(), rb.HasRunCompression())
+
+		// the builder is reset by Build
+		b.Add(42)
+		assert.Equal(t, []uint32{42}, b.Build().ToArray())
+		assert.True(t, b.Build().IsEmpty())
+	}
+}
+
+func TestBuilderMostlyAscending(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	expected := NewBitmap()
+	b := NewBuilder(false)
+	for i := 0; i < 100000; i++ {
+		x := uint32(i) * 13
+		if r.Intn(10) == 0 {
+			x -= uint32(r.Intn(1 << 18)) // may fall in a flushed key
+		}
+		if r.Intn(10) == 0 {
+			x += uint32(r.Intn(100))
+		}
+		expected.Add(x)
+		b.Add(x)
+	}
+	rb := b.Build()
+	require.NoError(t, rb.Validate())
+	assert.True(t, expected.Equals(rb))
+}
+
+func TestBuilderAddRange(t *testing.T) {
+	expected := NewBitmap()
+	b := NewBuilder(true)
+	add := func(x uint32) {
+		expected.Add(x)
+		b.Add(x)
+	}
+	addRange := func(start, end uint64) {
+		expected.AddRange(start, end)
+		b.AddRange(start, end)
+	}
+
+	add(3)
+	addRange(10, 20)
+	addRange(1<<16-5, 4<<16+5)
+	add(4<<16 + 2)
+	add(4<<16 + 100)
+	addRange(1, 2) // precedes the current key
+	addRange(7, 7)
+	addRange(10<<16, 1<<32)
+	expected.RunOptimize()
+
+	rb := b.Build()
+	require.NoError(t, rb.Validate())
+	assert.True(t, expected.Equals(rb))
+	assert.Panics(t, func() { b.AddRange(0, 1<<32+1) })
+}
@@ -0,0 +1,203 @@
+package roaring
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/RoaringBitmap/roaring/v2/internal"
+)
+
+/* CHECKSUMMED FORMAT DESCRIPTION
+ *
+ * <header>    uint32_t checksumCookie,
+ *             uint32_t payload format (checksummedPortable or checksummedFrozen),
+ *             uint64_t payload length in bytes,
+ *             uint64_t number of containers,
+ *             uint32_t zero,
+ *             uint32_t CRC32C of the first 28 bytes of <header> followed by <checksums>
+ * <payload>   the bitmap in the portable format (WriteTo) or in the frozen
+ *             format (Freeze). The header is 32 bytes long, so a frozen
+ *             payload is aligned as long as the envelope is.
+ * <checksums> for every container, in increasing key order:
+ *             uint16_t key, uint32_t CRC32C of the container (see ContainerChecksums)
+ *
+ * All integers are little endian. Checksums are computed on the containers
+ * rather than on the payload bytes, so that corruption is reported for the
+ * container it affects.
+ */
+const (
+	checksumCookie     = 0x4b434252 // "RBCK" in little endian
+	checksumHeaderSize = internal.ChecksumHeaderSize
+	checksumEntrySize  = 6
+
+	checksummedPortable = internal.ChecksummedPortable
+	checksummedFrozen   = internal.ChecksummedFrozen
+)
+
+var checksumEnvelope = internal.ChecksumEnvelope{
+	Cookie:     checksumCookie,
+	EntrySize:  checksumEntrySize,
+	MaxEntries: 1 << 16,
+}
+
+var (
+	// ErrChecksumInvalidCookie is returned when the input is not a checksummed bitmap.
+	ErrChecksumInvalidCookie = internal.ErrChecksumInvalidCookie
+	// ErrChecksumCorrupted is returned, possibly wrapped in a CorruptionError,
+	// when a checksummed bitmap does not match its checksums.
+	ErrChecksumCorrupted = internal.ErrChecksumCorrupted
+)
+
+// CorruptionError reports that the container holding the values whose
+// high 16 bits are Key does not match its checksum. A container that is
+// missing, or that should not be there, has a checksum of zero.
+//
+// CorruptionError wraps ErrChecksumCorrupted.
+type CorruptionError struct {
+	Key      uint16
+	Expected uint32 // checksum stored when the bitmap was written
+	Actual   uint32 // checksum of the container that was read
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("corrupted container with key %d: checksum is %08x, expected %08x", e.Key, e.Actual, e.Expected)
+}
+
+func (e *CorruptionError) Unwrap() error {
+	return ErrChecksumCorrupted
+}
+
+// ContainerChecksum is the CRC32C checksum of the container holding the
+// values of a bitmap whose high 16 bits are Key.
+type ContainerChecksum struct {
+	Key      uint16
+	Checksum uint32
+}
+
+// ContainerChecksums appends the checksum of every container of the bitmap
+// to dst, in increasing key order, and returns the extended slice.
+// The checksum covers the type and the content of the container.
+func (rb *Bitmap) ContainerChecksums(dst []ContainerChecksum) []ContainerChecksum {
+	ra := &rb.highlowcontainer
+	for i, c := range ra.containers {
+		dst = append(dst, ContainerChecksum{Key: ra.keys[i], Checksum: containerChecksum(c)})
+	}
+	return dst
+}
+
+func containerChecksum(c container) uint32 {
+	crc := crc32.Update(0, internal.CRC32C, []byte{byte(c.containerType())})
+	switch c := c.(type) {
+	case *arrayContainer:
+		return crc32.Update(crc, internal.CRC32C, uint16SliceAsByteSlice(c.content))
+	case *bitmapContainer:
+		return crc32.Update(crc, internal.CRC32C, uint64SliceAsByteSlice(c.bitmap))
+	case *runContainer16:
+		return crc32.Update(crc, internal.CRC32C, interval16SliceAsByteSlice(c.iv))
+	default:
+		panic("invalid container type")
+	}
+}
+
+// appendChecksumTable appends the <checksums> section for sums to dst.
+func appendChecksumTable(dst []byte, sums []ContainerChecksum) []byte {
+	for _, s := range sums {
+		dst = binary.LittleEndian.AppendUint16(dst, s.Key)
+		dst = binary.LittleEndian.AppendUint32(dst, s.Checksum)
+	}
+	return dst
+}
+
+// verifyContainerChecksums compares the containers of rb with the
+// <checksums> section, and returns a CorruptionError for the first one
+// that does not match.
+func (rb *Bitmap) verifyContainerChecksums(table []byte) error {
+	actual := rb.ContainerChecksums(nil)
+	key, expected, got, found := internal.FirstChecksumMismatch(
+		len(actual), func(i int) (uint16, uint32) {
+			return actual[i].Key, actual[i].Checksum
+		},
+		len(table)/checksumEntrySize, func(j int) (uint16, uint32) {
+			entry := table[checksumEntrySize*j:]
+			return binary.LittleEndian.Uint16(entry), binary.LittleEndian.Uint32(entry[2:])
+		})
+	if !found {
+		return nil
+	}
+	return &CorruptionError{Key: key, Expected: expected, Actual: got}
+}
+
+// WriteChecksummedTo writes the bitmap in the portable format (see WriteTo),
+// wrapped in an envelope holding the CRC32C checksum of every container.
+// Such a bitmap is read back with ReadChecksummedFrom, which detects
+// corrupted containers.
+func (rb *Bitmap) WriteChecksummedTo(stream io.Writer) (int64, error) {
+	payload, err := rb.ToBytes()
+	if err != nil {
+		return 0, err
+	}
+	// checksum the containers exactly as they will be read back
+	view := NewBitmap()
+	if _, err := view.FromBuffer(payload); err != nil {
+		return 0, err
+	}
+	table := appendChecksumTable(nil, view.ContainerChecksums(nil))
+
+	var header [checksumHeaderSize]byte
+	checksumEnvelope.PutHeader(header[:], checksummedPortable, uint64(len(payload)), table)
+
+	var written int64
+	for _, b := range [][]byte{header[:], payload, table} {
+		n, err := stream.Write(b)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// ReadChecksummedFrom reads a bitmap written by WriteChecksummedTo, and
+// checks every container against its checksum. If a container does not
+// match, it returns a *CorruptionError naming its key; every corruption
+// error wraps ErrChecksumCorrupted. The bitmap is empty after an error.
+func (rb *Bitmap) ReadChecksummedFrom(stream io.Reader) (p int64, err error) {
+	defer func() {
+		if err != nil {
+			rb.Clear()
+		}
+	}()
+
+	var header [checksumHeaderSize]byte
+	n, err := io.ReadFull(stream, header[:])
+	p = int64(n)
+	if err != nil {
+		return p, err
+	}
+	payloadLen, tableLen, err := checksumEnvelope.ParseHeader(header[:], checksummedPortable)
+	if err != nil {
+		return p, err
+	}
+
+	m, err := rb.ReadFrom(io.LimitReader(stream, int64(payloadLen)))
+	p += m
+	if err != nil {
+		return p, fmt.Errorf("%w: %w", ErrChecksumCorrupted, err)
+	}
+	if uint64(m) != payloadLen {
+		return p, fmt.Errorf("%w: unexpected payload length", ErrChecksumCorrupted)
+	}
+
+	table := make([]byte, tableLen)
+	n, err = io.ReadFull(stream, table)
+	p += int64(n)
+	if err != nil {
+		return p, err
+	}
+	if err := internal.CheckChecksumTable(header[:], table); err != nil {
+		return p, err
+	}
+	return p, rb.verifyContainerChecksums(table)
+}
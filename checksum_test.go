@@ -0,0 +1,108 @@
+package roaring
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checksumTestBitmap has an array container with key 1, a bitmap
+// container with key 7 and a run container with key 9.
+func checksumTestBitmap() *Bitmap {
+	rb := BitmapOf(1<<16|3, 1<<16|500, 1<<16|4000)
+	for i := uint32(0); i < 1<<16; i += 3 {
+		rb.Add(7<<16 | i)
+	}
+	rb.AddRange(9<<16+100, 9<<16+20000)
+	rb.RunOptimize()
+	return rb
+}
+
+func TestChecksummedRoundTrip(t *testing.T) {
+	for _, rb := range []*Bitmap{NewBitmap(), BitmapOf(1), checksumTestBitmap()} {
+		var buf bytes.Buffer
+		n, err := rb.WriteChecksummedTo(&buf)
+		require.NoError(t, err)
+		assert.EqualValues(t, buf.Len(), n)
+
+		// trailing data is left in the stream
+		buf.WriteString("tail")
+		got := BitmapOf(123)
+		p, err := got.ReadChecksummedFrom(&buf)
+		require.NoError(t, err)
+		assert.Equal(t, n, p)
+		assert.True(t, rb.Equals(got))
+		assert.Equal(t, "tail", buf.String())
+	}
+}
+
+func TestChecksummedCorruptedContainer(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := checksumTestBitmap().WriteChecksummedTo(&buf)
+	require.NoError(t, err)
+	data := buf.Bytes()
+
+	// the payload ends with the run container; flip the last byte of its
+	// last run length
+	payloadEnd := len(data) - 3*checksumEntrySize
+	data[payloadEnd-2] ^= 0x01
+
+	rb := NewBitmap()
+	_, err = rb.ReadChecksummedFrom(bytes.NewReader(data))
+	var corruption *CorruptionError
+	require.True(t, errors.As(err, &corruption), err)
+	assert.EqualValues(t, 9, corruption.Key)
+	assert.NotEqual(t, corruption.Expected, corruption.Actual)
+	assert.ErrorIs(t, err, ErrChecksumCorrupted)
+	assert.True(t, rb.IsEmpty())
+}
+
+func TestChecksummedErrors(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := checksumTestBitmap().WriteChecksummedTo(&buf)
+	require.NoError(t, err)
+	data := buf.Bytes()
+
+	corrupt := func(i int) []byte {
+		c := append([]byte(nil), data...)
+		c[i] ^= 0x10
+		return c
+	}
+
+	rb := NewBitmap()
+	_, err = rb.ReadChecksummedFrom(bytes.NewReader(corrupt(0)))
+	assert.ErrorIs(t, err, ErrChecksumInvalidCookie)
+	// corrupted table
+	_, err = rb.ReadChecksummedFrom(bytes.NewReader(corrupt(len(data) - 1)))
+	assert.ErrorIs(t, err, ErrChecksumCorrupted)
+	// corrupted payload length
+	_, err = rb.ReadChecksummedFrom(bytes.NewReader(corrupt(8)))
+	assert.ErrorIs(t, err, ErrChecksumCorrupted)
+	// truncated
+	_, err = rb.ReadChecksummedFrom(bytes.NewReader(data[:len(data)-1]))
+	assert.Error(t, err)
+	_, err = rb.ReadChecksummedFrom(bytes.NewReader(data[:10]))
+	assert.Error(t, err)
+	// not a checksummed bitmap
+	plain, err := checksumTestBitmap().ToBytes()
+	require.NoError(t, err)
+	_, err = rb.ReadChecksummedFrom(bytes.NewReader(append(plain, make([]byte, 32)...)))
+	assert.ErrorIs(t, err, ErrChecksumInvalidCookie)
+}
+
+func TestContainerChecksums(t *testing.T) {
+	rb := checksumTestBitmap()
+	sums := rb.ContainerChecksums(nil)
+	require.Len(t, sums, 3)
+	assert.Equal(t, []uint16{1, 7, 9}, []uint16{sums[0].Key, sums[1].Key, sums[2].Key})
+
+	other := rb.Clone()
+	other.Add(7<<16 | 1)
+	otherSums := other.ContainerChecksums(nil)
+	assert.Equal(t, sums[0], otherSums[0])
+	assert.NotEqual(t, sums[1], otherSums[1])
+	assert.Equal(t, sums[2], otherSums[2])
+}
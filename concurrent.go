@@ -0,0 +1,190 @@
+package roaring
+
+import (
+	"io"
+
+	"github.com/RoaringBitmap/roaring/v2/internal"
+)
+
+// ConcurrentBitmap is a bitmap that is safe for concurrent use. Its
+// containers are spread over shards by key, each shard guarded by its own
+// lock, so that Add, Remove and Contains only lock the shard of their value
+// and writers touching different containers do not wait for each other.
+// Operations involving the whole bitmap (set operations, cardinality,
+// snapshots) lock all the shards, so that they see or make a consistent
+// state.
+//
+// The zero value is an empty bitmap ready to use. A ConcurrentBitmap must not
+// be copied after first use.
+type ConcurrentBitmap struct {
+	shards internal.Shards[Bitmap] // each with the containers whose key maps to it
+}
+
+// NewConcurrentBitmap creates a new empty ConcurrentBitmap.
+func NewConcurrentBitmap() *ConcurrentBitmap {
+	return &ConcurrentBitmap{}
+}
+
+// NewConcurrentBitmapFrom creates a ConcurrentBitmap holding a copy of the
+// values of rb.
+func NewConcurrentBitmapFrom(rb *Bitmap) *ConcurrentBitmap {
+	cb := NewConcurrentBitmap()
+	cb.Or(rb)
+	return cb
+}
+
+// Add the integer x to the bitmap
+func (cb *ConcurrentBitmap) Add(x uint32) {
+	hb := uint32(highbits(x))
+	cb.shards.Lock(hb).Add(x)
+	cb.shards.Unlock(hb)
+}
+
+// CheckedAdd adds the integer x to the bitmap and return true if it was added (false if the integer was already present)
+func (cb *ConcurrentBitmap) CheckedAdd(x uint32) bool {
+	hb := uint32(highbits(x))
+	b := cb.shards.Lock(hb)
+	defer cb.shards.Unlock(hb)
+	return b.CheckedAdd(x)
+}
+
+// AddMany add all of the values in dat. The values sharing a container are
+// added under a single lock of their shard when they are next to each other,
+// as they are in sorted input.
+func (cb *ConcurrentBitmap) AddMany(dat []uint32) {
+	for i := 0; i < len(dat); {
+		hb := highbits(dat[i])
+		j := i + 1
+		for j < len(dat) && highbits(dat[j]) == hb {
+			j++
+		}
+		cb.shards.Lock(uint32(hb)).AddMany(dat[i:j])
+		cb.shards.Unlock(uint32(hb))
+		i = j
+	}
+}
+
+// Remove the integer x from the bitmap
+func (cb *ConcurrentBitmap) Remove(x uint32) {
+	hb := uint32(highbits(x))
+	cb.shards.Lock(hb).Remove(x)
+	cb.shards.Unlock(hb)
+}
+
+// CheckedRemove removes the integer x from the bitmap and return true if the integer was effectively removed (and false if the integer was not present)
+func (cb *ConcurrentBitmap) CheckedRemove(x uint32) bool {
+	hb := uint32(highbits(x))
+	b := cb.shards.Lock(hb)
+	defer cb.shards.Unlock(hb)
+	return b.CheckedRemove(x)
+}
+
+// Contains returns true if the integer is contained in the bitmap
+func (cb *ConcurrentBitmap) Contains(x uint32) bool {
+	hb := uint32(highbits(x))
+	b := cb.shards.RLock(hb)
+	defer cb.shards.RUnlock(hb)
+	return b.Contains(x)
+}
+
+// GetCardinality returns the number of integers contained in the bitmap
+func (cb *ConcurrentBitmap) GetCardinality() uint64 {
+	cb.shards.RLockAll()
+	defer cb.shards.RUnlockAll()
+	size := uint64(0)
+	for i := range internal.ShardCount {
+		size += cb.shards.At(i).GetCardinality()
+	}
+	return size
+}
+
+// IsEmpty returns true if the bitmap is empty
+func (cb *ConcurrentBitmap) IsEmpty() bool {
+	cb.shards.RLockAll()
+	defer cb.shards.RUnlockAll()
+	for i := range internal.ShardCount {
+		if !cb.shards.At(i).IsEmpty() {
+			return false
+		}
+	}
+	return true
+}
+
+// Clear resets the bitmap to be logically empty
+func (cb *ConcurrentBitmap) Clear() {
+	cb.shards.LockAll()
+	defer cb.shards.UnlockAll()
+	for i := range internal.ShardCount {
+		cb.shards.At(i).Clear()
+	}
+}
+
+// Snapshot returns a copy of the bitmap as a Bitmap, taken while no writer
+// holds any shard, so that it reflects a state the bitmap was in. Set
+// operations with other bitmaps and serialization can then work on the copy
+// without blocking the writers.
+func (cb *ConcurrentBitmap) Snapshot() *Bitmap {
+	cb.shards.RLockAll()
+	defer cb.shards.RUnlockAll()
+	bitmaps := make([]*Bitmap, internal.ShardCount)
+	for i := range bitmaps {
+		bitmaps[i] = cb.shards.At(i)
+	}
+	// the shards hold distinct keys: every key comes with a single container
+	h := newBitmapContainerHeap(bitmaps...)
+	answer := NewBitmap()
+	for h.Len() > 0 {
+		ck := h.Next(make([]container, 0, 1))
+		answer.highlowcontainer.appendContainer(ck.key, ck.containers[0].clone(), false)
+	}
+	return answer
+}
+
+// WriteTo writes a snapshot of the bitmap to a stream, see Bitmap.WriteTo
+// and Snapshot.
+func (cb *ConcurrentBitmap) WriteTo(stream io.Writer) (int64, error) {
+	return cb.Snapshot().WriteTo(stream)
+}
+
+// Or computes the union between the bitmap and x2, and stores the result in
+// the bitmap, as a single step that concurrent readers see entirely or not at
+// all.
+func (cb *ConcurrentBitmap) Or(x2 *Bitmap) {
+	parts := shardParts(x2)
+	cb.shards.LockAll()
+	defer cb.shards.UnlockAll()
+	for i, part := range parts {
+		cb.shards.At(i).Or(part)
+	}
+}
+
+// And computes the intersection between the bitmap and x2, and stores the
+// result in the bitmap, as a single step, see Or.
+func (cb *ConcurrentBitmap) And(x2 *Bitmap) {
+	parts := shardParts(x2)
+	cb.shards.LockAll()
+	defer cb.shards.UnlockAll()
+	for i, part := range parts {
+		cb.shards.At(i).And(part)
+	}
+}
+
+// AndNot computes the difference between the bitmap and x2, and stores the
+// result in the bitmap, as a single step, see Or.
+func (cb *ConcurrentBitmap) AndNot(x2 *Bitmap) {
+	parts := shardParts(x2)
+	cb.shards.LockAll()
+	defer cb.shards.UnlockAll()
+	for i, part := range parts {
+		cb.shards.At(i).AndNot(part)
+	}
+}
+
+// shardParts splits the containers of rb by shard. The parts share the
+// containers of rb, which the set operations only read.
+func shardParts(rb *Bitmap) []*Bitmap {
+	ra := &rb.highlowcontainer
+	return internal.SplitByShard(ra.keys, NewBitmap, func(part *Bitmap, i int) {
+		part.highlowcontainer.appendContainer(ra.keys[i], ra.containers[i], ra.needsCopyOnWrite(i))
+	})
+}
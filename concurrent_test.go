@@ -0,0 +1,102 @@
+package roaring
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrentBitmap(t *testing.T) {
+	var cb ConcurrentBitmap
+	assert.True(t, cb.IsEmpty())
+	assert.True(t, cb.CheckedAdd(1))
+	assert.False(t, cb.CheckedAdd(1))
+	cb.AddMany([]uint32{2, 3, 70000, 70001, 1 << 30})
+	cb.Add(5 << 16)
+	assert.True(t, cb.Contains(70001))
+	assert.False(t, cb.Contains(4))
+	assert.True(t, cb.CheckedRemove(2))
+	assert.False(t, cb.CheckedRemove(2))
+	cb.Remove(3)
+	assert.Equal(t, uint64(5), cb.GetCardinality())
+	assert.Equal(t, []uint32{1, 70000, 70001, 5 << 16, 1 << 30}, cb.Snapshot().ToArray())
+
+	other := BitmapOf(1, 4, 70001, 64<<16, 1<<31)
+	cb.Or(other)
+	assert.True(t, cb.Snapshot().Equals(BitmapOf(1, 4, 70000, 70001, 5<<16, 64<<16, 1<<30, 1<<31)))
+	cb.AndNot(BitmapOf(4, 1<<30))
+	assert.True(t, cb.Snapshot().Equals(BitmapOf(1, 70000, 70001, 5<<16, 64<<16, 1<<31)))
+	cb.And(other)
+	assert.True(t, cb.Snapshot().Equals(BitmapOf(1, 70001, 64<<16, 1<<31)))
+	assert.True(t, other.Equals(BitmapOf(1, 4, 70001, 64<<16, 1<<31)))
+
+	var buf bytes.Buffer
+	_, err := cb.WriteTo(&buf)
+	require.NoError(t, err)
+	read := NewBitmap()
+	_, err = read.ReadFrom(&buf)
+	require.NoError(t, err)
+	assert.True(t, read.Equals(cb.Snapshot()))
+
+	// the snapshot does not change with the bitmap
+	snapshot := cb.Snapshot()
+	cb.Add(2)
+	assert.False(t, snapshot.Contains(2))
+
+	cb.Clear()
+	assert.True(t, cb.IsEmpty())
+	assert.True(t, NewConcurrentBitmapFrom(other).Snapshot().Equals(other))
+}
+
+func TestConcurrentBitmapConcurrency(t *testing.T) {
+	cb := NewConcurrentBitmap()
+	const writers, perWriter = 8, 20000
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := uint32(0); i < perWriter; i++ {
+				x := i*writers + uint32(w)
+				cb.Add(x * 7)
+				assert.True(t, cb.Contains(x*7))
+				if i%3 == 0 {
+					cb.Remove(x * 7)
+				}
+			}
+		}()
+	}
+	// readers and bulk operations running alongside the writers
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			assert.NoError(t, cb.Snapshot().Validate())
+			cb.Or(BitmapOf(1 << 31))
+			cb.GetCardinality()
+		}
+	}()
+	wg.Wait()
+	close(done)
+	readers.Wait()
+	cb.Or(BitmapOf(1 << 31)) // in case the readers got no turn
+
+	want := NewBitmap()
+	want.Add(1 << 31)
+	for x := uint32(0); x < writers*perWriter; x++ {
+		if (x/writers)%3 != 0 {
+			want.Add(x * 7)
+		}
+	}
+	assert.True(t, cb.Snapshot().Equals(want))
+}
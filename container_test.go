@@ -283,3 +283,52 @@ func TestRoaringContainer(t *testing.T) {
 		assert.True(t, checkContent(c, s))
 	})
 }
+
+func TestContainerIsSubsetAndIntersects(t *testing.T) {
+	var sets [][]uint16
+	add := func(lo, hi, step int, skip ...int) {
+		var s []uint16
+		for i := lo; i < hi; i += step {
+			if len(skip) == 0 || i != skip[0] {
+				s = append(s, uint16(i))
+			}
+		}
+		sets = append(sets, s)
+	}
+	add(0, 200, 1)
+	add(0, 200, 1, 150)
+	add(1, 4, 1)
+	add(100, 101, 1)
+	add(65500, 1<<16, 1)
+	add(0, 10000, 2)
+	add(1, 10000, 2)
+	add(0, 1<<16, 1)
+	add(64, 128, 1)
+	add(63, 129, 1)
+	sets = append(sets, []uint16{1, 2, 3, 100, 60000})
+
+	variants := func(s []uint16) []container {
+		ac := makeContainer(s).(*arrayContainer)
+		return []container{ac, ac.toBitmapContainer(), newRunContainer16FromArray(ac)}
+	}
+	for i, s1 := range sets {
+		for j, s2 := range sets {
+			m := make(map[uint16]bool, len(s2))
+			for _, v := range s2 {
+				m[v] = true
+			}
+			subset, intersects := true, false
+			for _, v := range s1 {
+				subset = subset && m[v]
+				intersects = intersects || m[v]
+			}
+			for _, c1 := range variants(s1) {
+				for _, c2 := range variants(s2) {
+					msg := fmt.Sprintf("sets %d and %d, types %d and %d", i, j, c1.containerType(), c2.containerType())
+					assert.Equal(t, subset, c1.isSubset(c2), msg)
+					assert.Equal(t, intersects, c1.intersects(c2), msg)
+				}
+			}
+		}
+	}
+}
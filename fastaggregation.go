@@ -2,6 +2,7 @@ package roaring
 
 import (
 	"container/heap"
+	"math/bits"
 )
 
 // Or function that requires repairAfterLazy
@@ -162,6 +163,294 @@ func FastOr(bitmaps ...*Bitmap) *Bitmap {
 	return answer
 }
 
+// FastOrCardinality computes the cardinality of the union between many bitmaps
+// without building it: containers sharing a key are lazily ORed into a single
+// scratch container, so that no result container is allocated.
+func FastOrCardinality(bitmaps ...*Bitmap) uint64 {
+	switch len(bitmaps) {
+	case 0:
+		return 0
+	case 1:
+		return bitmaps[0].GetCardinality()
+	case 2:
+		return bitmaps[0].OrCardinality(bitmaps[1])
+	}
+	h := newBitmapContainerHeap(bitmaps...)
+	scratch := newBitmapContainer()
+	containers := make([]container, 0, len(bitmaps))
+	answer := uint64(0)
+	for h.Len() > 0 {
+		containers = h.Next(containers[:0]).containers
+		answer += uint64(lazyOrCardinality(containers, scratch))
+	}
+	return answer
+}
+
+// FastAndCardinality computes the cardinality of the intersection between many
+// bitmaps without building it.
+func FastAndCardinality(bitmaps ...*Bitmap) uint64 {
+	switch len(bitmaps) {
+	case 0:
+		return 0
+	case 1:
+		return bitmaps[0].GetCardinality()
+	case 2:
+		return bitmaps[0].AndCardinality(bitmaps[1])
+	}
+	h := newBitmapContainerHeap(bitmaps...)
+	if h.Len() < len(bitmaps) {
+		// one of the bitmaps is empty
+		return 0
+	}
+	scratch := newBitmapContainer()
+	containers := make([]container, 0, len(bitmaps))
+	answer := uint64(0)
+	for h.Len() > 0 {
+		containers = h.Next(containers[:0]).containers
+		if len(containers) == len(bitmaps) {
+			answer += uint64(andCardinalityMany(containers, scratch))
+		}
+	}
+	return answer
+}
+
+// lazyOrCardinality returns the cardinality of the union of containers sharing
+// a key. The union is accumulated in scratch, whose content is overwritten.
+func lazyOrCardinality(containers []container, scratch *bitmapContainer) int {
+	switch len(containers) {
+	case 1:
+		return containers[0].getCardinality()
+	case 2:
+		return containers[0].orCardinality(containers[1])
+	}
+	for _, c := range containers {
+		if c.isFull() {
+			return 1 << 16
+		}
+	}
+	scratch.resetTo(containers[0])
+	for _, c := range containers[1:] {
+		scratch.lazyIOR(c)
+	}
+	scratch.computeCardinality()
+	return scratch.getCardinality()
+}
+
+// andCardinalityMany returns the cardinality of the intersection of containers
+// sharing a key. The values of the smallest container are looked up in the
+// others; if it is large, the intersection is accumulated in scratch instead,
+// whose content is overwritten.
+func andCardinalityMany(containers []container, scratch *bitmapContainer) int {
+	if len(containers) == 2 {
+		return containers[0].andCardinality(containers[1])
+	}
+	smallest, minCard := 0, containers[0].getCardinality()
+	for i, c := range containers[1:] {
+		if card := c.getCardinality(); card < minCard {
+			smallest, minCard = i+1, card
+		}
+	}
+
+	if minCard <= arrayDefaultMaxSize {
+		answer := 0
+		containers[smallest].iterate(func(x uint16) bool {
+			for i, c := range containers {
+				if i != smallest && !c.contains(x) {
+					return true
+				}
+			}
+			answer++
+			return true
+		})
+		return answer
+	}
+
+	scratch.resetTo(containers[smallest])
+	for i, c := range containers {
+		if i == smallest {
+			continue
+		}
+		switch x := c.(type) {
+		case *bitmapContainer:
+			for k := range scratch.bitmap {
+				scratch.bitmap[k] &= x.bitmap[k]
+			}
+		case *arrayContainer:
+			// clear the gaps between values
+			start := 0
+			for _, v := range x.content {
+				resetBitmapRange(scratch.bitmap, start, int(v))
+				start = int(v) + 1
+			}
+			resetBitmapRange(scratch.bitmap, start, 1<<16)
+		case *runContainer16:
+			// clear the gaps between runs
+			start := 0
+			for _, iv := range x.iv {
+				resetBitmapRange(scratch.bitmap, start, int(iv.start))
+				start = int(iv.last()) + 1
+			}
+			resetBitmapRange(scratch.bitmap, start, 1<<16)
+		}
+	}
+	return int(popcntSlice(scratch.bitmap))
+}
+
+// ThresholdOr computes the values that are present in at least k of the
+// bitmaps, as in "match 3 of these 5 tags". ThresholdOr(1, ...) is the union
+// and ThresholdOr(len(bitmaps), ...) is the intersection; the result is empty
+// when k exceeds the number of bitmaps.
+//
+// The containers sharing a key are found with a heap, and their values are
+// counted with bit-sliced counters: the count of every value of the key is
+// spread over a few 65536-bit planes, one per bit of the count.
+func ThresholdOr(k int, bitmaps ...*Bitmap) *Bitmap {
+	if k <= 1 {
+		return FastOr(bitmaps...)
+	} else if k > len(bitmaps) {
+		return NewBitmap()
+	} else if k == len(bitmaps) {
+		return FastAnd(bitmaps...)
+	}
+
+	h := newBitmapContainerHeap(bitmaps...)
+	counter := newThresholdCounter(len(bitmaps))
+	containers := make([]container, 0, len(bitmaps))
+	answer := NewBitmap()
+	for h.Len() > 0 {
+		mc := h.Next(containers[:0])
+		containers = mc.containers
+		if len(containers) < k {
+			continue
+		}
+		if c := counter.threshold(k, containers); c != nil {
+			answer.highlowcontainer.appendContainer(mc.key, c, false)
+		}
+	}
+	return answer
+}
+
+// thresholdCounter counts how many containers hold each of the 65536 values
+// of a key. The counts are bit-sliced: bit p of the count of value x is bit x
+// of planes[p].
+type thresholdCounter struct {
+	planes [][]uint64
+	used   int // number of planes in use for the current key
+}
+
+// newThresholdCounter returns a counter for up to n containers per key.
+func newThresholdCounter(n int) *thresholdCounter {
+	planes := make([][]uint64, bits.Len(uint(n)))
+	for p := range planes {
+		planes[p] = make([]uint64, bitmapContainerSize)
+	}
+	return &thresholdCounter{planes: planes}
+}
+
+// threshold returns a container holding the values present in at least k of
+// the containers, or nil if there are none.
+func (tc *thresholdCounter) threshold(k int, containers []container) container {
+	if len(containers) == k {
+		answer := containers[0].and(containers[1])
+		for _, c := range containers[2:] {
+			if answer.isEmpty() {
+				break
+			}
+			answer = answer.iand(c)
+		}
+		if answer.isEmpty() {
+			return nil
+		}
+		return answer
+	}
+
+	tc.used = bits.Len(uint(len(containers)))
+	for _, plane := range tc.planes[:tc.used] {
+		fill(plane, 0)
+	}
+	for _, c := range containers {
+		tc.add(c)
+	}
+
+	answer := newBitmapContainer()
+	tc.atLeast(k, answer.bitmap)
+	answer.computeCardinality()
+	if answer.isEmpty() {
+		return nil
+	}
+	return repairAfterLazy(answer)
+}
+
+// add increments the counts of the values of c.
+func (tc *thresholdCounter) add(c container) {
+	switch x := c.(type) {
+	case *bitmapContainer:
+		for w, word := range x.bitmap {
+			if word != 0 {
+				tc.addWord(w, word)
+			}
+		}
+	case *arrayContainer:
+		// values sharing a word are added at once
+		w, mask := -1, uint64(0)
+		for _, v := range x.content {
+			if int(v>>6) != w {
+				if mask != 0 {
+					tc.addWord(w, mask)
+				}
+				w, mask = int(v>>6), 0
+			}
+			mask |= 1 << (v % 64)
+		}
+		if mask != 0 {
+			tc.addWord(w, mask)
+		}
+	case *runContainer16:
+		for _, iv := range x.iv {
+			start, end := int(iv.start), int(iv.last())+1
+			for w := start / 64; w <= (end-1)/64; w++ {
+				mask := ^uint64(0)
+				if w == start/64 {
+					mask &= ^uint64(0) << uint(start%64)
+				}
+				if w == (end-1)/64 {
+					mask &= ^uint64(0) >> (uint(-end) % 64)
+				}
+				tc.addWord(w, mask)
+			}
+		}
+	}
+}
+
+// addWord increments by one the counts of the values set in mask, in word w,
+// propagating the carry through the planes.
+func (tc *thresholdCounter) addWord(w int, mask uint64) {
+	carry := mask
+	for _, plane := range tc.planes[:tc.used] {
+		plane[w], carry = plane[w]^carry, plane[w]&carry
+		if carry == 0 {
+			return
+		}
+	}
+}
+
+// atLeast sets in dst the values whose count is at least k, comparing the
+// bit-sliced counts with k from the most significant plane down.
+func (tc *thresholdCounter) atLeast(k int, dst []uint64) {
+	for w := range dst {
+		greater, equal := uint64(0), ^uint64(0)
+		for p := tc.used - 1; p >= 0; p-- {
+			if k&(1<<p) != 0 {
+				equal &= tc.planes[p][w]
+			} else {
+				greater |= equal & tc.planes[p][w]
+				equal &= ^tc.planes[p][w]
+			}
+		}
+		dst[w] = greater | equal
+	}
+}
+
 // HeapOr computes the union between many bitmaps quickly using a heap.
 // It might be faster than calling Or repeatedly.
 func HeapOr(bitmaps ...*Bitmap) *Bitmap {
@@ -0,0 +1,135 @@
+package roaring
+
+import (
+	"io"
+)
+
+// Value is the type of the integers stored in a bitmap: uint32 for the
+// bitmaps of this package, uint64 for the ones of the roaring64 package.
+type Value interface {
+	uint32 | uint64
+}
+
+// GenericBitmap is the set of methods shared by the 32-bit and the 64-bit
+// bitmaps, so that code can be written once for both: *Bitmap implements
+// GenericBitmap[uint32, *Bitmap], and *roaring64.Bitmap implements
+// GenericBitmap[uint64, *roaring64.Bitmap]. B is the bitmap type itself.
+//
+// For example, the following function works with either:
+//
+//	func union[T roaring.Value, B roaring.GenericBitmap[T, B]](a, b B) B {
+//		answer := a.Clone()
+//		answer.Or(b)
+//		return answer
+//	}
+type GenericBitmap[T Value, B any] interface {
+	Add(x T)
+	CheckedAdd(x T) bool
+	AddMany(dat []T)
+	AddRange(rangeStart, rangeEnd uint64)
+	Remove(x T)
+	CheckedRemove(x T) bool
+	RemoveRange(rangeStart, rangeEnd uint64)
+	Flip(rangeStart, rangeEnd uint64)
+	Contains(x T) bool
+	Clear()
+
+	IsEmpty() bool
+	GetCardinality() uint64
+	Rank(x T) uint64
+	Select(x T) (T, error)
+	Minimum() T
+	Maximum() T
+
+	And(x2 B)
+	Or(x2 B)
+	Xor(x2 B)
+	AndNot(x2 B)
+	Intersects(x2 B) bool
+	AndCardinality(x2 B) uint64
+	Clone() B
+
+	Iterate(cb func(x T) bool)
+	ToArray() []T
+	String() string
+
+	RunOptimize()
+	GetSerializedSizeInBytes() uint64
+	WriteTo(stream io.Writer) (int64, error)
+	ToBytes() ([]byte, error)
+	MarshalBinary() ([]byte, error)
+	UnmarshalBinary(data []byte) error
+}
+
+var _ GenericBitmap[uint32, *Bitmap] = (*Bitmap)(nil)
+
+// GenericFastOrer is implemented by the bitmaps with a dedicated union of
+// many bitmaps, which GenericFastOr uses. FastOrWith returns the union of
+// the bitmap and others, which it leaves untouched.
+type GenericFastOrer[B any] interface {
+	FastOrWith(others ...B) B
+}
+
+// GenericFastAnder is implemented by the bitmaps with a dedicated
+// intersection of many bitmaps, which GenericFastAnd uses. FastAndWith
+// returns the intersection of the bitmap and others, which it leaves
+// untouched.
+type GenericFastAnder[B any] interface {
+	FastAndWith(others ...B) B
+}
+
+// GenericFastOr computes the union between many bitmaps of the same type,
+// for instance *Bitmap or *roaring64.Bitmap. The type arguments are
+// inferred: GenericFastOr(a, b, c). Bitmaps of this package are handed to
+// FastOr. Types with a FastOrWith method (see GenericFastOrer), such as
+// *roaring64.Bitmap, are handed to it; other types are merged with one Or
+// call per bitmap.
+func GenericFastOr[T Value, X any, B interface {
+	*X
+	GenericBitmap[T, B]
+}](bitmaps ...B) B {
+	if bs, ok := any(bitmaps).([]*Bitmap); ok {
+		return any(FastOr(bs...)).(B)
+	}
+	if len(bitmaps) > 0 {
+		if first, ok := any(bitmaps[0]).(GenericFastOrer[B]); ok {
+			return first.FastOrWith(bitmaps[1:]...)
+		}
+	}
+	answer := B(new(X))
+	for _, bm := range bitmaps {
+		answer.Or(bm)
+	}
+	return answer
+}
+
+// GenericFastAnd computes the intersection between many bitmaps of the
+// same type, for instance *Bitmap or *roaring64.Bitmap. The type arguments
+// are inferred: GenericFastAnd(a, b, c). Bitmaps of this package are
+// handed to FastAnd. Types with a FastAndWith method (see
+// GenericFastAnder), such as *roaring64.Bitmap, are handed to it; other
+// types are intersected with one And call per bitmap.
+func GenericFastAnd[T Value, X any, B interface {
+	*X
+	GenericBitmap[T, B]
+}](bitmaps ...B) B {
+	if bs, ok := any(bitmaps).([]*Bitmap); ok {
+		return any(FastAnd(bs...)).(B)
+	}
+	if len(bitmaps) > 0 {
+		if first, ok := any(bitmaps[0]).(GenericFastAnder[B]); ok {
+			return first.FastAndWith(bitmaps[1:]...)
+		}
+	}
+	if len(bitmaps) == 0 {
+		return B(new(X))
+	}
+	answer := bitmaps[0].Clone()
+	for _, bm := range bitmaps[1:] {
+		if answer.IsEmpty() {
+			break
+		}
+		answer.And(bm)
+	}
+	return answer
+}
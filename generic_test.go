@@ -0,0 +1,92 @@
+package roaring_test
+
+import (
+	"testing"
+
+	"github.com/RoaringBitmap/roaring/v2"
+	"github.com/RoaringBitmap/roaring/v2/roaring64"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fill is written once for both bitmap types.
+func fill[T roaring.Value, B roaring.GenericBitmap[T, B]](t *testing.T, rb B, values ...T) {
+	for _, x := range values {
+		assert.True(t, rb.CheckedAdd(x))
+		assert.False(t, rb.CheckedAdd(x))
+	}
+}
+
+func genericRoundTrip[T roaring.Value, B roaring.GenericBitmap[T, B]](t *testing.T, a, b, empty B) {
+	fill(t, a, 1, 2, 3, 100, 1<<20)
+	fill(t, b, 2, 3, 4, 1<<20)
+
+	assert.True(t, a.Contains(100))
+	assert.EqualValues(t, 5, a.GetCardinality())
+	assert.EqualValues(t, 3, a.Rank(3))
+	x, err := a.Select(3)
+	require.NoError(t, err)
+	assert.EqualValues(t, 100, x)
+	assert.EqualValues(t, 1, a.Minimum())
+	assert.EqualValues(t, 1<<20, a.Maximum())
+
+	and := a.Clone()
+	and.And(b)
+	assert.Equal(t, []T{2, 3, 1 << 20}, and.ToArray())
+	assert.EqualValues(t, 3, a.AndCardinality(b))
+	assert.True(t, a.Intersects(b))
+
+	or := a.Clone()
+	or.Or(b)
+	assert.Equal(t, []T{1, 2, 3, 4, 100, 1 << 20}, or.ToArray())
+
+	xor := a.Clone()
+	xor.Xor(b)
+	assert.Equal(t, []T{1, 4, 100}, xor.ToArray())
+
+	andNot := a.Clone()
+	andNot.AndNot(b)
+	assert.Equal(t, []T{1, 100}, andNot.ToArray())
+
+	var visited []T
+	a.Iterate(func(x T) bool {
+		visited = append(visited, x)
+		return len(visited) < 2
+	})
+	assert.Equal(t, []T{1, 2}, visited)
+
+	data, err := a.MarshalBinary()
+	require.NoError(t, err)
+	assert.EqualValues(t, len(data), a.GetSerializedSizeInBytes())
+	require.NoError(t, empty.UnmarshalBinary(data))
+	assert.Equal(t, a.ToArray(), empty.ToArray())
+	assert.Equal(t, a.String(), empty.String())
+
+	a.Remove(1)
+	assert.False(t, a.CheckedRemove(1))
+	a.RemoveRange(0, 1<<20)
+	assert.Equal(t, []T{1 << 20}, a.ToArray())
+	a.Clear()
+	assert.True(t, a.IsEmpty())
+}
+
+func TestGenericBitmap(t *testing.T) {
+	genericRoundTrip(t, roaring.New(), roaring.New(), roaring.New())
+	genericRoundTrip(t, roaring64.New(), roaring64.New(), roaring64.New())
+}
+
+func TestGenericFastAggregation(t *testing.T) {
+	a32, b32, c32 := roaring.BitmapOf(1, 2, 3), roaring.BitmapOf(2, 3, 1<<30), roaring.BitmapOf(3, 4)
+	assert.Equal(t, []uint32{1, 2, 3, 4, 1 << 30}, roaring.GenericFastOr(a32, b32, c32).ToArray())
+	assert.Equal(t, []uint32{3}, roaring.GenericFastAnd(a32, b32, c32).ToArray())
+	assert.True(t, roaring.GenericFastOr[uint32, roaring.Bitmap, *roaring.Bitmap]().IsEmpty())
+
+	a64, b64, c64 := roaring64.BitmapOf(1, 2, 3<<40), roaring64.BitmapOf(2, 3<<40, 1<<60), roaring64.BitmapOf(2, 3<<40, 4)
+	assert.Equal(t, []uint64{1, 2, 4, 3 << 40, 1 << 60}, roaring.GenericFastOr(a64, b64, c64).ToArray())
+	assert.Equal(t, []uint64{2, 3 << 40}, roaring.GenericFastAnd(a64, b64, c64).ToArray())
+	assert.True(t, roaring.GenericFastAnd[uint64, roaring64.Bitmap, *roaring64.Bitmap]().IsEmpty())
+	assert.Equal(t, roaring64.FastOr(a64, b64, c64).ToArray(), roaring.GenericFastOr(a64, b64, c64).ToArray())
+
+	// the inputs are left untouched
+	assert.Equal(t, []uint64{1, 2, 3 << 40}, a64.ToArray())
+}
@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// The envelope of the checksummed bitmaps of the roaring and roaring64
+// packages (see their checksum.go for the layout) only differs by its
+// cookie and by the entries of its <checksums> section.
+
+const (
+	// ChecksumHeaderSize is the size of the <header> of the envelope.
+	ChecksumHeaderSize = 32
+
+	// ChecksummedPortable and ChecksummedFrozen are the payload formats.
+	ChecksummedPortable = 0
+	ChecksummedFrozen   = 1
+)
+
+// CRC32C is the table of the checksums of the envelope.
+var CRC32C = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	// ErrChecksumInvalidCookie is returned when the input is not a checksummed bitmap.
+	ErrChecksumInvalidCookie = errors.New("input is not a checksummed bitmap")
+	// ErrChecksumCorrupted is returned when a checksummed bitmap does not
+	// match its checksums.
+	ErrChecksumCorrupted = errors.New("checksummed bitmap is corrupted")
+)
+
+// ChecksumEnvelope describes the envelope of one package.
+type ChecksumEnvelope struct {
+	Cookie     uint32
+	EntrySize  int    // size in bytes of an entry of the <checksums> section
+	MaxEntries uint64 // largest number of containers of a bitmap
+}
+
+// PutHeader fills header for a payload of the given format and length,
+// followed by the <checksums> section table.
+func (e ChecksumEnvelope) PutHeader(header []byte, format uint32, payloadLen uint64, table []byte) {
+	binary.LittleEndian.PutUint32(header[0:], e.Cookie)
+	binary.LittleEndian.PutUint32(header[4:], format)
+	binary.LittleEndian.PutUint64(header[8:], payloadLen)
+	binary.LittleEndian.PutUint64(header[16:], uint64(len(table)/e.EntrySize))
+	binary.LittleEndian.PutUint32(header[24:], 0)
+	crc := crc32.Update(crc32.Checksum(header[:28], CRC32C), CRC32C, table)
+	binary.LittleEndian.PutUint32(header[28:], crc)
+}
+
+// ParseHeader checks the header of a checksummed bitmap and returns the
+// length of its payload and of its <checksums> section.
+func (e ChecksumEnvelope) ParseHeader(header []byte, format uint32) (payloadLen, tableLen uint64, err error) {
+	if binary.LittleEndian.Uint32(header) != e.Cookie {
+		return 0, 0, ErrChecksumInvalidCookie
+	}
+	if f := binary.LittleEndian.Uint32(header[4:]); f != format {
+		return 0, 0, fmt.Errorf("%w: unexpected payload format %d", ErrChecksumCorrupted, f)
+	}
+	count := binary.LittleEndian.Uint64(header[16:])
+	if count > e.MaxEntries {
+		return 0, 0, fmt.Errorf("%w: more than %d containers", ErrChecksumCorrupted, e.MaxEntries)
+	}
+	return binary.LittleEndian.Uint64(header[8:]), count * uint64(e.EntrySize), nil
+}
+
+// CheckChecksumTable verifies the checksum of the header and of the
+// <checksums> section.
+func CheckChecksumTable(header, table []byte) error {
+	crc := crc32.Update(crc32.Checksum(header[:28], CRC32C), CRC32C, table)
+	if crc != binary.LittleEndian.Uint32(header[28:]) {
+		return fmt.Errorf("%w: checksum table does not match", ErrChecksumCorrupted)
+	}
+	return nil
+}
+
+// FirstChecksumMismatch compares the actual checksums of the containers of
+// a bitmap with the expected ones, both given by key in increasing key
+// order, and returns the first container that does not match. A container
+// that is missing, or that should not be there, has a checksum of zero.
+// found is false if all the checksums match.
+func FirstChecksumMismatch[K cmp.Ordered](actualCount int, actualAt func(i int) (K, uint32),
+	expectedCount int, expectedAt func(j int) (K, uint32)) (key K, expected, actual uint32, found bool) {
+
+	i, j := 0, 0
+	for i < actualCount || j < expectedCount {
+		var actualKey, expectedKey K
+		var actualSum, expectedSum uint32
+		if i < actualCount {
+			actualKey, actualSum = actualAt(i)
+		}
+		if j < expectedCount {
+			expectedKey, expectedSum = expectedAt(j)
+		}
+		switch {
+		case j == expectedCount || (i < actualCount && actualKey < expectedKey):
+			return actualKey, 0, actualSum, true
+		case i == actualCount || expectedKey < actualKey:
+			return expectedKey, expectedSum, 0, true
+		case expectedSum != actualSum:
+			return expectedKey, expectedSum, actualSum, true
+		}
+		i++
+		j++
+	}
+	return key, 0, 0, false
+}
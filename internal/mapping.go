@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrMappingClosed is returned when a Mapping is used after Close.
+var ErrMappingClosed = errors.New("memory-mapped bitmap used after Close")
+
+// Mapping holds a value loaded from a memory-mapped file. The value is only
+// reachable through View, so that Close can release the mapping once no
+// caller uses the value anymore.
+type Mapping[T any] struct {
+	mu    sync.RWMutex
+	value *T
+	unmap func() error
+}
+
+// OpenMapping maps the file at path with MapFile and loads the value from the
+// mapped data with load. The mapping is released if load fails.
+func OpenMapping[T any](path string, load func(data []byte) (*T, error)) (*Mapping[T], error) {
+	data, unmap, err := MapFile(path)
+	if err != nil {
+		return nil, err
+	}
+	value, err := load(data)
+	if err != nil {
+		unmap()
+		return nil, err
+	}
+	return &Mapping[T]{value: value, unmap: unmap}, nil
+}
+
+// View calls fn with the value, holding off Close until fn returns.
+func (m *Mapping[T]) View(fn func(value *T) error) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.unmap == nil {
+		return ErrMappingClosed
+	}
+	return fn(m.value)
+}
+
+// Close waits for the running View calls to return and releases the mapping.
+// Calling Close more than once returns ErrMappingClosed.
+func (m *Mapping[T]) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.unmap == nil {
+		return ErrMappingClosed
+	}
+	m.value = nil
+	err := m.unmap()
+	m.unmap = nil
+	return err
+}
@@ -0,0 +1,16 @@
+//go:build !unix || appengine
+
+package internal
+
+import "os"
+
+// MapFile reads the file at path into memory. Memory mapping is not
+// available on this platform, so the data is copied onto the heap and
+// the returned unmap function merely drops it.
+func MapFile(path string) (data []byte, unmap func() error, err error) {
+	data, err = os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error { return nil }, nil
+}
@@ -0,0 +1,39 @@
+//go:build unix && !appengine
+
+package internal
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// MapFile maps the file at path into memory with read-only permissions.
+// The returned unmap function releases the mapping; the data slice must not
+// be accessed once it has been called.
+func MapFile(path string) (data []byte, unmap func() error, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	size := fi.Size()
+	if size == 0 {
+		// mmap refuses empty mappings
+		return []byte{}, func() error { return nil }, nil
+	}
+	if size < 0 || int64(int(size)) != size {
+		return nil, nil, errors.New("file is too large to be memory-mapped")
+	}
+
+	data, err = syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, &os.PathError{Op: "mmap", Path: path, Err: err}
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
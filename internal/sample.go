@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+)
+
+// RankSet is a bitmap of the ranks drawn by SampleRanks.
+type RankSet[T uint32 | uint64] interface {
+	Add(x T)
+	CheckedAdd(x T) bool
+	Flip(rangeStart, rangeEnd uint64)
+}
+
+// SampleRanks adds to the empty bitmap ranks k distinct ranks drawn uniformly
+// from [0, n), with Floyd's algorithm, and returns it. When k is more than
+// half of n, the ranks left out are drawn instead.
+func SampleRanks[T uint32 | uint64, B RankSet[T]](ranks B, n, k uint64, rng *rand.Rand) B {
+	m := k
+	if k > n/2 {
+		m = n - k
+	}
+	for j := n - m; j < n; j++ {
+		if !ranks.CheckedAdd(T(RandUint64n(rng, j+1))) {
+			ranks.Add(T(j))
+		}
+	}
+	if m != k {
+		ranks.Flip(0, n)
+	}
+	return ranks
+}
+
+// RandomRanks fills ranks with ranks drawn uniformly and independently from
+// [0, n), for n > 0, and sorts them.
+func RandomRanks(ranks []uint64, n uint64, rng *rand.Rand) {
+	for i := range ranks {
+		ranks[i] = RandUint64n(rng, n)
+	}
+	slices.Sort(ranks)
+}
+
+// RandUint64n returns a uniform random number in [0, n), for n > 0.
+func RandUint64n(rng *rand.Rand, n uint64) uint64 {
+	if n <= math.MaxInt64 {
+		return uint64(rng.Int63n(int64(n)))
+	}
+	for {
+		if x := rng.Uint64(); x < n {
+			return x
+		}
+	}
+}
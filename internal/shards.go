@@ -0,0 +1,95 @@
+package internal
+
+import "sync"
+
+// ShardCount is the number of shards of the concurrent bitmaps.
+const ShardCount = 64
+
+// Shards holds the locking of the concurrent bitmaps of the roaring and
+// roaring64 packages: ShardCount values, each guarded by its own lock, and
+// chosen by key. The zero value is ready to use. Shards must not be copied
+// after first use.
+type Shards[T any] struct {
+	shards [ShardCount]struct {
+		mu sync.RWMutex
+		v  T
+	}
+}
+
+// ShardOf returns the index of the shard of key.
+func ShardOf(key uint32) int {
+	return int(key % ShardCount)
+}
+
+// At returns the value of the shard i, which the caller must have locked.
+func (s *Shards[T]) At(i int) *T {
+	return &s.shards[i].v
+}
+
+// Lock locks the shard of key for writing and returns its value.
+func (s *Shards[T]) Lock(key uint32) *T {
+	sh := &s.shards[ShardOf(key)]
+	sh.mu.Lock()
+	return &sh.v
+}
+
+// Unlock undoes Lock.
+func (s *Shards[T]) Unlock(key uint32) {
+	s.shards[ShardOf(key)].mu.Unlock()
+}
+
+// RLock locks the shard of key for reading and returns its value.
+func (s *Shards[T]) RLock(key uint32) *T {
+	sh := &s.shards[ShardOf(key)]
+	sh.mu.RLock()
+	return &sh.v
+}
+
+// RUnlock undoes RLock.
+func (s *Shards[T]) RUnlock(key uint32) {
+	s.shards[ShardOf(key)].mu.RUnlock()
+}
+
+// The shards are always locked in the same order, so that operations locking
+// all of them cannot deadlock.
+
+// LockAll locks all the shards for writing.
+func (s *Shards[T]) LockAll() {
+	for i := range s.shards {
+		s.shards[i].mu.Lock()
+	}
+}
+
+// UnlockAll undoes LockAll.
+func (s *Shards[T]) UnlockAll() {
+	for i := range s.shards {
+		s.shards[i].mu.Unlock()
+	}
+}
+
+// RLockAll locks all the shards for reading.
+func (s *Shards[T]) RLockAll() {
+	for i := range s.shards {
+		s.shards[i].mu.RLock()
+	}
+}
+
+// RUnlockAll undoes RLockAll.
+func (s *Shards[T]) RUnlockAll() {
+	for i := range s.shards {
+		s.shards[i].mu.RUnlock()
+	}
+}
+
+// SplitByShard returns one part per shard, made by newPart, to which add
+// appends, in order, the entries i of keys mapping to the shard.
+func SplitByShard[K ~uint16 | ~uint32, P any](keys []K, newPart func() P, add func(part P, i int)) []P {
+	parts := make([]P, ShardCount)
+	for i := range parts {
+		parts[i] = newPart()
+	}
+	for i, key := range keys {
+		add(parts[ShardOf(uint32(key))], i)
+	}
+	return parts
+}
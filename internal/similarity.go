@@ -0,0 +1,27 @@
+package internal
+
+// The similarity indexes of two bitmaps, given their cardinalities card1 and
+// card2 and the cardinality andCard of their intersection. Where the
+// denominator is zero, which happens when a bitmap is empty, they are 1.
+
+// JaccardIndex returns andCard / (card1 + card2 - andCard).
+func JaccardIndex(card1, card2, andCard uint64) float64 {
+	return similarity(andCard, card1+card2-andCard)
+}
+
+// DiceCoefficient returns 2 andCard / (card1 + card2).
+func DiceCoefficient(card1, card2, andCard uint64) float64 {
+	return similarity(2*andCard, card1+card2)
+}
+
+// OverlapCoefficient returns andCard / min(card1, card2).
+func OverlapCoefficient(card1, card2, andCard uint64) float64 {
+	return similarity(andCard, min(card1, card2))
+}
+
+func similarity(numerator, denominator uint64) float64 {
+	if denominator == 0 {
+		return 1
+	}
+	return float64(numerator) / float64(denominator)
+}
@@ -0,0 +1,588 @@
+package roaring
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/RoaringBitmap/roaring/v2/internal"
+)
+
+// ErrLazyBitmapCorrupted is returned when the header of a serialized bitmap
+// opened with NewLazyBitmap or NewLazyBitmapAt is inconsistent.
+var ErrLazyBitmapCorrupted = errors.New("corrupted serialized bitmap header")
+
+// ErrLazyBitmapEmpty is returned by the Minimum and Maximum methods of an
+// empty LazyBitmap.
+var ErrLazyBitmapEmpty = errors.New("empty bitmap")
+
+// LazyBitmap reads a bitmap in the portable format (see WriteTo) the way
+// ReadFrom and FromBuffer do, except that its containers are decoded on
+// first use. Opening it only reads the key/cardinality header and the
+// container offsets, so probing a few key ranges of a very large bitmap
+// touches few of its bytes.
+//
+// Point queries (Contains, Rank, Select...) and iteration are answered
+// directly. For everything else, Range and ToBitmap return a regular Bitmap
+// made of the containers decoded so far, on which all the Bitmap operations
+// apply; And, AndCardinality and Intersects only decode the containers whose
+// keys the other bitmap holds.
+//
+// A LazyBitmap is safe for concurrent use: every container is decoded at
+// most once, and the decoded containers are shared, with copy-on-write, by
+// the bitmaps it returns.
+//
+// The header is checked when the bitmap is opened, but containers are only
+// read when they are decoded: the methods decoding containers return the
+// error met while reading them, if any. Call Validate upfront to read them
+// all at once.
+type LazyBitmap struct {
+	r    io.ReaderAt
+	data []byte
+
+	keycard     []uint16 // interleaved key and cardinality-minus-one pairs
+	isRunBitmap []byte
+	offsets     []uint64 // offsets of the containers, followed by the end of the data
+	cardinality uint64
+
+	slots []lazyContainerSlot
+}
+
+type lazyContainerSlot struct {
+	once sync.Once
+	c    container
+	err  error
+}
+
+// NewLazyBitmap opens the bitmap serialized in data. As with FromBuffer,
+// decoded containers point into data, which must not be modified and must
+// remain available while the LazyBitmap, or any bitmap derived from it, is
+// in use. data may come from a memory-mapped file.
+func NewLazyBitmap(data []byte) (*LazyBitmap, error) {
+	lb := &LazyBitmap{data: data}
+	if err := lb.readHeader(uint64(len(data))); err != nil {
+		return nil, err
+	}
+	return lb, nil
+}
+
+// NewLazyBitmapAt opens the bitmap of the given size serialized at the
+// beginning of r. Containers are read from r when they are decoded.
+func NewLazyBitmapAt(r io.ReaderAt, size int64) (*LazyBitmap, error) {
+	if size < 0 {
+		return nil, ErrLazyBitmapCorrupted
+	}
+	lb := &LazyBitmap{r: r}
+	if err := lb.readHeader(uint64(size)); err != nil {
+		return nil, err
+	}
+	return lb, nil
+}
+
+// section returns the bytes in [offset, offset+length), which must lie
+// within the serialized bitmap.
+func (lb *LazyBitmap) section(offset, length uint64) ([]byte, error) {
+	if lb.r == nil {
+		return lb.data[offset : offset+length], nil
+	}
+	buf := make([]byte, length)
+	// ReadAt may report io.EOF along with a full read at the end of the input
+	if n, err := lb.r.ReadAt(buf, int64(offset)); err != nil && (err != io.EOF || uint64(n) != length) {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (lb *LazyBitmap) readHeader(size uint64) error {
+	if size < 4 {
+		return ErrLazyBitmapCorrupted
+	}
+	cookieBuf, err := lb.section(0, 4)
+	if err != nil {
+		return err
+	}
+	cookie := binary.LittleEndian.Uint32(cookieBuf)
+
+	// work out the size of the header before reading it whole
+	var n, headerSize uint64
+	hasOffsets := true
+	if cookie&0x0000FFFF == serialCookie {
+		n = uint64(cookie>>16) + 1
+		hasOffsets = n >= noOffsetThreshold
+		headerSize = 4 + (n+7)/8 + 4*n
+	} else if cookie == serialCookieNoRunContainer {
+		if size < 8 {
+			return ErrLazyBitmapCorrupted
+		}
+		sizeBuf, err := lb.section(4, 4)
+		if err != nil {
+			return err
+		}
+		n = uint64(binary.LittleEndian.Uint32(sizeBuf))
+		headerSize = 8 + 4*n
+	} else {
+		return fmt.Errorf("%w: did not find expected serialCookie in header", ErrLazyBitmapCorrupted)
+	}
+	if n > 1<<16 {
+		return fmt.Errorf("%w: more than (1<<16) containers", ErrLazyBitmapCorrupted)
+	}
+	if hasOffsets {
+		headerSize += 4 * n
+	}
+	if headerSize > size {
+		return fmt.Errorf("%w: truncated header", ErrLazyBitmapCorrupted)
+	}
+
+	header, err := lb.section(0, headerSize)
+	if err != nil {
+		return err
+	}
+	keycard, isRunBitmap, err := readSerializedHeader(internal.NewByteBuffer(header))
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrLazyBitmapCorrupted, err)
+	}
+	// the header may alias data we don't own, so keep our own copy
+	lb.keycard = append([]uint16(nil), keycard...)
+	lb.isRunBitmap = append([]byte(nil), isRunBitmap...)
+
+	lb.offsets = make([]uint64, n+1)
+	if hasOffsets {
+		offsetBuf := header[headerSize-4*n:]
+		for i := range n {
+			lb.offsets[i] = uint64(binary.LittleEndian.Uint32(offsetBuf[4*i:]))
+		}
+	} else {
+		// few containers: walk them to find where they start
+		off := headerSize
+		for i := range int(n) {
+			lb.offsets[i] = off
+			if lb.isRunAtIndex(i) {
+				if off+2 > size {
+					return fmt.Errorf("%w: truncated run container", ErrLazyBitmapCorrupted)
+				}
+				nrBuf, err := lb.section(off, 2)
+				if err != nil {
+					return err
+				}
+				off += 2 + 4*uint64(binary.LittleEndian.Uint16(nrBuf))
+			} else {
+				off += uint64(getSizeInBytesFromCardinality(lb.cardinalityAtIndex(i)))
+			}
+			if off > size {
+				return fmt.Errorf("%w: truncated container", ErrLazyBitmapCorrupted)
+			}
+		}
+	}
+	lb.offsets[n] = size
+
+	// the data following the last container is not part of it
+	if n > 0 {
+		last := int(n) - 1
+		if lb.offsets[last] > size {
+			return fmt.Errorf("%w: container #%d out of bounds", ErrLazyBitmapCorrupted, last)
+		}
+		end := lb.offsets[last] + uint64(getSizeInBytesFromCardinality(lb.cardinalityAtIndex(last)))
+		if lb.isRunAtIndex(last) {
+			if lb.offsets[last]+2 > size {
+				return fmt.Errorf("%w: truncated run container", ErrLazyBitmapCorrupted)
+			}
+			nrBuf, err := lb.section(lb.offsets[last], 2)
+			if err != nil {
+				return err
+			}
+			end = lb.offsets[last] + 2 + 4*uint64(binary.LittleEndian.Uint16(nrBuf))
+		}
+		if end > size {
+			return fmt.Errorf("%w: truncated container", ErrLazyBitmapCorrupted)
+		}
+		lb.offsets[n] = end
+	}
+
+	for i := range int(n) {
+		if i > 0 && lb.getKeyAtIndex(i-1) >= lb.getKeyAtIndex(i) {
+			return ErrKeySortOrder
+		}
+		start, end := lb.offsets[i], lb.offsets[i+1]
+		if start < headerSize || start > end {
+			return fmt.Errorf("%w: container #%d out of bounds", ErrLazyBitmapCorrupted, i)
+		}
+		if !lb.isRunAtIndex(i) && uint64(getSizeInBytesFromCardinality(lb.cardinalityAtIndex(i))) > end-start {
+			return fmt.Errorf("%w: container #%d out of bounds", ErrLazyBitmapCorrupted, i)
+		}
+		lb.cardinality += uint64(lb.cardinalityAtIndex(i))
+	}
+
+	lb.slots = make([]lazyContainerSlot, n)
+	return nil
+}
+
+func (lb *LazyBitmap) size() int {
+	return len(lb.keycard) / 2
+}
+
+func (lb *LazyBitmap) getKeyAtIndex(i int) uint16 {
+	return lb.keycard[2*i]
+}
+
+func (lb *LazyBitmap) cardinalityAtIndex(i int) int {
+	return int(lb.keycard[2*i+1]) + 1
+}
+
+func (lb *LazyBitmap) isRunAtIndex(i int) bool {
+	return lb.isRunBitmap != nil && lb.isRunBitmap[i/8]&(1<<(i%8)) != 0
+}
+
+// getIndex returns the index of the container with key x,
+// or a negative value if there is none (see roaringArray.binarySearch).
+func (lb *LazyBitmap) getIndex(x uint16) int {
+	low, high := 0, lb.size()-1
+	for low <= high {
+		middle := low + (high-low)/2
+		k := lb.getKeyAtIndex(middle)
+		if k < x {
+			low = middle + 1
+		} else if k > x {
+			high = middle - 1
+		} else {
+			return middle
+		}
+	}
+	return -(low + 1)
+}
+
+func (lb *LazyBitmap) decode(i int) (container, error) {
+	start, end := lb.offsets[i], lb.offsets[i+1]
+	buf, err := lb.section(start, end-start)
+	if err != nil {
+		return nil, err
+	}
+	// decoded containers are shared, so they are only ever handed out with
+	// copy-on-write set, whether or not buf belongs to us
+	return readSerializedContainer(internal.NewByteBuffer(buf), lb.cardinalityAtIndex(i), lb.isRunAtIndex(i))
+}
+
+// getContainerAtIndex returns the container at index i, decoding and
+// validating it on first use.
+func (lb *LazyBitmap) getContainerAtIndex(i int) (container, error) {
+	slot := &lb.slots[i]
+	slot.once.Do(func() {
+		slot.c, slot.err = lb.decode(i)
+		if slot.err == nil {
+			slot.err = slot.c.validate()
+		}
+		if slot.err != nil {
+			slot.c = nil
+			slot.err = fmt.Errorf("could not decode container #%d (key %d): %w", i, lb.getKeyAtIndex(i), slot.err)
+		}
+	})
+	return slot.c, slot.err
+}
+
+// Validate decodes every container and checks that the bitmap is
+// internally consistent. It returns the first error encountered.
+func (lb *LazyBitmap) Validate() error {
+	for i := range lb.slots {
+		if _, err := lb.getContainerAtIndex(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetCardinality returns the number of integers contained in the bitmap.
+// It does not decode any container.
+func (lb *LazyBitmap) GetCardinality() uint64 {
+	return lb.cardinality
+}
+
+// IsEmpty returns true if the bitmap is empty.
+func (lb *LazyBitmap) IsEmpty() bool {
+	return lb.size() == 0
+}
+
+// Minimum returns the smallest value stored in the bitmap, or
+// ErrLazyBitmapEmpty if it is empty.
+func (lb *LazyBitmap) Minimum() (uint32, error) {
+	if lb.size() == 0 {
+		return 0, ErrLazyBitmapEmpty
+	}
+	c, err := lb.getContainerAtIndex(0)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(c.minimum()) | (uint32(lb.getKeyAtIndex(0)) << 16), nil
+}
+
+// Maximum returns the largest value stored in the bitmap, or
+// ErrLazyBitmapEmpty if it is empty.
+func (lb *LazyBitmap) Maximum() (uint32, error) {
+	if lb.size() == 0 {
+		return 0, ErrLazyBitmapEmpty
+	}
+	last := lb.size() - 1
+	c, err := lb.getContainerAtIndex(last)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(c.maximum()) | (uint32(lb.getKeyAtIndex(last)) << 16), nil
+}
+
+// Contains returns true if the integer is contained in the bitmap.
+// It decodes at most the one container that may hold x.
+func (lb *LazyBitmap) Contains(x uint32) (bool, error) {
+	i := lb.getIndex(highbits(x))
+	if i < 0 {
+		return false, nil
+	}
+	c, err := lb.getContainerAtIndex(i)
+	if err != nil {
+		return false, err
+	}
+	return c.contains(lowbits(x)), nil
+}
+
+// Rank returns the number of integers that are smaller or equal to x (see Bitmap.Rank).
+// It decodes at most the one container that may hold x.
+func (lb *LazyBitmap) Rank(x uint32) (uint64, error) {
+	size := uint64(0)
+	for i := 0; i < lb.size(); i++ {
+		key := lb.getKeyAtIndex(i)
+		if key > highbits(x) {
+			return size, nil
+		}
+		if key < highbits(x) {
+			size += uint64(lb.cardinalityAtIndex(i))
+		} else {
+			c, err := lb.getContainerAtIndex(i)
+			if err != nil {
+				return 0, err
+			}
+			return size + uint64(c.rank(lowbits(x))), nil
+		}
+	}
+	return size, nil
+}
+
+// Select returns the xth integer in the bitmap (see Bitmap.Select).
+// It decodes only the container holding the result.
+func (lb *LazyBitmap) Select(x uint32) (uint32, error) {
+	remaining := x
+	for i := 0; i < lb.size(); i++ {
+		card := uint32(lb.cardinalityAtIndex(i))
+		if remaining >= card {
+			remaining -= card
+		} else {
+			c, err := lb.getContainerAtIndex(i)
+			if err != nil {
+				return 0, err
+			}
+			key := lb.getKeyAtIndex(i)
+			return uint32(key)<<16 + uint32(c.selectInt(uint16(remaining))), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot find %dth integer in a bitmap with only %d items", x, lb.GetCardinality())
+}
+
+// ToBitmap decodes every container and returns them as a Bitmap. The
+// containers are shared with the LazyBitmap and marked copy-on-write, so
+// the result may be modified.
+func (lb *LazyBitmap) ToBitmap() (*Bitmap, error) {
+	return lb.containersBetween(0, lb.size())
+}
+
+// Range returns the values of the bitmap in [rangeStart, rangeEnd) as a
+// Bitmap, decoding only the containers the range overlaps. As with ToBitmap,
+// the result shares its containers with copy-on-write and may be modified.
+func (lb *LazyBitmap) Range(rangeStart, rangeEnd uint64) (*Bitmap, error) {
+	if rangeEnd > MaxRange {
+		rangeEnd = MaxRange
+	}
+	if rangeStart >= rangeEnd {
+		return NewBitmap(), nil
+	}
+	begin := lb.getIndex(highbits(uint32(rangeStart)))
+	if begin < 0 {
+		begin = -begin - 1
+	}
+	end := lb.getIndex(highbits(uint32(rangeEnd - 1)))
+	if end < 0 {
+		end = -end - 1
+	} else {
+		end++
+	}
+	answer, err := lb.containersBetween(begin, end)
+	if err != nil {
+		return nil, err
+	}
+	answer.RemoveRange(0, rangeStart)
+	answer.RemoveRange(rangeEnd, MaxRange)
+	return answer, nil
+}
+
+// containersBetween returns a Bitmap made of the containers of lb from index
+// begin to index end (excluded).
+func (lb *LazyBitmap) containersBetween(begin, end int) (*Bitmap, error) {
+	answer := NewBitmap()
+	for i := begin; i < end; i++ {
+		c, err := lb.getContainerAtIndex(i)
+		if err != nil {
+			return nil, err
+		}
+		answer.highlowcontainer.appendContainer(lb.getKeyAtIndex(i), c, true)
+	}
+	return answer, nil
+}
+
+// containersMatching returns a Bitmap made of the containers of lb whose
+// keys are also present in x, decoding only these.
+func (lb *LazyBitmap) containersMatching(x *Bitmap) (*Bitmap, error) {
+	answer := NewBitmap()
+	pos2 := -1
+	for i := 0; i < lb.size(); i++ {
+		key := lb.getKeyAtIndex(i)
+		pos2 = x.highlowcontainer.advanceUntil(key, pos2)
+		if pos2 == x.highlowcontainer.size() {
+			break
+		}
+		if x.highlowcontainer.getKeyAtIndex(pos2) == key {
+			c, err := lb.getContainerAtIndex(i)
+			if err != nil {
+				return nil, err
+			}
+			answer.highlowcontainer.appendContainer(key, c, true)
+		} else {
+			pos2--
+		}
+	}
+	return answer, nil
+}
+
+// And computes the intersection between the bitmap and x and returns the
+// result. Only the containers whose keys are present in x are decoded.
+func (lb *LazyBitmap) And(x *Bitmap) (*Bitmap, error) {
+	matching, err := lb.containersMatching(x)
+	if err != nil {
+		return nil, err
+	}
+	return And(matching, x), nil
+}
+
+// AndCardinality returns the cardinality of the intersection between the
+// bitmap and x. Only the containers whose keys are present in x are decoded.
+func (lb *LazyBitmap) AndCardinality(x *Bitmap) (uint64, error) {
+	matching, err := lb.containersMatching(x)
+	if err != nil {
+		return 0, err
+	}
+	return matching.AndCardinality(x), nil
+}
+
+// Intersects checks whether the bitmap and x intersect. Only the containers
+// whose keys are present in x are decoded.
+func (lb *LazyBitmap) Intersects(x *Bitmap) (bool, error) {
+	matching, err := lb.containersMatching(x)
+	if err != nil {
+		return false, err
+	}
+	return matching.Intersects(x), nil
+}
+
+// Or computes the union between the bitmap and x and returns the result.
+// Every container is decoded.
+func (lb *LazyBitmap) Or(x *Bitmap) (*Bitmap, error) {
+	rb, err := lb.ToBitmap()
+	if err != nil {
+		return nil, err
+	}
+	return Or(rb, x), nil
+}
+
+// AndNot computes the difference between the bitmap and x and returns the
+// result. Every container is decoded.
+func (lb *LazyBitmap) AndNot(x *Bitmap) (*Bitmap, error) {
+	rb, err := lb.ToBitmap()
+	if err != nil {
+		return nil, err
+	}
+	return AndNot(rb, x), nil
+}
+
+// Iterator creates a new iterator over the integers contained in the bitmap,
+// in sorted order. Containers are decoded as the iterator reaches them;
+// AdvanceIfNeeded skips containers without decoding them. Should a container
+// fail to decode, the iteration stops there and Err reports why.
+func (lb *LazyBitmap) Iterator() *LazyIntIterator {
+	it := &LazyIntIterator{lb: lb}
+	it.init()
+	return it
+}
+
+// LazyIntIterator is the IntPeekable returned by LazyBitmap.Iterator.
+type LazyIntIterator struct {
+	lb   *LazyBitmap
+	pos  int
+	hs   uint32
+	iter shortPeekable
+	err  error
+}
+
+func (ii *LazyIntIterator) init() {
+	if ii.pos < ii.lb.size() {
+		c, err := ii.lb.getContainerAtIndex(ii.pos)
+		if err != nil {
+			ii.err = err
+			ii.pos = ii.lb.size()
+			return
+		}
+		ii.hs = uint32(ii.lb.getKeyAtIndex(ii.pos)) << 16
+		ii.iter = c.getShortIterator()
+	}
+}
+
+// Err returns the error that stopped the iteration early, if any.
+func (ii *LazyIntIterator) Err() error {
+	return ii.err
+}
+
+// HasNext returns true if there are more integers to iterate over
+func (ii *LazyIntIterator) HasNext() bool {
+	return ii.pos < ii.lb.size()
+}
+
+// Next returns the next integer
+func (ii *LazyIntIterator) Next() uint32 {
+	x := uint32(ii.iter.next()) | ii.hs
+	if !ii.iter.hasNext() {
+		ii.pos++
+		ii.init()
+	}
+	return x
+}
+
+// PeekNext peeks the next value without advancing the iterator
+func (ii *LazyIntIterator) PeekNext() uint32 {
+	return uint32(ii.iter.peekNext()) | ii.hs
+}
+
+// AdvanceIfNeeded advances as long as the next value is smaller than minval
+func (ii *LazyIntIterator) AdvanceIfNeeded(minval uint32) {
+	to := minval & 0xffff0000
+
+	if ii.HasNext() && ii.hs < to {
+		for ii.pos < ii.lb.size() && uint32(ii.lb.getKeyAtIndex(ii.pos))<<16 < to {
+			ii.pos++
+		}
+		ii.init()
+	}
+
+	if ii.HasNext() && ii.hs == to {
+		ii.iter.advanceIfNeeded(lowbits(minval))
+
+		if !ii.iter.hasNext() {
+			ii.pos++
+			ii.init()
+		}
+	}
+}
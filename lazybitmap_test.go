@@ -0,0 +1,325 @@
+package roaring
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func lazyBitmapTestData() []*Bitmap {
+	large := NewBitmap()
+	for i := uint32(0); i < 200; i++ {
+		switch i % 3 {
+		case 0:
+			large.Add(i<<16 | i)
+			large.Add(i<<16 | 0xffff)
+		case 1:
+			large.AddRange(uint64(i)<<16, uint64(i)<<16+10000)
+		case 2:
+			for j := uint32(0); j < 1<<16; j += 3 {
+				large.Add(i<<16 | j)
+			}
+		}
+	}
+	large.RunOptimize()
+
+	// fewer than noOffsetThreshold containers, with runs: no offset header
+	small := BitmapOf(1, 2, 3, 1<<20)
+	small.AddRange(1<<17, 1<<17+5000)
+	small.RunOptimize()
+
+	noRuns := BitmapOf(5, 70000, 70001, 1<<30)
+
+	return []*Bitmap{NewBitmap(), BitmapOf(42), small, noRuns, large}
+}
+
+func lazyBitmapsOf(t *testing.T, rb *Bitmap) []*LazyBitmap {
+	buf, err := rb.ToBytes()
+	require.NoError(t, err)
+	// trailing bytes after the bitmap are ignored
+	buf = append(buf, 0xde, 0xad)
+
+	fromBuffer, err := NewLazyBitmap(buf)
+	require.NoError(t, err)
+	fromReaderAt, err := NewLazyBitmapAt(bytes.NewReader(buf), int64(len(buf)))
+	require.NoError(t, err)
+	// ReaderAt reporting io.EOF along with the last bytes
+	fromEOFReaderAt, err := NewLazyBitmapAt(eofAtEndReader{bytes.NewReader(buf[:len(buf)-2])}, int64(len(buf)-2))
+	require.NoError(t, err)
+	return []*LazyBitmap{fromBuffer, fromReaderAt, fromEOFReaderAt}
+}
+
+func TestLazyBitmap(t *testing.T) {
+	other := NewBitmap()
+	other.AddRange(3<<16, 10<<16)
+	other.Add(42)
+	other.Add(1 << 30)
+
+	for _, rb := range lazyBitmapTestData() {
+		for _, lb := range lazyBitmapsOf(t, rb) {
+			require.NoError(t, lb.Validate())
+			assert.Equal(t, rb.GetCardinality(), lb.GetCardinality())
+			assert.Equal(t, rb.IsEmpty(), lb.IsEmpty())
+			full, err := lb.ToBitmap()
+			require.NoError(t, err)
+			assert.True(t, rb.Equals(full))
+
+			if !rb.IsEmpty() {
+				minimum, err := lb.Minimum()
+				require.NoError(t, err)
+				assert.Equal(t, rb.Minimum(), minimum)
+				maximum, err := lb.Maximum()
+				require.NoError(t, err)
+				assert.Equal(t, rb.Maximum(), maximum)
+			}
+			for _, x := range []uint32{0, 1, 42, 1 << 16, 1<<16 + 5, 1 << 17, 1 << 20, 4<<16 | 0xffff, 1 << 30, MaxUint32} {
+				contains, err := lb.Contains(x)
+				require.NoError(t, err)
+				assert.Equal(t, rb.Contains(x), contains, x)
+				rank, err := lb.Rank(x)
+				require.NoError(t, err)
+				assert.Equal(t, rb.Rank(x), rank, x)
+			}
+			for _, i := range []uint32{0, 1, 100, 12345, uint32(rb.GetCardinality())} {
+				expected, expectedErr := rb.Select(i)
+				actual, err := lb.Select(i)
+				assert.Equal(t, expected, actual)
+				assert.Equal(t, expectedErr == nil, err == nil)
+			}
+
+			and, err := lb.And(other)
+			require.NoError(t, err)
+			assert.True(t, And(rb, other).Equals(and))
+			or, err := lb.Or(other)
+			require.NoError(t, err)
+			assert.True(t, Or(rb, other).Equals(or))
+			andNot, err := lb.AndNot(other)
+			require.NoError(t, err)
+			assert.True(t, AndNot(rb, other).Equals(andNot))
+			andCardinality, err := lb.AndCardinality(other)
+			require.NoError(t, err)
+			assert.Equal(t, rb.AndCardinality(other), andCardinality)
+			intersects, err := lb.Intersects(other)
+			require.NoError(t, err)
+			assert.Equal(t, rb.Intersects(other), intersects)
+
+			for _, r := range [][2]uint64{{0, MaxRange}, {0, 0}, {5, 1}, {1, 70001}, {1<<16 + 5, 5<<16 + 20000}, {1 << 17, 1<<17 + 1}, {1 << 30, MaxRange + 10}} {
+				expected := rb.Clone()
+				expected.RemoveRange(0, r[0])
+				expected.RemoveRange(r[1], MaxRange)
+				actual, err := lb.Range(r[0], r[1])
+				require.NoError(t, err)
+				assert.True(t, expected.Equals(actual), r)
+			}
+
+			it := lb.Iterator()
+			assert.Equal(t, rb.ToArray(), lazyToArray(it))
+			assert.NoError(t, it.Err())
+			for _, minval := range []uint32{0, 50, 2 << 16, 5<<16 + 20000, 1 << 31} {
+				expected, actual := rb.Iterator(), lb.Iterator()
+				expected.AdvanceIfNeeded(minval)
+				actual.AdvanceIfNeeded(minval)
+				assert.Equal(t, lazyToArray(expected), lazyToArray(actual), minval)
+			}
+		}
+	}
+}
+
+func lazyToArray(it IntPeekable) []uint32 {
+	array := []uint32{}
+	for it.HasNext() {
+		x := it.PeekNext()
+		if it.Next() != x {
+			panic("PeekNext and Next disagree")
+		}
+		array = append(array, x)
+	}
+	return array
+}
+
+func TestLazyBitmapDecodesOnDemand(t *testing.T) {
+	rb := lazyBitmapTestData()[4]
+	lb := lazyBitmapsOf(t, rb)[0]
+
+	decoded := func() int {
+		n := 0
+		for i := range lb.slots {
+			if lb.slots[i].c != nil {
+				n++
+			}
+		}
+		return n
+	}
+
+	assert.Equal(t, rb.GetCardinality(), lb.GetCardinality())
+	assert.Equal(t, 0, decoded())
+	contains, err := lb.Contains(7<<16 | 100)
+	require.NoError(t, err)
+	assert.True(t, contains)
+	assert.Equal(t, 1, decoded())
+	_, err = lb.AndCardinality(BitmapOf(1<<16, 2<<16, 1<<31))
+	require.NoError(t, err)
+	assert.Equal(t, 3, decoded())
+	_, err = lb.Range(10<<16+5, 12<<16)
+	require.NoError(t, err)
+	assert.Equal(t, 5, decoded())
+}
+
+func TestLazyBitmapResultsAreCopyOnWrite(t *testing.T) {
+	rb := lazyBitmapTestData()[4]
+	buf, err := rb.ToBytes()
+	require.NoError(t, err)
+	orig := append([]byte(nil), buf...)
+
+	lb, err := NewLazyBitmap(buf)
+	require.NoError(t, err)
+	full, err := lb.ToBitmap()
+	require.NoError(t, err)
+	full.RemoveRange(0, 100<<16)
+	full.Add(123)
+	union, err := lb.Or(BitmapOf(1))
+	require.NoError(t, err)
+	union.Flip(0, 50<<16)
+	part, err := lb.Range(3<<16, 9<<16)
+	require.NoError(t, err)
+	part.Clear()
+
+	assert.Equal(t, orig, buf)
+	full, err = lb.ToBitmap()
+	require.NoError(t, err)
+	assert.True(t, rb.Equals(full))
+}
+
+func TestLazyBitmapConcurrent(t *testing.T) {
+	rb := lazyBitmapTestData()[4]
+	lb := lazyBitmapsOf(t, rb)[1]
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				x := uint32(i)<<16 | uint32(g*1000)
+				contains, err := lb.Contains(x)
+				assert.NoError(t, err)
+				assert.Equal(t, rb.Contains(x), contains)
+			}
+			full, err := lb.ToBitmap()
+			assert.NoError(t, err)
+			assert.Equal(t, rb.GetCardinality(), full.GetCardinality())
+		}()
+	}
+	wg.Wait()
+}
+
+func TestLazyBitmapCorrupted(t *testing.T) {
+	_, err := NewLazyBitmap(nil)
+	assert.ErrorIs(t, err, ErrLazyBitmapCorrupted)
+	_, err = NewLazyBitmap([]byte{1, 2, 3, 4, 5, 6, 7, 8})
+	assert.ErrorIs(t, err, ErrLazyBitmapCorrupted)
+
+	for _, rb := range lazyBitmapTestData()[1:] {
+		buf, err := rb.ToBytes()
+		require.NoError(t, err)
+		// truncated input is detected when opening, without decoding
+		_, err = NewLazyBitmap(buf[:len(buf)-1])
+		assert.Error(t, err)
+		_, err = NewLazyBitmapAt(bytes.NewReader(buf), int64(len(buf)-1))
+		assert.Error(t, err)
+	}
+}
+
+// failingReaderAt fails the reads past limit.
+type failingReaderAt struct {
+	r     *bytes.Reader
+	limit int64
+}
+
+var errLazyTestRead = errors.New("read failed")
+
+func (r failingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off+int64(len(p)) > r.limit {
+		return 0, errLazyTestRead
+	}
+	return r.r.ReadAt(p, off)
+}
+
+func TestLazyBitmapDecodeError(t *testing.T) {
+	rb := lazyBitmapTestData()[4]
+	buf, err := rb.ToBytes()
+	require.NoError(t, err)
+	// the header reads fine, the last containers do not
+	lb, err := NewLazyBitmapAt(failingReaderAt{bytes.NewReader(buf), int64(len(buf) - 1)}, int64(len(buf)))
+	require.NoError(t, err)
+
+	contains, err := lb.Contains(0)
+	require.NoError(t, err)
+	assert.True(t, contains)
+
+	x := uint32(199<<16 | 3)
+	_, err = lb.Contains(x)
+	assert.ErrorIs(t, err, errLazyTestRead)
+	_, err = lb.Rank(x)
+	assert.ErrorIs(t, err, errLazyTestRead)
+	_, err = lb.Maximum()
+	assert.ErrorIs(t, err, errLazyTestRead)
+	_, err = lb.Select(uint32(rb.GetCardinality() - 1))
+	assert.ErrorIs(t, err, errLazyTestRead)
+	_, err = lb.ToBitmap()
+	assert.ErrorIs(t, err, errLazyTestRead)
+	_, err = lb.Range(0, 5<<16)
+	assert.NoError(t, err)
+	_, err = lb.Range(0, MaxRange)
+	assert.ErrorIs(t, err, errLazyTestRead)
+	_, err = lb.And(BitmapOf(x))
+	assert.ErrorIs(t, err, errLazyTestRead)
+	_, err = lb.Or(BitmapOf(x))
+	assert.ErrorIs(t, err, errLazyTestRead)
+	assert.ErrorIs(t, lb.Validate(), errLazyTestRead)
+
+	it := lb.Iterator()
+	it.AdvanceIfNeeded(198 << 16)
+	n := len(lazyToArray(it))
+	assert.ErrorIs(t, it.Err(), errLazyTestRead)
+	assert.Equal(t, int(rb.Rank(199<<16-1)-rb.Rank(198<<16-1)), n)
+}
+
+func TestLazyBitmapInvalidContainer(t *testing.T) {
+	lb, err := NewLazyBitmap(lazyBitmapBytes(t, NewBitmap()))
+	require.NoError(t, err)
+	_, err = lb.Minimum()
+	assert.ErrorIs(t, err, ErrLazyBitmapEmpty)
+	_, err = lb.Maximum()
+	assert.ErrorIs(t, err, ErrLazyBitmapEmpty)
+
+	rb := NewBitmap()
+	rb.AddRange(0, 1000)
+	rb.RunOptimize()
+	buf := lazyBitmapBytes(t, rb)
+	// cookie, run flags and key/cardinality pair, then the number of runs
+	require.Equal(t, uint16(1), binary.LittleEndian.Uint16(buf[9:]))
+	binary.LittleEndian.PutUint16(buf[9:], 0)
+	lb, err = NewLazyBitmap(buf)
+	require.NoError(t, err)
+
+	_, err = lb.Contains(5)
+	assert.ErrorIs(t, err, ErrRunIntervalsEmpty)
+	_, err = lb.Minimum()
+	assert.ErrorIs(t, err, ErrRunIntervalsEmpty)
+	it := lb.Iterator()
+	assert.False(t, it.HasNext())
+	assert.ErrorIs(t, it.Err(), ErrRunIntervalsEmpty)
+	assert.ErrorIs(t, lb.Validate(), ErrRunIntervalsEmpty)
+}
+
+func lazyBitmapBytes(t *testing.T, rb *Bitmap) []byte {
+	buf, err := rb.ToBytes()
+	require.NoError(t, err)
+	return buf
+}
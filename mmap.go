@@ -0,0 +1,77 @@
+package roaring
+
+import "github.com/RoaringBitmap/roaring/v2/internal"
+
+// ErrMappingClosed is returned when a MappedBitmap is used after Close.
+var ErrMappingClosed = internal.ErrMappingClosed
+
+// MappedBitmap is a Bitmap backed by a memory-mapped file, which is never
+// written to.
+//
+// The containers of the bitmap point directly into the mapping, so the
+// bitmap can be queried without deserializing the file. The bitmap is only
+// reachable through View, which keeps the mapping alive while it runs and
+// hands every call its own copy-on-write view of it.
+//
+// The mapping is released by Close, after which View reports
+// ErrMappingClosed. Bitmaps derived from the mapped bitmap (e.g., via Or, And
+// or AndNot) may share its containers: call CloneCopyOnWriteContainers on
+// those that must outlive the View call.
+type MappedBitmap struct {
+	mapping *internal.Mapping[Bitmap]
+}
+
+// OpenMappedBitmap maps the file at path read-only and loads it with
+// FromBuffer. The file is expected to hold a bitmap in the portable format
+// (e.g., as written by WriteTo).
+func OpenMappedBitmap(path string) (*MappedBitmap, error) {
+	return openMapped(path, func(rb *Bitmap, buf []byte) error {
+		_, err := rb.FromBuffer(buf)
+		return err
+	})
+}
+
+func openMapped(path string, load func(rb *Bitmap, buf []byte) error) (*MappedBitmap, error) {
+	mapping, err := internal.OpenMapping(path, func(data []byte) (*Bitmap, error) {
+		rb := NewBitmap()
+		if err := load(rb, data); err != nil {
+			return nil, err
+		}
+		return rb, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MappedBitmap{mapping}, nil
+}
+
+// View calls fn with a bitmap sharing the containers of the mapped bitmap.
+// The mapping is not released while fn runs, even if Close is called
+// concurrently. The bitmap must not be retained after fn returns.
+//
+// Every call gets its own bitmap, whose shared containers are copied before
+// being modified: changes made by fn are neither seen by other calls, which
+// may run concurrently, nor written to the file.
+func (mb *MappedBitmap) View(fn func(rb *Bitmap) error) error {
+	return mb.mapping.View(func(rb *Bitmap) error {
+		return fn(rb.copyOnWriteView())
+	})
+}
+
+// copyOnWriteView returns a bitmap sharing the containers of rb, marked as
+// needing copy-on-write in the new bitmap only: rb is not written to, so
+// that concurrent View calls may each take a view.
+func (rb *Bitmap) copyOnWriteView() *Bitmap {
+	answer := NewBitmap()
+	ra := &rb.highlowcontainer
+	for i, key := range ra.keys {
+		answer.highlowcontainer.appendContainer(key, ra.containers[i], true)
+	}
+	return answer
+}
+
+// Close releases the mapping. It waits for running View calls to return.
+// Calling Close more than once returns ErrMappingClosed.
+func (mb *MappedBitmap) Close() error {
+	return mb.mapping.Close()
+}
@@ -0,0 +1,72 @@
+package roaring
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMappedBitmap(t *testing.T) {
+	rb := BitmapOf(1, 2, 3, 1000, 1<<20)
+	rb.AddRange(1<<24, 1<<24+100000)
+	rb.RunOptimize()
+	buf, err := rb.ToBytes()
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "bitmap.bin")
+	require.NoError(t, os.WriteFile(path, buf, 0o600))
+
+	mb, err := OpenMappedBitmap(path)
+	require.NoError(t, err)
+
+	var derived *Bitmap
+	assert.NoError(t, mb.View(func(mapped *Bitmap) error {
+		assert.True(t, rb.Equals(mapped))
+
+		// mutations must copy the containers rather than write to the mapping
+		mapped.Add(7)
+		mapped.RemoveRange(1<<24, 1<<24+10)
+		assert.True(t, mapped.Contains(7))
+		assert.False(t, mapped.Contains(1<<24))
+
+		derived = Or(mapped, BitmapOf(8))
+		derived.CloneCopyOnWriteContainers()
+		return nil
+	}))
+	// the changes made by a View call stay in it
+	assert.NoError(t, mb.View(func(mapped *Bitmap) error {
+		assert.True(t, rb.Equals(mapped))
+		return nil
+	}))
+
+	require.NoError(t, mb.Close())
+	assert.True(t, derived.Contains(1<<24+10))
+	assert.Equal(t, rb.GetCardinality()-10+2, derived.GetCardinality())
+
+	assert.ErrorIs(t, mb.View(func(*Bitmap) error { return nil }), ErrMappingClosed)
+	assert.ErrorIs(t, mb.Close(), ErrMappingClosed)
+
+	reloaded, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, buf, reloaded)
+}
+
+func TestMappedBitmapErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := OpenMappedBitmap(filepath.Join(dir, "missing.bin"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	path := filepath.Join(dir, "garbage.bin")
+	require.NoError(t, os.WriteFile(path, []byte("not a bitmap"), 0o600))
+	_, err = OpenMappedBitmap(path)
+	assert.Error(t, err)
+
+	empty := filepath.Join(dir, "empty.bin")
+	require.NoError(t, os.WriteFile(empty, nil, 0o600))
+	_, err = OpenMappedBitmap(empty)
+	assert.Error(t, err)
+}
@@ -0,0 +1,332 @@
+package roaring
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+/* MULTI-BITMAP FILE FORMAT DESCRIPTION
+ *
+ * <header>   uint32_t multiBitmapMagic, uint32_t multiBitmapVersion
+ * <bitmaps>  every bitmap, back to back, either in the portable format
+ *            (WriteTo) or in the frozen format (WriteFrozenTo). Frozen
+ *            bitmaps are preceded by zero padding so that they start at a
+ *            multiple of 32 bytes from the beginning of the file.
+ * <index>    for every bitmap, in increasing key order:
+ *              uint32_t key length, key bytes,
+ *              uint8_t  format (multiBitmapPortable or multiBitmapFrozen),
+ *              uint64_t offset from the beginning of the file,
+ *              uint64_t length in bytes
+ * <footer>   uint64_t offset of <index>, uint64_t number of bitmaps,
+ *            uint32_t multiBitmapMagic
+ *
+ * All integers are little endian. The index only lists offsets, so a reader
+ * loads the footer and the index, and then any single bitmap on demand.
+ */
+const (
+	multiBitmapMagic   = 0x464d4252 // "RBMF" in little endian
+	multiBitmapVersion = 1
+
+	multiBitmapHeaderSize = 8
+	multiBitmapFooterSize = 20
+
+	multiBitmapPortable = 0
+	multiBitmapFrozen   = 1
+)
+
+var (
+	// ErrMultiBitmapInvalidMagic is returned when the input is not a multi-bitmap file.
+	ErrMultiBitmapInvalidMagic = errors.New("input is not a multi-bitmap file")
+	// ErrMultiBitmapCorrupted is returned when the index of a multi-bitmap file is inconsistent.
+	ErrMultiBitmapCorrupted = errors.New("corrupted multi-bitmap index")
+	// ErrMultiBitmapDuplicateKey is returned when a key is written twice.
+	ErrMultiBitmapDuplicateKey = errors.New("duplicate key in multi-bitmap file")
+	// ErrMultiBitmapKeyNotFound is returned when a key is not present in a multi-bitmap file.
+	ErrMultiBitmapKeyNotFound = errors.New("key not found in multi-bitmap file")
+	// ErrMultiBitmapWriterClosed is returned when a bitmap is added after Close.
+	ErrMultiBitmapWriterClosed = errors.New("multi-bitmap writer is closed")
+)
+
+type multiBitmapEntry struct {
+	key    string
+	format uint8
+	offset uint64
+	length uint64
+}
+
+// MultiBitmapWriter streams many bitmaps, each identified by a distinct
+// key, into a single file that can be read back with MultiBitmapReader.
+// Bitmaps are written as soon as they are added; only their keys and
+// offsets are kept in memory until Close writes the index.
+type MultiBitmapWriter struct {
+	w       io.Writer
+	offset  uint64
+	entries []multiBitmapEntry
+	seen    map[string]struct{}
+	err     error
+	closed  bool
+}
+
+// NewMultiBitmapWriter creates a writer and writes the file header to w.
+// Errors are reported by the first call to Add or Close.
+func NewMultiBitmapWriter(w io.Writer) *MultiBitmapWriter {
+	mw := &MultiBitmapWriter{w: w, seen: make(map[string]struct{})}
+	var header [multiBitmapHeaderSize]byte
+	binary.LittleEndian.PutUint32(header[0:], multiBitmapMagic)
+	binary.LittleEndian.PutUint32(header[4:], multiBitmapVersion)
+	mw.write(header[:])
+	return mw
+}
+
+func (mw *MultiBitmapWriter) write(p []byte) {
+	if mw.err != nil {
+		return
+	}
+	n, err := mw.w.Write(p)
+	mw.offset += uint64(n)
+	mw.err = err
+}
+
+func (mw *MultiBitmapWriter) add(key string, format uint8, writeTo func(io.Writer) (int64, error)) error {
+	if mw.closed {
+		return ErrMultiBitmapWriterClosed
+	}
+	if mw.err != nil {
+		return mw.err
+	}
+	if _, ok := mw.seen[key]; ok {
+		return fmt.Errorf("%w: %q", ErrMultiBitmapDuplicateKey, key)
+	}
+	if format == multiBitmapFrozen {
+		var padding [32]byte
+		mw.write(padding[:(32-mw.offset%32)%32])
+		if mw.err != nil {
+			return mw.err
+		}
+	}
+	start := mw.offset
+	n, err := writeTo(mw.w)
+	mw.offset += uint64(n)
+	if err != nil {
+		mw.err = err
+		return err
+	}
+	mw.seen[key] = struct{}{}
+	mw.entries = append(mw.entries, multiBitmapEntry{key: key, format: format, offset: start, length: uint64(n)})
+	return nil
+}
+
+// Add writes rb under key in the portable format (see WriteTo).
+// Keys may be added in any order but must be distinct.
+func (mw *MultiBitmapWriter) Add(key string, rb *Bitmap) error {
+	return mw.add(key, multiBitmapPortable, rb.WriteTo)
+}
+
+// Close writes the index and the footer. It does not close the underlying writer.
+func (mw *MultiBitmapWriter) Close() error {
+	if mw.closed {
+		return ErrMultiBitmapWriterClosed
+	}
+	mw.closed = true
+	if mw.err != nil {
+		return mw.err
+	}
+
+	sort.Slice(mw.entries, func(i, j int) bool { return mw.entries[i].key < mw.entries[j].key })
+	indexOffset := mw.offset
+	var buf []byte
+	for _, e := range mw.entries {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(e.key)))
+		buf = append(buf, e.key...)
+		buf = append(buf, e.format)
+		buf = binary.LittleEndian.AppendUint64(buf, e.offset)
+		buf = binary.LittleEndian.AppendUint64(buf, e.length)
+	}
+	buf = binary.LittleEndian.AppendUint64(buf, indexOffset)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(mw.entries)))
+	buf = binary.LittleEndian.AppendUint32(buf, multiBitmapMagic)
+	mw.write(buf)
+	return mw.err
+}
+
+// MultiBitmapReader gives random access by key to the bitmaps of a file
+// written by MultiBitmapWriter. Opening the reader only loads the index;
+// every bitmap is read when it is requested.
+//
+// A MultiBitmapReader is safe for concurrent use as long as the
+// underlying io.ReaderAt is.
+type MultiBitmapReader struct {
+	r       io.ReaderAt
+	data    []byte
+	entries []multiBitmapEntry
+}
+
+// NewMultiBitmapReader opens the multi-bitmap file held in data. The bitmaps
+// returned by the reader point into data (see FromBuffer and FrozenView), so
+// data must not be modified and must remain available while they are in use.
+// data may come from a memory-mapped file.
+func NewMultiBitmapReader(data []byte) (*MultiBitmapReader, error) {
+	mr := &MultiBitmapReader{data: data}
+	if err := mr.readIndex(uint64(len(data))); err != nil {
+		return nil, err
+	}
+	return mr, nil
+}
+
+// NewMultiBitmapReaderAt opens a multi-bitmap file of the given size through
+// r, reading only its footer and index. Every requested bitmap is read from
+// r into a freshly allocated buffer.
+func NewMultiBitmapReaderAt(r io.ReaderAt, size int64) (*MultiBitmapReader, error) {
+	if size < 0 {
+		return nil, ErrMultiBitmapCorrupted
+	}
+	mr := &MultiBitmapReader{r: r}
+	if err := mr.readIndex(uint64(size)); err != nil {
+		return nil, err
+	}
+	return mr, nil
+}
+
+// section returns the bytes in [offset, offset+length).
+// The caller has checked the range against the size of the file.
+func (mr *MultiBitmapReader) section(offset, length uint64) ([]byte, error) {
+	if mr.data != nil {
+		return mr.data[offset : offset+length], nil
+	}
+	buf := make([]byte, length)
+	// ReadAt may report io.EOF along with a full read at the end of the input
+	if n, err := mr.r.ReadAt(buf, int64(offset)); err != nil && (err != io.EOF || uint64(n) != length) {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func (mr *MultiBitmapReader) readIndex(size uint64) error {
+	if size < multiBitmapHeaderSize+multiBitmapFooterSize {
+		return ErrMultiBitmapInvalidMagic
+	}
+	header, err := mr.section(0, multiBitmapHeaderSize)
+	if err != nil {
+		return err
+	}
+	if binary.LittleEndian.Uint32(header) != multiBitmapMagic {
+		return ErrMultiBitmapInvalidMagic
+	}
+	if version := binary.LittleEndian.Uint32(header[4:]); version != multiBitmapVersion {
+		return fmt.Errorf("unsupported multi-bitmap file version %d", version)
+	}
+
+	footer, err := mr.section(size-multiBitmapFooterSize, multiBitmapFooterSize)
+	if err != nil {
+		return err
+	}
+	if binary.LittleEndian.Uint32(footer[16:]) != multiBitmapMagic {
+		return ErrMultiBitmapInvalidMagic
+	}
+	indexOffset := binary.LittleEndian.Uint64(footer)
+	count := binary.LittleEndian.Uint64(footer[8:])
+	indexEnd := size - multiBitmapFooterSize
+	if indexOffset < multiBitmapHeaderSize || indexOffset > indexEnd {
+		return ErrMultiBitmapCorrupted
+	}
+	// every index entry takes at least 21 bytes
+	if count > (indexEnd-indexOffset)/21 {
+		return ErrMultiBitmapCorrupted
+	}
+
+	index, err := mr.section(indexOffset, indexEnd-indexOffset)
+	if err != nil {
+		return err
+	}
+	entries := make([]multiBitmapEntry, count)
+	for i := range entries {
+		if len(index) < 4 {
+			return ErrMultiBitmapCorrupted
+		}
+		keyLen := uint64(binary.LittleEndian.Uint32(index))
+		index = index[4:]
+		if uint64(len(index)) < keyLen+17 {
+			return ErrMultiBitmapCorrupted
+		}
+		e := &entries[i]
+		e.key = string(index[:keyLen])
+		index = index[keyLen:]
+		e.format = index[0]
+		e.offset = binary.LittleEndian.Uint64(index[1:])
+		e.length = binary.LittleEndian.Uint64(index[9:])
+		index = index[17:]
+
+		if e.format != multiBitmapPortable && e.format != multiBitmapFrozen {
+			return ErrMultiBitmapCorrupted
+		}
+		if e.offset < multiBitmapHeaderSize || e.offset > indexOffset || e.length > indexOffset-e.offset {
+			return ErrMultiBitmapCorrupted
+		}
+		if i > 0 && entries[i-1].key >= e.key {
+			return ErrMultiBitmapCorrupted
+		}
+	}
+	if len(index) != 0 {
+		return ErrMultiBitmapCorrupted
+	}
+	mr.entries = entries
+	return nil
+}
+
+// Len returns the number of bitmaps in the file.
+func (mr *MultiBitmapReader) Len() int {
+	return len(mr.entries)
+}
+
+// Keys returns the keys of all bitmaps in the file, in increasing order.
+func (mr *MultiBitmapReader) Keys() []string {
+	keys := make([]string, len(mr.entries))
+	for i, e := range mr.entries {
+		keys[i] = e.key
+	}
+	return keys
+}
+
+func (mr *MultiBitmapReader) find(key string) (multiBitmapEntry, bool) {
+	i := sort.Search(len(mr.entries), func(i int) bool { return mr.entries[i].key >= key })
+	if i < len(mr.entries) && mr.entries[i].key == key {
+		return mr.entries[i], true
+	}
+	return multiBitmapEntry{}, false
+}
+
+// Has returns true if the file contains a bitmap for key.
+func (mr *MultiBitmapReader) Has(key string) bool {
+	_, ok := mr.find(key)
+	return ok
+}
+
+// Bitmap loads the bitmap stored under key, with FromBuffer or FrozenView
+// depending on how it was written. It returns ErrMultiBitmapKeyNotFound if
+// there is no such bitmap.
+//
+// As with FromBuffer, the resulting bitmap relies on copy-on-write: it may
+// be modified, but its copy-on-write status must not be changed.
+func (mr *MultiBitmapReader) Bitmap(key string) (*Bitmap, error) {
+	e, ok := mr.find(key)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrMultiBitmapKeyNotFound, key)
+	}
+	buf, err := mr.section(e.offset, e.length)
+	if err != nil {
+		return nil, err
+	}
+	rb := NewBitmap()
+	if e.format == multiBitmapFrozen {
+		err = frozenViewOf(rb, buf)
+	} else {
+		_, err = rb.FromBuffer(buf)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not load bitmap %q: %w", key, err)
+	}
+	return rb, nil
+}
@@ -0,0 +1,136 @@
+package roaring
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// eofAtEndReader reports io.EOF along with the reads reaching the end of the
+// input, as io.ReaderAt allows.
+type eofAtEndReader struct {
+	r *bytes.Reader
+}
+
+func (r eofAtEndReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.r.ReadAt(p, off)
+	if err == nil && off+int64(n) == r.r.Size() {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func multiBitmapTestData() map[string]*Bitmap {
+	bitmaps := make(map[string]*Bitmap)
+	for i := 0; i < 50; i++ {
+		rb := NewBitmap()
+		for j := uint32(0); j < uint32(i*100); j += uint32(i%7 + 1) {
+			rb.Add(j * uint32(i+1))
+		}
+		if i%5 == 0 {
+			rb.AddRange(1<<20, 1<<20+uint64(i)*1000)
+			rb.RunOptimize()
+		}
+		bitmaps[fmt.Sprintf("term-%d", i)] = rb
+	}
+	return bitmaps
+}
+
+func TestMultiBitmapRoundTrip(t *testing.T) {
+	bitmaps := multiBitmapTestData()
+
+	var buf bytes.Buffer
+	mw := NewMultiBitmapWriter(&buf)
+	for key, rb := range bitmaps {
+		require.NoError(t, mw.Add(key, rb))
+	}
+	require.NoError(t, mw.Close())
+
+	inMemory, err := NewMultiBitmapReader(buf.Bytes())
+	require.NoError(t, err)
+	readerAt, err := NewMultiBitmapReaderAt(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	eofReaderAt, err := NewMultiBitmapReaderAt(eofAtEndReader{bytes.NewReader(buf.Bytes())}, int64(buf.Len()))
+	require.NoError(t, err)
+
+	for _, mr := range []*MultiBitmapReader{inMemory, readerAt, eofReaderAt} {
+		assert.Equal(t, len(bitmaps), mr.Len())
+		keys := mr.Keys()
+		assert.IsIncreasing(t, keys)
+		for _, key := range keys {
+			assert.True(t, mr.Has(key))
+			rb, err := mr.Bitmap(key)
+			require.NoError(t, err)
+			assert.True(t, bitmaps[key].Equals(rb), key)
+		}
+
+		assert.False(t, mr.Has("missing"))
+		_, err := mr.Bitmap("missing")
+		assert.ErrorIs(t, err, ErrMultiBitmapKeyNotFound)
+	}
+
+	// bitmaps read from a buffer are copy-on-write
+	orig := append([]byte(nil), buf.Bytes()...)
+	rb, err := inMemory.Bitmap("term-10")
+	require.NoError(t, err)
+	rb.Add(12345678)
+	rb.RemoveRange(0, 1<<21)
+	assert.Equal(t, orig, buf.Bytes())
+}
+
+func TestMultiBitmapEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, NewMultiBitmapWriter(&buf).Close())
+
+	mr, err := NewMultiBitmapReader(buf.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, 0, mr.Len())
+	assert.Empty(t, mr.Keys())
+}
+
+func TestMultiBitmapWriterErrors(t *testing.T) {
+	var buf bytes.Buffer
+	mw := NewMultiBitmapWriter(&buf)
+	require.NoError(t, mw.Add("a", BitmapOf(1)))
+	assert.ErrorIs(t, mw.Add("a", BitmapOf(2)), ErrMultiBitmapDuplicateKey)
+	require.NoError(t, mw.Close())
+	assert.ErrorIs(t, mw.Add("b", BitmapOf(2)), ErrMultiBitmapWriterClosed)
+	assert.ErrorIs(t, mw.Close(), ErrMultiBitmapWriterClosed)
+}
+
+func TestMultiBitmapReaderErrors(t *testing.T) {
+	var buf bytes.Buffer
+	mw := NewMultiBitmapWriter(&buf)
+	require.NoError(t, mw.Add("a", BitmapOf(1, 2, 3)))
+	require.NoError(t, mw.Add("b", BitmapOf(4, 5, 6)))
+	require.NoError(t, mw.Close())
+	data := buf.Bytes()
+
+	_, err := NewMultiBitmapReader(data[:10])
+	assert.ErrorIs(t, err, ErrMultiBitmapInvalidMagic)
+
+	badMagic := append([]byte(nil), data...)
+	badMagic[0] ^= 0xff
+	_, err = NewMultiBitmapReader(badMagic)
+	assert.ErrorIs(t, err, ErrMultiBitmapInvalidMagic)
+
+	badCount := append([]byte(nil), data...)
+	badCount[len(badCount)-12]++
+	_, err = NewMultiBitmapReader(badCount)
+	assert.ErrorIs(t, err, ErrMultiBitmapCorrupted)
+
+	badIndexOffset := append([]byte(nil), data...)
+	badIndexOffset[len(badIndexOffset)-20] = 0xff
+	badIndexOffset[len(badIndexOffset)-19] = 0xff
+	_, err = NewMultiBitmapReader(badIndexOffset)
+	assert.ErrorIs(t, err, ErrMultiBitmapCorrupted)
+
+	truncated := append([]byte(nil), data[:len(data)-multiBitmapFooterSize-1]...)
+	truncated = append(truncated, data[len(data)-multiBitmapFooterSize:]...)
+	_, err = NewMultiBitmapReader(truncated)
+	assert.ErrorIs(t, err, ErrMultiBitmapCorrupted)
+}
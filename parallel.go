@@ -2,6 +2,7 @@ package roaring
 
 import (
 	"container/heap"
+	"context"
 	"fmt"
 	"runtime"
 	"sync"
@@ -18,13 +19,11 @@ type bitmapContainerKey struct {
 type multipleContainers struct {
 	key        uint16
 	containers []container
-	idx        int
 }
 
 type keyedContainer struct {
 	key       uint16
 	container container
-	idx       int
 }
 
 type bitmapContainerHeap []bitmapContainerKey
@@ -88,7 +87,6 @@ func (h *bitmapContainerHeap) Next(containers []container) multipleContainers {
 	return multipleContainers{
 		key,
 		containers,
-		-1,
 	}
 }
 
@@ -111,6 +109,20 @@ func newBitmapContainerHeap(bitmaps ...*Bitmap) bitmapContainerHeap {
 	return h
 }
 
+// newBitmapContainerHeapFrom is newBitmapContainerHeap skipping the keys
+// lower than start.
+func newBitmapContainerHeapFrom(start uint16, bitmaps ...*Bitmap) bitmapContainerHeap {
+	h := make(bitmapContainerHeap, 0, len(bitmaps))
+	for _, bitmap := range bitmaps {
+		ra := &bitmap.highlowcontainer
+		if idx := ra.advanceUntil(start, -1); idx < ra.size() {
+			h = append(h, bitmapContainerKey{ra.keys[idx], idx, bitmap})
+		}
+	}
+	heap.Init(&h)
+	return h
+}
+
 func repairAfterLazy(c container) container {
 	switch t := c.(type) {
 	case *bitmapContainer:
@@ -140,41 +152,77 @@ func toBitmapContainer(c container) container {
 	return c
 }
 
-func appenderRoutine(bitmapChan chan<- *Bitmap, resultChan <-chan keyedContainer, expectedKeysChan <-chan int) {
-	expectedKeys := -1
-	appendedKeys := 0
-	var keys []uint16
-	var containers []container
-	for appendedKeys != expectedKeys {
-		select {
-		case item := <-resultChan:
-			if len(keys) <= item.idx {
-				keys = append(keys, make([]uint16, item.idx-len(keys)+1)...)
-				containers = append(containers, make([]container, item.idx-len(containers)+1)...)
+// parAggregate aggregates, on the pool, the containers that h yields for
+// every key held by at least minCount bitmaps, and assembles the results into
+// a bitmap. The containers are handed to parallelism tasks, each of which
+// calls newAggregate once, so that the aggregation it returns can keep scratch
+// space across keys; an aggregation returns nil for an empty result. When
+// ctx is done, no more containers are handed to the tasks, the tasks skip
+// those already handed to them, and ctx.Err() is returned once they are done.
+func (p *Pool) parAggregate(ctx context.Context, parallelism int, h *bitmapContainerHeap, minCount int,
+	newAggregate func() func(containers []container) container) (*Bitmap, error) {
+
+	type input struct {
+		containers []container
+		result     *keyedContainer
+	}
+	inputChan := make(chan input, 128)
+
+	var wg sync.WaitGroup
+	aggregateFunc := func() {
+		defer wg.Done()
+		aggregate := newAggregate()
+		for in := range inputChan {
+			if ctx.Err() == nil {
+				in.result.container = aggregate(in.containers)
 			}
-			keys[item.idx] = item.key
-			containers[item.idx] = item.container
+		}
+	}
+
+	parallelism = p.parallelism(parallelism)
+	wg.Add(parallelism)
+	for i := 0; i < parallelism; i++ {
+		p.Go(aggregateFunc)
+	}
 
-			appendedKeys++
-		case msg := <-expectedKeysChan:
-			expectedKeys = msg
+	var results []*keyedContainer
+dispatch:
+	for h.Len() > 0 {
+		ck := h.Next(make([]container, 0, 4))
+		if len(ck.containers) < minCount {
+			continue
+		}
+		result := &keyedContainer{key: ck.key}
+		results = append(results, result)
+		if len(ck.containers) == 1 {
+			result.container = ck.containers[0]
+			continue
+		}
+		select {
+		case inputChan <- input{ck.containers, result}:
+		case <-ctx.Done():
+			break dispatch
 		}
 	}
+	close(inputChan)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	answer := &Bitmap{
 		roaringArray{
-			make([]uint16, 0, expectedKeys),
-			make([]container, 0, expectedKeys),
-			make([]bool, 0, expectedKeys),
-			false,
+			keys:            make([]uint16, 0, len(results)),
+			containers:      make([]container, 0, len(results)),
+			needCopyOnWrite: make([]bool, 0, len(results)),
 		},
 	}
-	for i := range keys {
-		if containers[i] != nil { // in case a resulting container was empty, see ParAnd function
-			answer.highlowcontainer.appendContainer(keys[i], containers[i], false)
+	for _, result := range results {
+		if result.container != nil { // in case a resulting container was empty, see ParAnd function
+			answer.highlowcontainer.appendContainer(result.key, result.container, false)
 		}
 	}
-
-	bitmapChan <- answer
+	return answer, nil
 }
 
 // ParHeapOr computes the union (OR) of all provided bitmaps in parallel,
@@ -182,163 +230,114 @@ func appenderRoutine(bitmapChan chan<- *Bitmap, resultChan <-chan keyedContainer
 // (if it is set to 0, a default number of workers is chosen)
 // ParHeapOr uses a heap to compute the union. For rare cases it might be faster than ParOr
 func ParHeapOr(parallelism int, bitmaps ...*Bitmap) *Bitmap {
+	bitmap, _ := ParHeapOrContext(context.Background(), parallelism, bitmaps...)
+	return bitmap
+}
+
+// ParHeapOrContext is ParHeapOr stopping early when ctx is done: no more
+// containers are handed to the workers, the workers skip those already handed
+// to them, and ctx.Err() is returned once they have all returned.
+func ParHeapOrContext(ctx context.Context, parallelism int, bitmaps ...*Bitmap) (*Bitmap, error) {
+	return DefaultPool().ParHeapOr(ctx, parallelism, bitmaps...)
+}
+
+// ParHeapOr is ParHeapOrContext running on the workers of the pool.
+func (p *Pool) ParHeapOr(ctx context.Context, parallelism int, bitmaps ...*Bitmap) (*Bitmap, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	bitmapCount := len(bitmaps)
 	if bitmapCount == 0 {
-		return NewBitmap()
+		return NewBitmap(), nil
 	} else if bitmapCount == 1 {
-		return bitmaps[0].Clone()
-	}
-
-	if parallelism == 0 {
-		parallelism = defaultWorkerCount
+		return bitmaps[0].Clone(), nil
 	}
 
 	h := newBitmapContainerHeap(bitmaps...)
-
-	bitmapChan := make(chan *Bitmap)
-	inputChan := make(chan multipleContainers, 128)
-	resultChan := make(chan keyedContainer, 32)
-	expectedKeysChan := make(chan int)
-
-	pool := sync.Pool{
-		New: func() interface{} {
-			return make([]container, 0, len(bitmaps))
-		},
-	}
-
-	orFunc := func() {
-		// Assumes only structs with >=2 containers are passed
-		for input := range inputChan {
-			c := toBitmapContainer(input.containers[0]).lazyOR(input.containers[1])
-			for _, next := range input.containers[2:] {
+	return p.parAggregate(ctx, parallelism, &h, 1, func() func([]container) container {
+		return func(containers []container) container {
+			c := toBitmapContainer(containers[0]).lazyOR(containers[1])
+			for _, next := range containers[2:] {
 				c = c.lazyIOR(next)
 			}
-			c = repairAfterLazy(c)
-			kx := keyedContainer{
-				input.key,
-				c,
-				input.idx,
-			}
-			resultChan <- kx
-			pool.Put(input.containers[:0])
+			return repairAfterLazy(c)
 		}
-	}
-
-	go appenderRoutine(bitmapChan, resultChan, expectedKeysChan)
-
-	for i := 0; i < parallelism; i++ {
-		go orFunc()
-	}
-
-	idx := 0
-	for h.Len() > 0 {
-		ck := h.Next(pool.Get().([]container))
-		if len(ck.containers) == 1 {
-			resultChan <- keyedContainer{
-				ck.key,
-				ck.containers[0],
-				idx,
-			}
-			pool.Put(ck.containers[:0])
-		} else {
-			ck.idx = idx
-			inputChan <- ck
-		}
-		idx++
-	}
-	expectedKeysChan <- idx
-
-	bitmap := <-bitmapChan
-
-	close(inputChan)
-	close(resultChan)
-	close(expectedKeysChan)
-
-	return bitmap
+	})
 }
 
 // ParAnd computes the intersection (AND) of all provided bitmaps in parallel,
 // where the parameter "parallelism" determines how many workers are to be used
 // (if it is set to 0, a default number of workers is chosen)
 func ParAnd(parallelism int, bitmaps ...*Bitmap) *Bitmap {
+	bitmap, _ := ParAndContext(context.Background(), parallelism, bitmaps...)
+	return bitmap
+}
+
+// ParAndContext is ParAnd stopping early when ctx is done, see
+// ParHeapOrContext.
+func ParAndContext(ctx context.Context, parallelism int, bitmaps ...*Bitmap) (*Bitmap, error) {
+	return DefaultPool().ParAnd(ctx, parallelism, bitmaps...)
+}
+
+// ParAnd is ParAndContext running on the workers of the pool.
+func (p *Pool) ParAnd(ctx context.Context, parallelism int, bitmaps ...*Bitmap) (*Bitmap, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	bitmapCount := len(bitmaps)
 	if bitmapCount == 0 {
-		return NewBitmap()
+		return NewBitmap(), nil
 	} else if bitmapCount == 1 {
-		return bitmaps[0].Clone()
-	}
-
-	if parallelism == 0 {
-		parallelism = defaultWorkerCount
+		return bitmaps[0].Clone(), nil
 	}
 
 	h := newBitmapContainerHeap(bitmaps...)
-
-	bitmapChan := make(chan *Bitmap)
-	inputChan := make(chan multipleContainers, 128)
-	resultChan := make(chan keyedContainer, 32)
-	expectedKeysChan := make(chan int)
-
-	andFunc := func() {
-		// Assumes only structs with >=2 containers are passed
-		for input := range inputChan {
-			c := input.containers[0].and(input.containers[1])
-			for _, next := range input.containers[2:] {
+	return p.parAggregate(ctx, parallelism, &h, bitmapCount, func() func([]container) container {
+		return func(containers []container) container {
+			c := containers[0].and(containers[1])
+			for _, next := range containers[2:] {
 				if c.isEmpty() {
 					break
 				}
 				c = c.iand(next)
 			}
 
-			// Send a nil explicitly if the result of the intersection is an empty container
+			// Return nil explicitly if the result of the intersection is an empty container
 			if c.isEmpty() {
-				c = nil
-			}
-
-			kx := keyedContainer{
-				input.key,
-				c,
-				input.idx,
+				return nil
 			}
-			resultChan <- kx
+			return c
 		}
-	}
-
-	go appenderRoutine(bitmapChan, resultChan, expectedKeysChan)
-
-	for i := 0; i < parallelism; i++ {
-		go andFunc()
-	}
-
-	idx := 0
-	for h.Len() > 0 {
-		ck := h.Next(make([]container, 0, 4))
-		if len(ck.containers) == bitmapCount {
-			ck.idx = idx
-			inputChan <- ck
-			idx++
-		}
-	}
-	expectedKeysChan <- idx
-
-	bitmap := <-bitmapChan
-
-	close(inputChan)
-	close(resultChan)
-	close(expectedKeysChan)
-
-	return bitmap
+	})
 }
 
 // ParOr computes the union (OR) of all provided bitmaps in parallel,
 // where the parameter "parallelism" determines how many workers are to be used
 // (if it is set to 0, a default number of workers is chosen)
 func ParOr(parallelism int, bitmaps ...*Bitmap) *Bitmap {
+	bitmap, _ := ParOrContext(context.Background(), parallelism, bitmaps...)
+	return bitmap
+}
+
+// ParOrContext is ParOr stopping early when ctx is done: no more key ranges
+// are handed to the workers, the workers skip those already handed to them,
+// and ctx.Err() is returned once they have all returned.
+func ParOrContext(ctx context.Context, parallelism int, bitmaps ...*Bitmap) (*Bitmap, error) {
+	return DefaultPool().ParOr(ctx, parallelism, bitmaps...)
+}
+
+// ParOr is ParOrContext running on the workers of the pool.
+func (p *Pool) ParOr(ctx context.Context, parallelism int, bitmaps ...*Bitmap) (*Bitmap, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	var lKey uint16 = MaxUint16
 	var hKey uint16
 
-	bitmapsFiltered := bitmaps[:0]
+	bitmapsFiltered := make([]*Bitmap, 0, len(bitmaps))
 	for _, b := range bitmaps {
 		if !b.IsEmpty() {
 			bitmapsFiltered = append(bitmapsFiltered, b)
@@ -352,21 +351,40 @@ func ParOr(parallelism int, bitmaps ...*Bitmap) *Bitmap {
 	}
 
 	if lKey == MaxUint16 && hKey == 0 {
-		return New()
+		return New(), nil
 	} else if len(bitmaps) == 1 {
-		return bitmaps[0].Clone()
+		return bitmaps[0].Clone(), nil
 	}
 
-	keyRange := int(hKey) - int(lKey) + 1
-	if keyRange == 1 {
+	if lKey == hKey {
 		// revert to FastOr. Since the key range is 0
 		// no container-level aggregation parallelism is achievable
-		return FastOr(bitmaps...)
+		return FastOr(bitmaps...), nil
 	}
 
-	if parallelism == 0 {
-		parallelism = defaultWorkerCount
-	}
+	return p.parOnRanges(ctx, parallelism, lKey, hKey, func(start, end uint16) *roaringArray {
+		ra := lazyOrOnRange(&bitmaps[0].highlowcontainer, &bitmaps[1].highlowcontainer, start, end)
+		for _, b := range bitmaps[2:] {
+			ra = lazyIOrOnRange(ra, &b.highlowcontainer, start, end)
+		}
+
+		for i, c := range ra.containers {
+			ra.containers[i] = repairAfterLazy(c)
+		}
+		return ra
+	})
+}
+
+// parOnRanges cuts the keys from lKey to hKey into ranges, has the tasks of
+// the pool compute the containers of every range with onRange, and
+// concatenates them into a bitmap. When ctx is done, no more ranges are handed
+// to the tasks, the tasks skip those already handed to them, and ctx.Err() is
+// returned once they are done.
+func (p *Pool) parOnRanges(ctx context.Context, parallelism int, lKey, hKey uint16,
+	onRange func(start, end uint16) *roaringArray) (*Bitmap, error) {
+
+	keyRange := int(hKey) - int(lKey) + 1
+	parallelism = p.parallelism(parallelism)
 
 	var chunkSize int
 	var chunkCount int
@@ -386,48 +404,42 @@ func ParOr(parallelism int, bitmaps ...*Bitmap) *Bitmap {
 	chunks := make([]*roaringArray, chunkCount)
 
 	chunkSpecChan := make(chan parChunkSpec, minOfInt(maxOfInt(64, 2*parallelism), chunkCount))
-	chunkChan := make(chan parChunk, minOfInt(32, chunkCount))
 
-	orFunc := func() {
+	var wg sync.WaitGroup
+	rangeFunc := func() {
+		defer wg.Done()
 		for spec := range chunkSpecChan {
-			ra := lazyOrOnRange(&bitmaps[0].highlowcontainer, &bitmaps[1].highlowcontainer, spec.start, spec.end)
-			for _, b := range bitmaps[2:] {
-				ra = lazyIOrOnRange(ra, &b.highlowcontainer, spec.start, spec.end)
-			}
-
-			for i, c := range ra.containers {
-				ra.containers[i] = repairAfterLazy(c)
+			if ctx.Err() != nil {
+				continue
 			}
-
-			chunkChan <- parChunk{ra, spec.idx}
+			chunks[spec.idx] = onRange(spec.start, spec.end)
 		}
 	}
 
+	wg.Add(parallelism)
 	for i := 0; i < parallelism; i++ {
-		go orFunc()
+		p.Go(rangeFunc)
 	}
 
-	go func() {
-		for i := 0; i < chunkCount; i++ {
-			spec := parChunkSpec{
-				start: uint16(int(lKey) + i*chunkSize),
-				end:   uint16(minOfInt(int(lKey)+(i+1)*chunkSize-1, int(hKey))),
-				idx:   i,
-			}
-			chunkSpecChan <- spec
+dispatch:
+	for i := 0; i < chunkCount; i++ {
+		spec := parChunkSpec{
+			start: uint16(int(lKey) + i*chunkSize),
+			end:   uint16(minOfInt(int(lKey)+(i+1)*chunkSize-1, int(hKey))),
+			idx:   i,
 		}
-	}()
-
-	chunksRemaining := chunkCount
-	for chunk := range chunkChan {
-		chunks[chunk.idx] = chunk.ra
-		chunksRemaining--
-		if chunksRemaining == 0 {
-			break
+		select {
+		case chunkSpecChan <- spec:
+		case <-ctx.Done():
+			break dispatch
 		}
 	}
-	close(chunkChan)
 	close(chunkSpecChan)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	containerCount := 0
 	for _, chunk := range chunks {
@@ -450,22 +462,253 @@ func ParOr(parallelism int, bitmaps ...*Bitmap) *Bitmap {
 		resultOffset += chunk.size()
 	}
 
-	return &result
+	return &result, nil
 }
 
-type parChunkSpec struct {
-	start uint16
-	end   uint16
-	idx   int
+// ParThresholdOr computes the values that are present in at least k of the
+// bitmaps in parallel, see ThresholdOr, where the parameter "parallelism"
+// determines how many workers are to be used (if it is set to 0, a default
+// number of workers is chosen)
+func ParThresholdOr(parallelism int, k int, bitmaps ...*Bitmap) *Bitmap {
+	bitmap, _ := DefaultPool().ParThresholdOr(context.Background(), parallelism, k, bitmaps...)
+	return bitmap
+}
+
+// ParThresholdOr is ParThresholdOr running on the workers of the pool, and
+// stopping early when ctx is done, see ParHeapOrContext.
+func (p *Pool) ParThresholdOr(ctx context.Context, parallelism int, k int, bitmaps ...*Bitmap) (*Bitmap, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if k <= 1 {
+		return p.ParOr(ctx, parallelism, bitmaps...)
+	} else if k > len(bitmaps) {
+		return NewBitmap(), nil
+	} else if k == len(bitmaps) {
+		return p.ParAnd(ctx, parallelism, bitmaps...)
+	}
+
+	h := newBitmapContainerHeap(bitmaps...)
+	return p.parAggregate(ctx, parallelism, &h, k, func() func([]container) container {
+		counter := newThresholdCounter(len(bitmaps))
+		return func(containers []container) container {
+			// nil is returned if no value reaches the threshold
+			return counter.threshold(k, containers)
+		}
+	})
+}
+
+// ParXor computes the symmetric difference (XOR) of all provided bitmaps in
+// parallel, where the parameter "parallelism" determines how many workers are
+// to be used (if it is set to 0, a default number of workers is chosen)
+func ParXor(parallelism int, bitmaps ...*Bitmap) *Bitmap {
+	bitmap, _ := DefaultPool().ParXor(context.Background(), parallelism, bitmaps...)
+	return bitmap
+}
+
+// ParXor is ParXor running on the workers of the pool, and stopping early
+// when ctx is done, see ParOrContext.
+func (p *Pool) ParXor(ctx context.Context, parallelism int, bitmaps ...*Bitmap) (*Bitmap, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var lKey uint16 = MaxUint16
+	var hKey uint16
+
+	bitmapsFiltered := make([]*Bitmap, 0, len(bitmaps))
+	for _, b := range bitmaps {
+		if !b.IsEmpty() {
+			bitmapsFiltered = append(bitmapsFiltered, b)
+			lKey = minOfUint16(lKey, b.highlowcontainer.keys[0])
+			hKey = maxOfUint16(hKey, b.highlowcontainer.keys[b.highlowcontainer.size()-1])
+		}
+	}
+	bitmaps = bitmapsFiltered
+
+	if len(bitmaps) == 0 {
+		return NewBitmap(), nil
+	} else if len(bitmaps) == 1 {
+		return bitmaps[0].Clone(), nil
+	}
+
+	return p.parOnRanges(ctx, parallelism, lKey, hKey, func(start, end uint16) *roaringArray {
+		return xorOnRange(bitmaps, start, end)
+	})
+}
+
+// ParAndNot computes the values of x that none of the provided bitmaps hold,
+// that is AndNot(x, FastOr(bitmaps...)), in parallel, where the parameter
+// "parallelism" determines how many workers are to be used (if it is set to
+// 0, a default number of workers is chosen)
+func ParAndNot(parallelism int, x *Bitmap, bitmaps ...*Bitmap) *Bitmap {
+	bitmap, _ := DefaultPool().ParAndNot(context.Background(), parallelism, x, bitmaps...)
+	return bitmap
+}
+
+// ParAndNot is ParAndNot running on the workers of the pool, and stopping
+// early when ctx is done, see ParOrContext.
+func (p *Pool) ParAndNot(ctx context.Context, parallelism int, x *Bitmap, bitmaps ...*Bitmap) (*Bitmap, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if x.IsEmpty() {
+		return NewBitmap(), nil
+	} else if len(bitmaps) == 0 {
+		return x.Clone(), nil
+	}
+
+	ra := &x.highlowcontainer
+	return p.parOnRanges(ctx, parallelism, ra.keys[0], ra.keys[ra.size()-1], func(start, end uint16) *roaringArray {
+		answer := newRoaringArray()
+		forEachKeyOnRange(ra, bitmaps, start, end, func(key uint16, c container, containers []container) {
+			if len(containers) == 0 {
+				answer.appendContainer(key, c.clone(), false)
+				return
+			}
+			c = c.andNot(containers[0])
+			for _, next := range containers[1:] {
+				if c.isEmpty() {
+					break
+				}
+				c = c.iandNot(next)
+			}
+			if !c.isEmpty() {
+				answer.appendContainer(key, c, false)
+			}
+		})
+		return answer
+	})
+}
+
+// ParAndAny computes the values of x that at least one of the provided
+// bitmaps holds, that is And(x, FastOr(bitmaps...)), in parallel, where the
+// parameter "parallelism" determines how many workers are to be used (if it
+// is set to 0, a default number of workers is chosen). As with AndAny, x is
+// returned unchanged (here, as a copy) when no bitmap is provided.
+func ParAndAny(parallelism int, x *Bitmap, bitmaps ...*Bitmap) *Bitmap {
+	bitmap, _ := DefaultPool().ParAndAny(context.Background(), parallelism, x, bitmaps...)
+	return bitmap
 }
 
-type parChunk struct {
-	ra  *roaringArray
-	idx int
+// ParAndAny is ParAndAny running on the workers of the pool, and stopping
+// early when ctx is done, see ParOrContext.
+func (p *Pool) ParAndAny(ctx context.Context, parallelism int, x *Bitmap, bitmaps ...*Bitmap) (*Bitmap, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if x.IsEmpty() {
+		return NewBitmap(), nil
+	} else if len(bitmaps) == 0 {
+		return x.Clone(), nil
+	}
+
+	ra := &x.highlowcontainer
+	return p.parOnRanges(ctx, parallelism, ra.keys[0], ra.keys[ra.size()-1], func(start, end uint16) *roaringArray {
+		answer := newRoaringArray()
+		forEachKeyOnRange(ra, bitmaps, start, end, func(key uint16, c container, containers []container) {
+			if len(containers) == 0 {
+				return
+			}
+			ored := containers[0]
+			if len(containers) > 1 {
+				ored = toBitmapContainer(containers[0]).lazyOR(containers[1])
+				for _, next := range containers[2:] {
+					ored = ored.lazyIOR(next)
+				}
+				ored = repairAfterLazy(ored)
+			}
+			if c = c.and(ored); !c.isEmpty() {
+				answer.appendContainer(key, c, false)
+			}
+		})
+		return answer
+	})
+}
+
+// ParOrCardinality computes the cardinality of the union (OR) of all provided
+// bitmaps in parallel, without building it, where the parameter "parallelism"
+// determines how many workers are to be used (if it is set to 0, a default
+// number of workers is chosen)
+func ParOrCardinality(parallelism int, bitmaps ...*Bitmap) uint64 {
+	return DefaultPool().ParOrCardinality(parallelism, bitmaps...)
+}
+
+// ParOrCardinality is ParOrCardinality running on the workers of the pool.
+func (p *Pool) ParOrCardinality(parallelism int, bitmaps ...*Bitmap) uint64 {
+	if len(bitmaps) <= 2 {
+		return FastOrCardinality(bitmaps...)
+	}
+	return p.parHeapCardinality(parallelism, bitmaps, 1, lazyOrCardinality)
+}
+
+// ParAndCardinality computes the cardinality of the intersection (AND) of all
+// provided bitmaps in parallel, without building it, where the parameter
+// "parallelism" determines how many workers are to be used (if it is set to 0,
+// a default number of workers is chosen)
+func ParAndCardinality(parallelism int, bitmaps ...*Bitmap) uint64 {
+	return DefaultPool().ParAndCardinality(parallelism, bitmaps...)
 }
 
-func (c parChunk) size() int {
-	return c.ra.size()
+// ParAndCardinality is ParAndCardinality running on the workers of the pool.
+func (p *Pool) ParAndCardinality(parallelism int, bitmaps ...*Bitmap) uint64 {
+	if len(bitmaps) <= 2 {
+		return FastAndCardinality(bitmaps...)
+	}
+	return p.parHeapCardinality(parallelism, bitmaps, len(bitmaps), andCardinalityMany)
+}
+
+// parHeapCardinality sums, over the keys of the bitmaps, the cardinality
+// computed by the workers from the containers sharing each key. Keys held by
+// fewer than minCount bitmaps are skipped. Each worker owns a scratch
+// container, so that no result container is allocated.
+func (p *Pool) parHeapCardinality(parallelism int, bitmaps []*Bitmap, minCount int,
+	cardinality func(containers []container, scratch *bitmapContainer) int) uint64 {
+	h := newBitmapContainerHeap(bitmaps...)
+	if h.Len() < minCount {
+		return 0
+	}
+
+	parallelism = p.parallelism(parallelism)
+	inputChan := make(chan []container, 128)
+	sums := make([]uint64, parallelism)
+
+	var wg sync.WaitGroup
+	wg.Add(parallelism)
+	for i := range sums {
+		p.Go(func() {
+			defer wg.Done()
+			scratch := newBitmapContainer()
+			for containers := range inputChan {
+				sums[i] += uint64(cardinality(containers, scratch))
+			}
+		})
+	}
+
+	answer := uint64(0)
+	for h.Len() > 0 {
+		ck := h.Next(make([]container, 0, 4))
+		switch {
+		case len(ck.containers) < minCount:
+		case len(ck.containers) == 1:
+			answer += uint64(ck.containers[0].getCardinality())
+		default:
+			inputChan <- ck.containers
+		}
+	}
+	close(inputChan)
+	wg.Wait()
+
+	for _, sum := range sums {
+		answer += sum
+	}
+	return answer
+}
+
+type parChunkSpec struct {
+	start uint16
+	end   uint16
+	idx   int
 }
 
 func parNaiveStartAt(ra *roaringArray, start uint16, last uint16) int {
@@ -610,3 +853,55 @@ func lazyIOrOnRange(ra1, ra2 *roaringArray, start, last uint16) *roaringArray {
 	}
 	return ra1
 }
+
+// xorOnRange computes the symmetric difference of the containers the bitmaps
+// hold for the keys from start to last.
+func xorOnRange(bitmaps []*Bitmap, start, last uint16) *roaringArray {
+	answer := newRoaringArray()
+	h := newBitmapContainerHeapFrom(start, bitmaps...)
+	containers := make([]container, 0, len(bitmaps))
+	for h.Len() > 0 && h.Peek().key <= last {
+		ck := h.Next(containers[:0])
+		var c container
+		if len(ck.containers) == 1 {
+			c = ck.containers[0].clone()
+		} else {
+			c = ck.containers[0].xor(ck.containers[1])
+			for _, next := range ck.containers[2:] {
+				c = c.ixor(next)
+			}
+		}
+		if !c.isEmpty() {
+			answer.appendContainer(ck.key, c, false)
+		}
+	}
+	return answer
+}
+
+// forEachKeyOnRange calls f with every key of x from start to last, the
+// container of x for that key and the containers the other bitmaps hold for
+// it, if any.
+func forEachKeyOnRange(x *roaringArray, others []*Bitmap, start, last uint16,
+	f func(key uint16, c container, containers []container)) {
+	positions := make([]int, len(others))
+	for i, b := range others {
+		positions[i] = b.highlowcontainer.advanceUntil(start, -1)
+	}
+	containers := make([]container, 0, len(others))
+	for idx := x.advanceUntil(start, -1); idx < x.size() && x.keys[idx] <= last; idx++ {
+		key := x.keys[idx]
+		containers = containers[:0]
+		for i, b := range others {
+			ra := &b.highlowcontainer
+			pos := positions[i]
+			if pos < ra.size() && ra.keys[pos] < key {
+				pos = ra.advanceUntil(key, pos)
+				positions[i] = pos
+			}
+			if pos < ra.size() && ra.keys[pos] == key {
+				containers = append(containers, ra.containers[pos])
+			}
+		}
+		f(key, x.containers[idx], containers)
+	}
+}
@@ -0,0 +1,163 @@
+package roaring
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+/* PATCH FORMAT DESCRIPTION
+ *
+ * <header>   uint32_t patchCookie,
+ *            uint64_t Checksum of the old bitmap,
+ *            uint64_t Checksum of the new bitmap
+ * <removed>  uint32_t number of removed containers,
+ *            uint16_t[] their keys, in increasing order
+ * <replaced> the containers that were added or modified, as a bitmap in the
+ *            portable format (WriteTo). Containers keep their own type, so
+ *            the patched bitmap has exactly the same layout, and checksum,
+ *            as the new bitmap.
+ *
+ * All integers are little endian.
+ */
+const (
+	patchCookie     = 0x54504252 // "RBPT" in little endian
+	patchHeaderSize = 20
+)
+
+var (
+	// ErrPatchInvalidCookie is returned when the input is not a patch.
+	ErrPatchInvalidCookie = errors.New("input is not a bitmap patch")
+	// ErrPatchCorrupted is returned when a patch is inconsistent.
+	ErrPatchCorrupted = errors.New("corrupted bitmap patch")
+	// ErrPatchBaseMismatch is returned when a patch is applied to a bitmap
+	// other than the one it was computed from.
+	ErrPatchBaseMismatch = errors.New("patch does not apply to this bitmap")
+	// ErrPatchChecksumMismatch is returned when the patched bitmap does not
+	// have the expected checksum.
+	ErrPatchChecksumMismatch = errors.New("patched bitmap does not match the expected checksum")
+)
+
+// Diff computes a patch that turns old into new when applied with
+// ApplyPatch. Only the containers that differ are part of the patch, which
+// makes it much smaller than the serialized new bitmap when few containers
+// changed. The patch records the Checksum of both bitmaps, so ApplyPatch can
+// check that it is applied to old and that it yields new.
+func Diff(old, new *Bitmap) ([]byte, error) {
+	var removed []uint16
+	replaced := NewBitmap()
+
+	ra1, ra2 := &old.highlowcontainer, &new.highlowcontainer
+	pos1, pos2 := 0, 0
+	for pos1 < ra1.size() || pos2 < ra2.size() {
+		switch {
+		case pos2 == ra2.size() || (pos1 < ra1.size() && ra1.getKeyAtIndex(pos1) < ra2.getKeyAtIndex(pos2)):
+			removed = append(removed, ra1.getKeyAtIndex(pos1))
+			pos1++
+		case pos1 == ra1.size() || ra2.getKeyAtIndex(pos2) < ra1.getKeyAtIndex(pos1):
+			replaced.highlowcontainer.appendContainer(ra2.getKeyAtIndex(pos2), ra2.getContainerAtIndex(pos2), true)
+			pos2++
+		default:
+			c1, c2 := ra1.getContainerAtIndex(pos1), ra2.getContainerAtIndex(pos2)
+			// the checksum depends on the container type, not only on its content
+			if c1.containerType() != c2.containerType() || !c1.equals(c2) {
+				replaced.highlowcontainer.appendContainer(ra2.getKeyAtIndex(pos2), c2, true)
+			}
+			pos1++
+			pos2++
+		}
+	}
+
+	buf := make([]byte, 0, patchHeaderSize+4+2*len(removed)+int(replaced.GetSerializedSizeInBytes()))
+	buf = binary.LittleEndian.AppendUint32(buf, patchCookie)
+	buf = binary.LittleEndian.AppendUint64(buf, old.Checksum())
+	buf = binary.LittleEndian.AppendUint64(buf, new.Checksum())
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(removed)))
+	for _, key := range removed {
+		buf = binary.LittleEndian.AppendUint16(buf, key)
+	}
+	w := bytes.NewBuffer(buf)
+	if _, err := replaced.WriteTo(w); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+// ApplyPatch applies a patch computed by Diff(old, new) to the bitmap,
+// which must be equal to old: the bitmap then becomes equal to new.
+//
+// ApplyPatch returns ErrPatchBaseMismatch if the Checksum of the bitmap is
+// not the one of old, and ErrPatchChecksumMismatch if the result would not
+// have the Checksum of new. The bitmap is left unchanged on error. The
+// patch is copied, so it may be reused once ApplyPatch returns.
+func (rb *Bitmap) ApplyPatch(patch []byte) error {
+	if len(patch) < patchHeaderSize+4 {
+		return ErrPatchCorrupted
+	}
+	if binary.LittleEndian.Uint32(patch) != patchCookie {
+		return ErrPatchInvalidCookie
+	}
+	base := binary.LittleEndian.Uint64(patch[4:])
+	target := binary.LittleEndian.Uint64(patch[12:])
+	if rb.Checksum() != base {
+		return ErrPatchBaseMismatch
+	}
+
+	nRemoved := uint64(binary.LittleEndian.Uint32(patch[20:]))
+	patch = patch[patchHeaderSize+4:]
+	if uint64(len(patch)) < 2*nRemoved {
+		return ErrPatchCorrupted
+	}
+	removed := make([]uint16, nRemoved)
+	for i := range removed {
+		removed[i] = binary.LittleEndian.Uint16(patch[2*i:])
+		if i > 0 && removed[i-1] >= removed[i] {
+			return ErrPatchCorrupted
+		}
+	}
+	patch = patch[2*nRemoved:]
+
+	replaced := NewBitmap()
+	n, err := replaced.ReadFrom(bytes.NewReader(patch))
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrPatchCorrupted, err)
+	}
+	if n != int64(len(patch)) {
+		return ErrPatchCorrupted
+	}
+
+	// merge into a new array so that the bitmap is untouched on error
+	answer := roaringArray{copyOnWrite: rb.highlowcontainer.copyOnWrite, fastRank: rb.highlowcontainer.fastRank}
+	ra1, ra2 := &rb.highlowcontainer, &replaced.highlowcontainer
+	pos1, pos2, posRemoved := 0, 0, 0
+	for pos1 < ra1.size() || pos2 < ra2.size() {
+		if pos2 == ra2.size() || (pos1 < ra1.size() && ra1.getKeyAtIndex(pos1) < ra2.getKeyAtIndex(pos2)) {
+			key := ra1.getKeyAtIndex(pos1)
+			if posRemoved < len(removed) && removed[posRemoved] == key {
+				posRemoved++
+			} else {
+				answer.appendContainer(key, ra1.getContainerAtIndex(pos1), ra1.needsCopyOnWrite(pos1))
+			}
+			pos1++
+			continue
+		}
+		key := ra2.getKeyAtIndex(pos2)
+		if pos1 < ra1.size() && ra1.getKeyAtIndex(pos1) == key {
+			pos1++
+		}
+		answer.appendContainer(key, ra2.getContainerAtIndex(pos2), false)
+		pos2++
+	}
+	// every removed key must be present, and not replaced
+	if posRemoved != len(removed) {
+		return ErrPatchCorrupted
+	}
+
+	patched := Bitmap{highlowcontainer: answer}
+	if patched.Checksum() != target {
+		return ErrPatchChecksumMismatch
+	}
+	rb.highlowcontainer = answer
+	return nil
+}
@@ -0,0 +1,113 @@
+package roaring
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func patchTestBitmap() *Bitmap {
+	rb := NewBitmap()
+	for i := uint32(0); i < 100; i++ {
+		rb.AddRange(uint64(i)<<16, uint64(i)<<16+uint64(i)*500)
+		rb.Add(i<<16 | 0xfff0)
+	}
+	rb.RunOptimize()
+	return rb
+}
+
+func TestDiffApplyPatch(t *testing.T) {
+	old := patchTestBitmap()
+
+	updated := old.Clone()
+	updated.Add(5<<16 | 7)                    // modified container
+	updated.RemoveRange(10<<16, 11<<16)       // removed container
+	updated.Add(500 << 16)                    // new container
+	updated.Remove(20<<16 | 0xfff0)           // modified container
+	updated.AddRange(30<<16, 31<<16)          // run container
+	updated.RemoveRange(40<<16+10, 40<<16+20) // run becomes array or bitmap
+
+	patch, err := Diff(old, updated)
+	require.NoError(t, err)
+	full, err := updated.ToBytes()
+	require.NoError(t, err)
+	assert.Less(t, len(patch), len(full)/4)
+
+	rb := old.Clone()
+	require.NoError(t, rb.ApplyPatch(patch))
+	assert.True(t, updated.Equals(rb))
+	assert.Equal(t, updated.Checksum(), rb.Checksum())
+	require.NoError(t, rb.Validate())
+
+	// patching again is refused, and leaves the bitmap unchanged
+	assert.ErrorIs(t, rb.ApplyPatch(patch), ErrPatchBaseMismatch)
+	assert.True(t, updated.Equals(rb))
+
+	// the old bitmap is not affected by the patched one
+	rb.AddRange(0, 1<<20)
+	assert.True(t, old.Equals(patchTestBitmap()))
+}
+
+func TestDiffApplyPatchEdgeCases(t *testing.T) {
+	for _, pair := range [][2]*Bitmap{
+		{NewBitmap(), NewBitmap()},
+		{NewBitmap(), patchTestBitmap()},
+		{patchTestBitmap(), NewBitmap()},
+		{patchTestBitmap(), patchTestBitmap()},
+		{BitmapOf(1, 2, 3), BitmapOf(1, 2, 3, 1<<31)},
+	} {
+		patch, err := Diff(pair[0], pair[1])
+		require.NoError(t, err)
+		rb := pair[0].Clone()
+		require.NoError(t, rb.ApplyPatch(patch))
+		assert.True(t, pair[1].Equals(rb))
+		assert.Equal(t, pair[1].Checksum(), rb.Checksum())
+	}
+}
+
+func TestApplyPatchSameContentDifferentType(t *testing.T) {
+	old := NewBitmap()
+	old.AddRange(0, 100)
+	old.RunOptimize()
+	updated := BitmapOf(old.ToArray()...)
+	require.True(t, old.Equals(updated))
+	require.NotEqual(t, old.Checksum(), updated.Checksum())
+
+	patch, err := Diff(old, updated)
+	require.NoError(t, err)
+	require.NoError(t, old.ApplyPatch(patch))
+	assert.Equal(t, updated.Checksum(), old.Checksum())
+}
+
+func TestApplyPatchErrors(t *testing.T) {
+	old := patchTestBitmap()
+	updated := old.Clone()
+	updated.Add(1 << 30)
+	updated.RemoveRange(0, 1<<16)
+	patch, err := Diff(old, updated)
+	require.NoError(t, err)
+
+	rb := old.Clone()
+	assert.ErrorIs(t, rb.ApplyPatch(nil), ErrPatchCorrupted)
+	assert.ErrorIs(t, rb.ApplyPatch(make([]byte, 64)), ErrPatchInvalidCookie)
+	assert.ErrorIs(t, rb.ApplyPatch(patch[:len(patch)-1]), ErrPatchCorrupted)
+	assert.ErrorIs(t, rb.ApplyPatch(append(append([]byte(nil), patch...), 0)), ErrPatchCorrupted)
+
+	// wrong target checksum
+	tampered := append([]byte(nil), patch...)
+	tampered[12] ^= 1
+	assert.ErrorIs(t, rb.ApplyPatch(tampered), ErrPatchChecksumMismatch)
+
+	// removal of an absent container
+	other := BitmapOf(1 << 29)
+	patch, err = Diff(other, NewBitmap())
+	require.NoError(t, err)
+	tampered = append([]byte(nil), patch...)
+	copy(tampered[4:12], patch[12:20]) // claim to apply to an empty bitmap
+	empty := NewBitmap()
+	assert.ErrorIs(t, empty.ApplyPatch(tampered), ErrPatchCorrupted)
+
+	assert.True(t, old.Equals(rb))
+	assert.Equal(t, old.Checksum(), rb.Checksum())
+}
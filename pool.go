@@ -0,0 +1,146 @@
+package roaring
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Pool runs the work of parallel operations on a fixed set of goroutines, so
+// that queries running concurrently neither start goroutines of their own nor
+// use more CPUs between them than the pool has workers. Every operation hands
+// the pool as many tasks as its parallelism parameter asks for; tasks beyond
+// the free workers wait in a queue.
+//
+// A Pool is safe for concurrent use. The tasks it runs must not wait for other
+// tasks of the same pool, which may be queued behind them.
+type Pool struct {
+	workers int
+
+	mu     sync.Mutex
+	cond   sync.Cond
+	queue  []func()
+	closed bool
+	wg     sync.WaitGroup
+
+	running   atomic.Int64
+	submitted atomic.Uint64
+	completed atomic.Uint64
+	busy      atomic.Int64 // nanoseconds
+}
+
+// PoolStats reports the activity of a Pool.
+type PoolStats struct {
+	Workers   int           // number of worker goroutines
+	Running   int           // tasks being run
+	Queued    int           // tasks waiting for a worker
+	Submitted uint64        // tasks handed to the pool so far
+	Completed uint64        // tasks run to completion so far
+	Busy      time.Duration // total time spent by the workers running tasks
+}
+
+var (
+	defaultPool     *Pool
+	defaultPoolOnce sync.Once
+)
+
+// DefaultPool returns the pool, with one worker per CPU, that the parallel
+// operations of the package (ParOr, ParAnd...) run on.
+func DefaultPool() *Pool {
+	defaultPoolOnce.Do(func() {
+		defaultPool = NewPool(defaultWorkerCount)
+	})
+	return defaultPool
+}
+
+// NewPool starts a pool of the given number of workers (one per CPU if it is
+// 0 or less). It should be closed once it is no longer needed.
+func NewPool(workers int) *Pool {
+	if workers <= 0 {
+		workers = defaultWorkerCount
+	}
+	p := &Pool{workers: workers}
+	p.cond.L = &p.mu
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// Workers returns the number of workers of the pool.
+func (p *Pool) Workers() int {
+	return p.workers
+}
+
+// Go queues task to be run by a worker of the pool. It does not wait for
+// the task to start. Go panics if the pool is closed.
+func (p *Pool) Go(task func()) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		panic("roaring: Go called on a closed Pool")
+	}
+	p.queue = append(p.queue, task)
+	p.mu.Unlock()
+	p.submitted.Add(1)
+	p.cond.Signal()
+}
+
+// Close waits for the queued tasks to be run and stops the workers.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	p.cond.Broadcast()
+	p.wg.Wait()
+}
+
+// Stats returns the current activity of the pool.
+func (p *Pool) Stats() PoolStats {
+	p.mu.Lock()
+	queued := len(p.queue)
+	p.mu.Unlock()
+	return PoolStats{
+		Workers:   p.workers,
+		Running:   int(p.running.Load()),
+		Queued:    queued,
+		Submitted: p.submitted.Load(),
+		Completed: p.completed.Load(),
+		Busy:      time.Duration(p.busy.Load()),
+	}
+}
+
+// parallelism returns the number of tasks an operation asking for the given
+// parallelism should use, where 0 stands for as many as the pool has workers.
+func (p *Pool) parallelism(parallelism int) int {
+	if parallelism <= 0 {
+		return p.workers
+	}
+	return parallelism
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+	for {
+		p.mu.Lock()
+		for len(p.queue) == 0 && !p.closed {
+			p.cond.Wait()
+		}
+		if len(p.queue) == 0 {
+			p.mu.Unlock()
+			return
+		}
+		task := p.queue[0]
+		p.queue[0] = nil
+		p.queue = p.queue[1:]
+		p.mu.Unlock()
+
+		p.running.Add(1)
+		start := time.Now()
+		task()
+		p.busy.Add(int64(time.Since(start)))
+		p.running.Add(-1)
+		p.completed.Add(1)
+	}
+}
@@ -0,0 +1,103 @@
+package roaring
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPool(t *testing.T) {
+	pool := NewPool(3)
+	assert.Equal(t, 3, pool.Workers())
+
+	// no more tasks run at once than the pool has workers
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	var wg sync.WaitGroup
+	release := make(chan struct{})
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		pool.Go(func() {
+			defer wg.Done()
+			mu.Lock()
+			running++
+			maxRunning = max(maxRunning, running)
+			mu.Unlock()
+			<-release
+			mu.Lock()
+			running--
+			mu.Unlock()
+		})
+	}
+	for pool.Stats().Running < 3 {
+	}
+	stats := pool.Stats()
+	assert.Equal(t, 3, stats.Running)
+	assert.Equal(t, 17, stats.Queued)
+	assert.Equal(t, uint64(20), stats.Submitted)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, 3, maxRunning)
+
+	// Close runs the queued tasks first
+	done := 0
+	for i := 0; i < 5; i++ {
+		pool.Go(func() {
+			mu.Lock()
+			done++
+			mu.Unlock()
+		})
+	}
+	pool.Close()
+	assert.Equal(t, 5, done)
+	stats = pool.Stats()
+	assert.Equal(t, uint64(25), stats.Completed)
+	assert.Zero(t, stats.Running)
+	assert.Zero(t, stats.Queued)
+	assert.Panics(t, func() { pool.Go(func() {}) })
+}
+
+func TestPoolAggregations(t *testing.T) {
+	bitmaps := make([]*Bitmap, 5)
+	for i := range bitmaps {
+		bitmaps[i] = NewBitmap()
+		for k := uint32(0); k < 50; k++ {
+			bitmaps[i].AddRange(uint64(k)<<16+uint64(i*100), uint64(k)<<16+uint64(i*100+5000))
+			bitmaps[i].Add(k<<16 + 60000 + uint32(i%2))
+		}
+	}
+
+	// operations sharing a pool of fewer workers than they ask for
+	pool := NewPool(2)
+	defer pool.Close()
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			or, err := pool.ParOr(ctx, 4, bitmaps...)
+			assert.NoError(t, err)
+			assert.True(t, or.Equals(FastOr(bitmaps...)))
+			heapOr, err := pool.ParHeapOr(ctx, 4, bitmaps...)
+			assert.NoError(t, err)
+			assert.True(t, heapOr.Equals(FastOr(bitmaps...)))
+			and, err := pool.ParAnd(ctx, 4, bitmaps...)
+			assert.NoError(t, err)
+			assert.True(t, and.Equals(FastAnd(bitmaps...)))
+			threshold, err := pool.ParThresholdOr(ctx, 0, 3, bitmaps...)
+			assert.NoError(t, err)
+			assert.True(t, threshold.Equals(ThresholdOr(3, bitmaps...)))
+			assert.Equal(t, FastOrCardinality(bitmaps...), pool.ParOrCardinality(4, bitmaps...))
+			assert.Equal(t, FastAndCardinality(bitmaps...), pool.ParAndCardinality(4, bitmaps...))
+		}()
+	}
+	wg.Wait()
+
+	stats := pool.Stats()
+	assert.Equal(t, 2, stats.Workers)
+	assert.Equal(t, stats.Submitted, stats.Completed)
+	assert.Equal(t, uint64(8*(4+4+4+2+4+4)), stats.Submitted)
+}
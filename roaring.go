@@ -1246,6 +1246,9 @@ func (rb *Bitmap) IsEmpty() bool {
 
 // GetCardinality returns the number of integers contained in the bitmap
 func (rb *Bitmap) GetCardinality() uint64 {
+	if cards := rb.highlowcontainer.ranks(); cards != nil {
+		return cards[len(cards)-1]
+	}
 	size := uint64(0)
 	for _, c := range rb.highlowcontainer.containers {
 		size += uint64(c.getCardinality())
@@ -1258,6 +1261,21 @@ func (rb *Bitmap) GetCardinality() uint64 {
 // value, you get 0. Note that this function differs in convention from the Select function since it
 // return 1 and not 0 on the smallest value.
 func (rb *Bitmap) Rank(x uint32) uint64 {
+	if cards := rb.highlowcontainer.ranks(); cards != nil {
+		i := rb.highlowcontainer.getIndex(highbits(x))
+		if i < 0 {
+			if i = -i - 1; i == 0 {
+				return 0
+			}
+			return cards[i-1]
+		}
+		size := uint64(rb.highlowcontainer.getContainerAtIndex(i).rank(lowbits(x)))
+		if i > 0 {
+			size += cards[i-1]
+		}
+		return size
+	}
+
 	size := uint64(0)
 	for i := 0; i < rb.highlowcontainer.size(); i++ {
 		key := rb.highlowcontainer.getKeyAtIndex(i)
@@ -1329,12 +1347,22 @@ func (rb *Bitmap) CardinalityInRange(start, end uint64) uint64 {
 		endIdx = -endIdx - 2 // index of the last container with key < hbEnd
 	}
 
-	// Tight loop over middle containers — no per-iteration key comparisons.
-	for i := startIdx; i <= endIdx; i++ {
-		if endPresent && i == endIdx {
-			break // this is the end container, handled below
+	middleIdx := endIdx // index of the last middle container
+	if endPresent {
+		middleIdx-- // the end container is handled below
+	}
+	if cards := rb.highlowcontainer.ranks(); cards != nil {
+		if middleIdx >= startIdx {
+			result += cards[middleIdx]
+			if startIdx > 0 {
+				result -= cards[startIdx-1]
+			}
+		}
+	} else {
+		// Tight loop over middle containers — no per-iteration key comparisons.
+		for i := startIdx; i <= middleIdx; i++ {
+			result += uint64(rb.highlowcontainer.getContainerAtIndex(i).getCardinality())
 		}
-		result += uint64(rb.highlowcontainer.getContainerAtIndex(i).getCardinality())
 	}
 
 	// Handle the last container (may be partial).
@@ -1350,20 +1378,74 @@ func (rb *Bitmap) CardinalityInRange(start, end uint64) uint64 {
 // the smallest element. Note that this function differs in convention from
 // the Rank function which returns 1 on the smallest value.
 func (rb *Bitmap) Select(x uint32) (uint32, error) {
-	remaining := x
-	for i := 0; i < rb.highlowcontainer.size(); i++ {
+	if i, before := rb.highlowcontainer.seekRank(uint64(x)); i < rb.highlowcontainer.size() {
+		key := rb.highlowcontainer.getKeyAtIndex(i)
 		c := rb.highlowcontainer.getContainerAtIndex(i)
-		card := uint32(c.getCardinality())
-		if remaining >= card {
-			remaining -= card
-		} else {
-			key := rb.highlowcontainer.getKeyAtIndex(i)
-			return uint32(key)<<16 + uint32(c.selectInt(uint16(remaining))), nil
-		}
+		return uint32(key)<<16 + uint32(c.selectInt(uint16(uint64(x)-before))), nil
 	}
 	return 0, fmt.Errorf("cannot find %dth integer in a bitmap with only %d items", x, rb.GetCardinality())
 }
 
+// forEachRankRange calls f for every container holding values of rank offset
+// to offset+limit-1, with the ranks [start, end) of those values within the
+// container. The containers before offset are skipped using their
+// cardinalities.
+func (ra *roaringArray) forEachRankRange(offset, limit uint64, f func(i, start, end int)) {
+	i, before := ra.seekRank(offset)
+	offset -= before
+	for ; i < ra.size() && limit > 0; i++ {
+		card := uint64(ra.getContainerAtIndex(i).getCardinality())
+		end := card
+		if limit < card-offset {
+			end = offset + limit
+		}
+		f(i, int(offset), int(end))
+		limit -= end - offset
+		offset = 0
+	}
+}
+
+// selectRange returns the values of c of rank start to end-1. The result may
+// share the storage of c.
+func selectRange(c container, start, end int) container {
+	if start == 0 && end == c.getCardinality() {
+		return c
+	}
+	if ac, ok := c.(*arrayContainer); ok {
+		return &arrayContainer{ac.content[start:end]}
+	}
+	return c.and(rangeOfOnes(c.selectInt(uint16(start)), c.selectInt(uint16(end-1))))
+}
+
+// Slice returns a new bitmap holding the values of rank offset to
+// offset+limit-1 (ranks start at 0), that is the limit values following the
+// first offset values, or fewer if the bitmap runs out of values. It is
+// typically used to paginate the values of a bitmap.
+func (rb *Bitmap) Slice(offset, limit uint64) *Bitmap {
+	answer := NewBitmap()
+	ra := &rb.highlowcontainer
+	ra.forEachRankRange(offset, limit, func(i, start, end int) {
+		c := selectRange(ra.getContainerAtIndex(i), start, end)
+		answer.highlowcontainer.appendContainer(ra.getKeyAtIndex(i), c.clone(), false)
+	})
+	return answer
+}
+
+// SelectRange fills buf with the values of rank offset to
+// offset+len(buf)-1 (ranks start at 0) and returns how many values were
+// written, which is less than len(buf) if the bitmap runs out of values. It is
+// typically used to paginate the values of a bitmap.
+func (rb *Bitmap) SelectRange(offset uint64, buf []uint32) int {
+	n := 0
+	ra := &rb.highlowcontainer
+	ra.forEachRankRange(offset, uint64(len(buf)), func(i, start, end int) {
+		hs := uint32(ra.getKeyAtIndex(i)) << 16
+		c := selectRange(ra.getContainerAtIndex(i), start, end)
+		n += c.getManyIterator().nextMany(hs, buf[n:n+end-start])
+	})
+	return n
+}
+
 // And computes the intersection between two bitmaps and stores the result in the current bitmap
 func (rb *Bitmap) And(x2 *Bitmap) {
 	pos1 := 0
@@ -1513,6 +1595,73 @@ main:
 	return answer
 }
 
+// XorCardinality returns the cardinality of the symmetric difference between two bitmaps, bitmaps are not modified
+func (rb *Bitmap) XorCardinality(x2 *Bitmap) uint64 {
+	card1, card2, andCard := rb.cardinalities(x2)
+	return card1 + card2 - 2*andCard
+}
+
+// AndNotCardinality returns the cardinality of the difference between two bitmaps, bitmaps are not modified
+func (rb *Bitmap) AndNotCardinality(x2 *Bitmap) uint64 {
+	return rb.GetCardinality() - rb.AndCardinality(x2)
+}
+
+// JaccardIndex returns the Jaccard similarity |rb AND x2| / |rb OR x2| of two bitmaps,
+// bitmaps are not modified. The index of two empty bitmaps is 1.
+func (rb *Bitmap) JaccardIndex(x2 *Bitmap) float64 {
+	return internal.JaccardIndex(rb.cardinalities(x2))
+}
+
+// DiceCoefficient returns the Sørensen-Dice similarity 2|rb AND x2| / (|rb| + |x2|) of two
+// bitmaps, bitmaps are not modified. The coefficient of two empty bitmaps is 1.
+func (rb *Bitmap) DiceCoefficient(x2 *Bitmap) float64 {
+	return internal.DiceCoefficient(rb.cardinalities(x2))
+}
+
+// OverlapCoefficient returns the overlap similarity |rb AND x2| / min(|rb|, |x2|) of two
+// bitmaps, bitmaps are not modified. It is 1 whenever one bitmap is a subset of the
+// other, including when one of them is empty.
+func (rb *Bitmap) OverlapCoefficient(x2 *Bitmap) float64 {
+	return internal.OverlapCoefficient(rb.cardinalities(x2))
+}
+
+// cardinalities returns the cardinalities of rb, of x2 and of their intersection,
+// computed in a single pass over both bitmaps, matching containers are intersected without building the result.
+func (rb *Bitmap) cardinalities(x2 *Bitmap) (card1, card2, andCard uint64) {
+	pos1 := 0
+	pos2 := 0
+	length1 := rb.highlowcontainer.size()
+	length2 := x2.highlowcontainer.size()
+
+	for pos1 < length1 && pos2 < length2 {
+		s1 := rb.highlowcontainer.getKeyAtIndex(pos1)
+		s2 := x2.highlowcontainer.getKeyAtIndex(pos2)
+		switch {
+		case s1 < s2:
+			card1 += uint64(rb.highlowcontainer.getContainerAtIndex(pos1).getCardinality())
+			pos1++
+		case s1 > s2:
+			card2 += uint64(x2.highlowcontainer.getContainerAtIndex(pos2).getCardinality())
+			pos2++
+		default:
+			c1 := rb.highlowcontainer.getContainerAtIndex(pos1)
+			c2 := x2.highlowcontainer.getContainerAtIndex(pos2)
+			card1 += uint64(c1.getCardinality())
+			card2 += uint64(c2.getCardinality())
+			andCard += uint64(c1.andCardinality(c2))
+			pos1++
+			pos2++
+		}
+	}
+	for ; pos1 < length1; pos1++ {
+		card1 += uint64(rb.highlowcontainer.getContainerAtIndex(pos1).getCardinality())
+	}
+	for ; pos2 < length2; pos2++ {
+		card2 += uint64(x2.highlowcontainer.getContainerAtIndex(pos2).getCardinality())
+	}
+	return card1, card2, andCard
+}
+
 // IntersectsWithInterval checks whether a bitmap 'rb' and an open interval '[x,y)' intersect.
 func (rb *Bitmap) IntersectsWithInterval(x, y uint64) bool {
 	if x >= y {
@@ -1535,6 +1684,130 @@ func (rb *Bitmap) IntersectsWithInterval(x, y uint64) bool {
 	return true
 }
 
+// IsSubset returns true if every value of rb is also in x2, bitmaps are not modified.
+// It returns as soon as a container of rb is found not to be contained in x2.
+func (rb *Bitmap) IsSubset(x2 *Bitmap) bool {
+	length1 := rb.highlowcontainer.size()
+	length2 := x2.highlowcontainer.size()
+	if length1 > length2 {
+		return false
+	}
+	pos2 := -1
+	for pos1 := 0; pos1 < length1; pos1++ {
+		key := rb.highlowcontainer.getKeyAtIndex(pos1)
+		pos2 = x2.highlowcontainer.advanceUntil(key, pos2)
+		if pos2 == length2 || x2.highlowcontainer.getKeyAtIndex(pos2) != key {
+			return false
+		}
+		c1 := rb.highlowcontainer.getContainerAtIndex(pos1)
+		c2 := x2.highlowcontainer.getContainerAtIndex(pos2)
+		if !c1.isSubset(c2) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsSuperset returns true if every value of x2 is also in rb, bitmaps are not modified.
+func (rb *Bitmap) IsSuperset(x2 *Bitmap) bool {
+	return x2.IsSubset(rb)
+}
+
+// IsStrictSubset returns true if rb is a subset of x2 and x2 holds at least one
+// value that is not in rb, bitmaps are not modified.
+func (rb *Bitmap) IsStrictSubset(x2 *Bitmap) bool {
+	return rb.IsSubset(x2) && rb.GetCardinality() < x2.GetCardinality()
+}
+
+// IsDisjoint returns true if the two bitmaps have no value in common, bitmaps are not modified.
+func (rb *Bitmap) IsDisjoint(x2 *Bitmap) bool {
+	return !rb.Intersects(x2)
+}
+
+// SetRelation describes how the values of two bitmaps relate, see Compare.
+type SetRelation int
+
+const (
+	// RelationEqual means that both bitmaps hold the same values.
+	RelationEqual SetRelation = iota
+	// RelationSubset means that the first bitmap is a strict subset of the second.
+	RelationSubset
+	// RelationSuperset means that the first bitmap is a strict superset of the second.
+	RelationSuperset
+	// RelationDisjoint means that the bitmaps have no value in common.
+	RelationDisjoint
+	// RelationOverlap means that the bitmaps have values in common, and that
+	// each also has values that the other lacks.
+	RelationOverlap
+)
+
+func (r SetRelation) String() string {
+	switch r {
+	case RelationEqual:
+		return "equal"
+	case RelationSubset:
+		return "subset"
+	case RelationSuperset:
+		return "superset"
+	case RelationDisjoint:
+		return "disjoint"
+	case RelationOverlap:
+		return "overlap"
+	}
+	return "SetRelation(" + strconv.Itoa(int(r)) + ")"
+}
+
+// Compare computes how rb relates to x2 in a single pass over both bitmaps,
+// without computing any intermediate bitmap. An empty bitmap is a subset of
+// any non-empty bitmap: RelationSubset and RelationSuperset take precedence
+// over RelationDisjoint.
+func (rb *Bitmap) Compare(x2 *Bitmap) SetRelation {
+	subset, superset, intersects := true, true, false
+	pos1, pos2 := 0, 0
+	length1 := rb.highlowcontainer.size()
+	length2 := x2.highlowcontainer.size()
+
+	for pos1 < length1 && pos2 < length2 && (subset || superset || !intersects) {
+		s1 := rb.highlowcontainer.getKeyAtIndex(pos1)
+		s2 := x2.highlowcontainer.getKeyAtIndex(pos2)
+		switch {
+		case s1 < s2:
+			subset = false
+			pos1++
+		case s1 > s2:
+			superset = false
+			pos2++
+		default:
+			c1 := rb.highlowcontainer.getContainerAtIndex(pos1)
+			c2 := x2.highlowcontainer.getContainerAtIndex(pos2)
+			subset = subset && c1.isSubset(c2)
+			superset = superset && c2.isSubset(c1)
+			// non-empty containers intersect if one contains the other
+			intersects = intersects || subset || superset || c1.intersects(c2)
+			pos1++
+			pos2++
+		}
+	}
+	if pos1 < length1 {
+		subset = false
+	}
+	if pos2 < length2 {
+		superset = false
+	}
+
+	switch {
+	case subset && superset:
+		return RelationEqual
+	case subset:
+		return RelationSubset
+	case superset:
+		return RelationSuperset
+	case !intersects:
+		return RelationDisjoint
+	}
+	return RelationOverlap
+}
+
 // Intersects checks whether two bitmap intersects, bitmaps are not modified
 func (rb *Bitmap) Intersects(x2 *Bitmap) bool {
 	pos1 := 0
@@ -1835,6 +2108,196 @@ main:
 	return answer
 }
 
+// containerClip restricts containers to the values of a half-open range
+// [rangeStart, rangeEnd): the keys from first to last overlap the range, and
+// the containers of the first and last keys may have to be clipped to it.
+type containerClip struct {
+	first, last         uint16
+	firstMask, lastMask container // nil when the range covers the whole key
+}
+
+// newContainerClip returns the clip for [rangeStart, rangeEnd), or false if
+// the range is empty. rangeEnd is capped to MaxUint32+1.
+func newContainerClip(rangeStart, rangeEnd uint64) (containerClip, bool) {
+	if rangeEnd > MaxUint32+1 {
+		rangeEnd = MaxUint32 + 1
+	}
+	if rangeStart >= rangeEnd {
+		return containerClip{}, false
+	}
+
+	cc := containerClip{
+		first: highbits(uint32(rangeStart)),
+		last:  highbits(uint32(rangeEnd - 1)),
+	}
+	lo, hi := int(lowbits(uint32(rangeStart))), int(lowbits(uint32(rangeEnd-1)))
+	if cc.first == cc.last {
+		if lo > 0 || hi < MaxUint16 {
+			cc.firstMask = rangeOfOnes(lo, hi)
+			cc.lastMask = cc.firstMask
+		}
+		return cc, true
+	}
+	if lo > 0 {
+		cc.firstMask = rangeOfOnes(lo, MaxUint16)
+	}
+	if hi < MaxUint16 {
+		cc.lastMask = rangeOfOnes(0, hi)
+	}
+	return cc, true
+}
+
+// mask returns the values of key that are in the range, or nil if they all
+// are.
+func (cc *containerClip) mask(key uint16) container {
+	if key == cc.first {
+		return cc.firstMask
+	}
+	if key == cc.last {
+		return cc.lastMask
+	}
+	return nil
+}
+
+// clip returns a copy of the container of key restricted to the range.
+func (cc *containerClip) clip(key uint16, c container) container {
+	if mask := cc.mask(key); mask != nil {
+		return c.and(mask)
+	}
+	return c.clone()
+}
+
+// AndInRange computes the intersection between two bitmaps restricted to the
+// half-open range [rangeStart, rangeEnd) and returns the result. Only the
+// containers overlapping the range are visited, which is much cheaper than
+// clipping the operands or the result of And. The parameters are uint64 to
+// allow rangeEnd = 1<<32 (the full 32-bit range).
+func AndInRange(x1, x2 *Bitmap, rangeStart, rangeEnd uint64) *Bitmap {
+	answer := NewBitmap()
+	cc, ok := newContainerClip(rangeStart, rangeEnd)
+	if !ok {
+		return answer
+	}
+
+	ra1, ra2 := &x1.highlowcontainer, &x2.highlowcontainer
+	pos1, pos2 := ra1.advanceUntil(cc.first, -1), ra2.advanceUntil(cc.first, -1)
+	for pos1 < ra1.size() && pos2 < ra2.size() {
+		s1, s2 := ra1.getKeyAtIndex(pos1), ra2.getKeyAtIndex(pos2)
+		if s1 > cc.last || s2 > cc.last {
+			break
+		}
+		if s1 < s2 {
+			pos1 = ra1.advanceUntil(s2, pos1)
+			continue
+		} else if s1 > s2 {
+			pos2 = ra2.advanceUntil(s1, pos2)
+			continue
+		}
+
+		var c container
+		c1, c2 := ra1.getContainerAtIndex(pos1), ra2.getContainerAtIndex(pos2)
+		if mask := cc.mask(s1); mask != nil {
+			c = c1.and(mask).iand(c2)
+		} else {
+			c = c1.and(c2)
+		}
+		if !c.isEmpty() {
+			answer.highlowcontainer.appendContainer(s1, c, false)
+		}
+		pos1++
+		pos2++
+	}
+	return answer
+}
+
+// AndCardinalityInRange returns the cardinality of the intersection between
+// two bitmaps restricted to the half-open range [rangeStart, rangeEnd),
+// bitmaps are not modified. Only the containers overlapping the range are
+// visited. The parameters are uint64 to allow rangeEnd = 1<<32 (the full
+// 32-bit range).
+func (rb *Bitmap) AndCardinalityInRange(x2 *Bitmap, rangeStart, rangeEnd uint64) uint64 {
+	cc, ok := newContainerClip(rangeStart, rangeEnd)
+	if !ok {
+		return 0
+	}
+
+	answer := uint64(0)
+	ra1, ra2 := &rb.highlowcontainer, &x2.highlowcontainer
+	pos1, pos2 := ra1.advanceUntil(cc.first, -1), ra2.advanceUntil(cc.first, -1)
+	for pos1 < ra1.size() && pos2 < ra2.size() {
+		s1, s2 := ra1.getKeyAtIndex(pos1), ra2.getKeyAtIndex(pos2)
+		if s1 > cc.last || s2 > cc.last {
+			break
+		}
+		if s1 < s2 {
+			pos1 = ra1.advanceUntil(s2, pos1)
+			continue
+		} else if s1 > s2 {
+			pos2 = ra2.advanceUntil(s1, pos2)
+			continue
+		}
+
+		c1, c2 := ra1.getContainerAtIndex(pos1), ra2.getContainerAtIndex(pos2)
+		if mask := cc.mask(s1); mask != nil {
+			answer += uint64(c1.and(mask).andCardinality(c2))
+		} else {
+			answer += uint64(c1.andCardinality(c2))
+		}
+		pos1++
+		pos2++
+	}
+	return answer
+}
+
+// OrInRange computes the union between two bitmaps restricted to the
+// half-open range [rangeStart, rangeEnd) and returns the result. Only the
+// containers overlapping the range are visited, which is much cheaper than
+// clipping the operands or the result of Or. The parameters are uint64 to
+// allow rangeEnd = 1<<32 (the full 32-bit range).
+func OrInRange(x1, x2 *Bitmap, rangeStart, rangeEnd uint64) *Bitmap {
+	answer := NewBitmap()
+	cc, ok := newContainerClip(rangeStart, rangeEnd)
+	if !ok {
+		return answer
+	}
+
+	ra1, ra2 := &x1.highlowcontainer, &x2.highlowcontainer
+	pos1, pos2 := ra1.advanceUntil(cc.first, -1), ra2.advanceUntil(cc.first, -1)
+	for {
+		has1 := pos1 < ra1.size() && ra1.getKeyAtIndex(pos1) <= cc.last
+		has2 := pos2 < ra2.size() && ra2.getKeyAtIndex(pos2) <= cc.last
+
+		var key uint16
+		var c container
+		switch {
+		case has1 && (!has2 || ra1.getKeyAtIndex(pos1) < ra2.getKeyAtIndex(pos2)):
+			key = ra1.getKeyAtIndex(pos1)
+			c = cc.clip(key, ra1.getContainerAtIndex(pos1))
+			pos1++
+		case has2 && (!has1 || ra2.getKeyAtIndex(pos2) < ra1.getKeyAtIndex(pos1)):
+			key = ra2.getKeyAtIndex(pos2)
+			c = cc.clip(key, ra2.getContainerAtIndex(pos2))
+			pos2++
+		case has1 && has2:
+			key = ra1.getKeyAtIndex(pos1)
+			c1, c2 := ra1.getContainerAtIndex(pos1), ra2.getContainerAtIndex(pos2)
+			if mask := cc.mask(key); mask != nil {
+				c = c1.and(mask).ior(c2.and(mask))
+			} else {
+				c = c1.or(c2)
+			}
+			pos1++
+			pos2++
+		default:
+			return answer
+		}
+
+		if !c.isEmpty() {
+			answer.highlowcontainer.appendContainer(key, c, false)
+		}
+	}
+}
+
 // Xor computes the symmetric difference between two bitmaps and returns the result
 func Xor(x1, x2 *Bitmap) *Bitmap {
 	if x1 == x2 {
@@ -1949,6 +2412,114 @@ func (rb *Bitmap) AddMany(dat []uint32) {
 	}
 }
 
+// RemoveMany removes all of the values in dat from the bitmap. Consecutive
+// values sharing their 16 high bits are removed from the same container, and
+// ascending values are found without a full search, so sorted input is
+// fastest.
+func (rb *Bitmap) RemoveMany(dat []uint32) {
+	ra := &rb.highlowcontainer
+	ra.forEachKeyRun(dat, func(i int, hb uint16, run []uint32) int {
+		if i < 0 {
+			return i
+		}
+		c := ra.getWritableContainerAtIndex(i)
+		if values := sortedLowbits(run); values != nil {
+			c = c.iandNot(values)
+		} else {
+			for _, x := range run {
+				c = c.iremoveReturnMinimized(lowbits(x))
+			}
+		}
+		if c.isEmpty() {
+			ra.removeAtIndex(i)
+			return -i - 1
+		}
+		ra.setContainerAtIndex(i, c)
+		return i
+	})
+}
+
+// ContainsMany reports, for every value in dat, whether it is contained in
+// the bitmap. Consecutive values sharing their 16 high bits are looked up in
+// the same container, and ascending values are found without a full search,
+// so sorted input is fastest.
+func (rb *Bitmap) ContainsMany(dat []uint32) []bool {
+	answer := make([]bool, len(dat))
+	ra := &rb.highlowcontainer
+	pos := 0
+	ra.forEachKeyRun(dat, func(i int, hb uint16, run []uint32) int {
+		if i >= 0 {
+			c := ra.getContainerAtIndex(i)
+			for j, x := range run {
+				answer[pos+j] = c.contains(lowbits(x))
+			}
+		}
+		pos += len(run)
+		return i
+	})
+	return answer
+}
+
+// FlipMany negates every value in dat: values present in the bitmap are
+// removed and the others are added. A value occurring twice in dat is thus
+// left unchanged. Consecutive values sharing their 16 high bits are flipped in
+// the same container, and ascending values are found without a full search,
+// so sorted input is fastest.
+func (rb *Bitmap) FlipMany(dat []uint32) {
+	ra := &rb.highlowcontainer
+	ra.forEachKeyRun(dat, func(i int, hb uint16, run []uint32) int {
+		var c container
+		if i >= 0 {
+			c = ra.getWritableContainerAtIndex(i)
+		} else {
+			c = newArrayContainer()
+		}
+		if values := sortedLowbits(run); values != nil {
+			c = c.ixor(values)
+		} else {
+			for _, x := range run {
+				if lb := lowbits(x); c.contains(lb) {
+					c = c.iremoveReturnMinimized(lb)
+				} else {
+					c = c.iaddReturnMinimized(lb)
+				}
+			}
+		}
+
+		if i < 0 {
+			if c.isEmpty() {
+				return i
+			}
+			ra.insertNewKeyValueAt(-i-1, hb, c)
+			return -i - 1
+		}
+		if c.isEmpty() {
+			ra.removeAtIndex(i)
+			return -i - 1
+		}
+		ra.setContainerAtIndex(i, c)
+		return i
+	})
+}
+
+// sortedLowbits returns an array container holding the low bits of run, which
+// shares its high bits, if run is strictly ascending and long enough for a
+// container operation to beat updating values one at a time; otherwise it
+// returns nil.
+func sortedLowbits(run []uint32) *arrayContainer {
+	if len(run) < 16 {
+		return nil
+	}
+	ac := newArrayContainerSize(len(run))
+	for i, x := range run {
+		if i > 0 && x <= run[i-1] {
+			return nil
+		}
+		ac.content[i] = lowbits(x)
+	}
+	return ac
+}
+
 // BitmapOf generates a new bitmap filled with the specified integers
 func BitmapOf(dat ...uint32) *Bitmap {
 	ans := NewBitmap()
@@ -2182,6 +2753,28 @@ func (rb *Bitmap) GetCopyOnWrite() (val bool) {
 	return rb.highlowcontainer.copyOnWrite
 }
 
+// SetFastRank sets this bitmap to keep the cumulative cardinalities of its
+// containers if the parameter is true, like FastRankRoaringBitmap in Java.
+// Rank, Select, CardinalityInRange, GetCardinality, Slice and SelectRange then
+// find their containers by binary search rather than by summing the
+// cardinalities of all the containers before them. The cumulative
+// cardinalities are discarded by every modification and rebuilt, in linear
+// time, by the next query, so they pay off when many queries are made between
+// modifications.
+//
+// Since queries may rebuild the cumulative cardinalities, a bitmap with fast
+// rank must not be queried concurrently without synchronization, even if it
+// is not modified.
+func (rb *Bitmap) SetFastRank(val bool) {
+	rb.highlowcontainer.fastRank = val
+	rb.highlowcontainer.invalidateRanks()
+}
+
+// GetFastRank gets this bitmap's fast rank property, see SetFastRank
+func (rb *Bitmap) GetFastRank() (val bool) {
+	return rb.highlowcontainer.fastRank
+}
+
 // CloneCopyOnWriteContainers clones all containers which have
 // needCopyOnWrite set to true.
 // This can be used to make sure it is safe to munmap a []byte
@@ -2315,19 +2908,19 @@ func (rb *Bitmap) NextAbsentValue(target uint32) int64 {
 	nextValue = int64(container.nextAbsentValue(query))
 	for {
 		if nextValue != (1 << 16) {
-			return int64(combineLoHi32(uint32(nextValue), keyspace))
+			return int64(combineLoHi16(uint16(nextValue), containerKey))
 		}
 
+		// the container is full from the query up to its end
+		if containerKey == MaxUint16 {
+			return -1
+		}
 		if containerIndex == rb.highlowcontainer.size()-1 {
-			val, err := container.safeMaximum()
-			if err == nil {
-				return -1
-			}
-			return int64(val) + 1
+			return int64(containerKey+1) << 16
 		}
 		containerIndex++
 		nextContainerKey := rb.highlowcontainer.getKeyAtIndex(containerIndex)
-		if containerKey < nextContainerKey {
+		if containerKey+1 < nextContainerKey {
 			// There is a gap between keys
 			// Just increment the current key and shift to get HoB
 			return int64(containerKey+1) << 16
@@ -2372,16 +2965,15 @@ func (rb *Bitmap) PreviousAbsentValue(target uint32) int64 {
 	prevValue = int64(container.previousAbsentValue(query))
 	for {
 		if prevValue != -1 {
-			return int64(combineLoHi32(uint32(prevValue), keyspace))
+			return int64(combineLoHi16(uint16(prevValue), containerKey))
 		}
 
+		// the container is full from its start up to the query
+		if containerKey == 0 {
+			return -1
+		}
 		if containerIndex == 0 {
-			val, err := container.safeMinimum()
-			if err == nil {
-				// OR panic, Java panics
-				return -1
-			}
-			return int64(val) - 1
+			return (int64(containerKey) << 16) - 1
 		}
 		containerIndex--
 		nextContainerKey := rb.highlowcontainer.getKeyAtIndex(containerIndex)
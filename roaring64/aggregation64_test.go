@@ -3,9 +3,14 @@ package roaring64
 // to run just these tests: go test -run TestParAggregations
 
 import (
+	"context"
 	"fmt"
-	"github.com/stretchr/testify/assert"
+	"runtime"
 	"testing"
+	"time"
+
+	"github.com/RoaringBitmap/roaring/v2"
+	"github.com/stretchr/testify/assert"
 )
 
 func testAggregations(t *testing.T,
@@ -226,20 +231,71 @@ func assertAggregation(t *testing.T, expected uint64, aggr func(bitmaps ...*Bitm
 
 func TestParAggregations(t *testing.T) {
 	for _, p := range [...]int{0, 1, 2, 4} {
-		//andFunc := func(bitmaps ...*Bitmap) *Bitmap {
-		//	return ParAnd(p, bitmaps...)
-		//}
+		andFunc := func(bitmaps ...*Bitmap) *Bitmap {
+			return ParAnd(p, bitmaps...)
+		}
 		orFunc := func(bitmaps ...*Bitmap) *Bitmap {
 			return ParOr(p, bitmaps...)
 		}
+		xorFunc := func(bitmaps ...*Bitmap) *Bitmap {
+			return ParXor(p, bitmaps...)
+		}
 
 		t.Run(fmt.Sprintf("par%d", p), func(t *testing.T) {
-			//testAggregations(t, andFunc, orFunc, nil)
-			testAggregations(t, nil, orFunc, nil)
+			testAggregations(t, andFunc, orFunc, xorFunc)
 		})
 	}
 }
 
+func TestParDifferences(t *testing.T) {
+	x := NewBitmap()
+	for k := uint64(0); k < 60; k++ {
+		x.AddRange(k<<32, k<<32+70000)
+		x.Add(k<<32 + 1<<20 + k)
+	}
+	bitmaps := make([]*Bitmap, 6)
+	for i := range bitmaps {
+		bitmaps[i] = NewBitmap()
+		for k := uint64(i); k < 80; k += 3 {
+			bitmaps[i].AddRange(k<<32+uint64(i*1000), k<<32+uint64(i*1000+7000))
+			bitmaps[i].Add(k<<32 + 1<<20 + k)
+		}
+	}
+	bitmaps = append(bitmaps, NewBitmap())
+
+	or := FastOr(bitmaps...)
+	wantAndNot := AndNot(x, or)
+	wantAndAny := And(x, or)
+	all := append([]*Bitmap{x}, bitmaps...)
+	wantXor := NewBitmap()
+	for _, b := range all {
+		wantXor.Xor(b)
+	}
+	for _, p := range []int{0, 1, 3} {
+		assert.True(t, ParAndNot(p, x, bitmaps...).Equals(wantAndNot), "parallelism %d", p)
+		assert.True(t, ParAndAny(p, x, bitmaps...).Equals(wantAndAny), "parallelism %d", p)
+		assert.True(t, ParXor(p, all...).Equals(wantXor), "parallelism %d", p)
+	}
+
+	assert.True(t, ParAndNot(0, x).Equals(x))
+	assert.True(t, ParAndAny(0, x).Equals(x))
+	assert.True(t, ParAndNot(0, NewBitmap(), bitmaps...).IsEmpty())
+	assert.True(t, ParAndAny(0, NewBitmap(), bitmaps...).IsEmpty())
+	assert.True(t, ParAndNot(0, x, x).IsEmpty())
+	assert.True(t, ParAndAny(0, x, x).Equals(x))
+	assert.True(t, ParXor(0, x, x).IsEmpty())
+	assert.True(t, FastOr(bitmaps...).Equals(or))
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := DefaultPool().ParXor(cancelled, 0, x, bitmaps[0])
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = DefaultPool().ParAndNot(cancelled, 0, x, bitmaps...)
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = DefaultPool().ParAndAny(cancelled, 0, x, bitmaps...)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
 func TestParAggregations2(t *testing.T) {
 	orFunc := func(bitmaps ...*Bitmap) *Bitmap {
 		return ParOr(0, bitmaps...)
@@ -249,6 +305,199 @@ func TestParAggregations2(t *testing.T) {
 	})
 }
 
+func TestParOrContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	orFunc := func(bitmaps ...*Bitmap) *Bitmap {
+		bitmap, err := ParOrContext(ctx, 2, bitmaps...)
+		assert.NoError(t, err)
+		return bitmap
+	}
+	testAggregations(t, nil, orFunc, nil)
+
+	bitmaps := make([]*Bitmap, 20)
+	for i := range bitmaps {
+		bitmaps[i] = NewBitmap()
+		for k := uint64(0); k < 200; k++ {
+			bitmaps[i].AddRange(k<<32, k<<32+uint64(1000*(i+1)))
+		}
+	}
+	want := FastOr(bitmaps...)
+
+	cancelled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	bitmap, err := ParOrContext(cancelled, 4, bitmaps...)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, bitmap)
+
+	// cancelled while running: either the complete result or the error, and
+	// no worker left behind
+	before := runtime.NumGoroutine()
+	running, cancelLater := context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond, cancelLater)
+	bitmap, err = ParOrContext(running, 4, bitmaps...)
+	if err != nil {
+		assert.ErrorIs(t, err, context.Canceled)
+	} else {
+		assert.True(t, bitmap.Equals(want))
+	}
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > before && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+}
+
+func TestParHeapAggregations(t *testing.T) {
+	orFunc := func(bitmaps ...*Bitmap) *Bitmap {
+		return ParHeapOr(0, bitmaps...)
+	}
+
+	testAggregations(t, nil, orFunc, nil)
+}
+
 func TestFastAggregations(t *testing.T) {
 	testAggregations(t, nil, FastOr, nil)
 }
+
+func TestHeapAggregations(t *testing.T) {
+	testAggregations(t, nil, HeapOr, HeapXor)
+}
+
+func TestBucketAggregations(t *testing.T) {
+	var bitmaps []*Bitmap
+	for i := 0; i < 6; i++ {
+		rb := NewBitmap()
+		for x := uint64(i); x < 1<<18; x += uint64(2 + i) {
+			rb.Add(x)
+		}
+		rb.AddRange(uint64(i)<<32, uint64(i)<<32+70000)
+		rb.AddRange(3<<32+uint64(i)*5000, 3<<32+40000+uint64(i)*5000)
+		rb.Add(1<<40 + uint64(i%3))
+		if i%2 == 0 {
+			rb.RunOptimize()
+		}
+		bitmaps = append(bitmaps, rb)
+	}
+	bitmaps = append(bitmaps, NewBitmap(), BitmapOf(1, 3<<32+45000, 1<<40+1, 1<<41))
+
+	wantOr, wantXor, wantAnd := NewBitmap(), NewBitmap(), bitmaps[0].Clone()
+	for _, rb := range bitmaps {
+		wantOr.Or(rb)
+		wantXor.Xor(rb)
+	}
+	for _, rb := range bitmaps[:6] {
+		wantAnd.And(rb)
+	}
+	assert.False(t, wantAnd.IsEmpty())
+
+	assert.True(t, HeapOr(bitmaps...).Equals(wantOr))
+	assert.True(t, HeapXor(bitmaps...).Equals(wantXor))
+	for _, p := range []int{0, 1, 3} {
+		assert.True(t, ParHeapOr(p, bitmaps...).Equals(wantOr), "p=%d", p)
+		assert.True(t, ParAnd(p, bitmaps[:6]...).Equals(wantAnd), "p=%d", p)
+		assert.True(t, ParAnd(p, bitmaps...).IsEmpty(), "p=%d", p)
+	}
+
+	x := NewBitmap()
+	x.AddRange(0, 1<<17)
+	x.AddRange(3<<32, 3<<32+50000)
+	x.AddRange(5<<32, 5<<32+10)
+	x.Add(1<<41 + 1)
+	rest := bitmaps[1:]
+	want := And(x, FastOr(rest...))
+	andAny := x.Clone()
+	andAny.AndAny(rest...)
+	assert.True(t, andAny.Equals(want))
+	assert.True(t, ParAndAny(0, x, rest...).Equals(want))
+
+	// copy-on-write buckets are left untouched
+	x.SetCopyOnWrite(true)
+	shared := x.Clone()
+	shared.AndAny(rest...)
+	assert.True(t, shared.Equals(want))
+	assert.True(t, x.Contains(1<<41+1))
+	noop := x.Clone()
+	noop.AndAny()
+	assert.True(t, noop.Equals(x))
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := ParHeapOrContext(cancelled, 0, bitmaps...)
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = ParAndContext(cancelled, 0, bitmaps...)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestThresholdOr(t *testing.T) {
+	var bitmaps []*Bitmap
+	for i := 0; i < 6; i++ {
+		rb := NewBitmap()
+		for x := uint64(i); x < 1<<18; x += uint64(2 + i) {
+			rb.Add(x)
+		}
+		rb.AddRange(uint64(i)<<32, uint64(i)<<32+70000)
+		rb.AddRange(3<<32+uint64(i)*5000, 3<<32+40000+uint64(i)*5000)
+		rb.Add(1<<40 + uint64(i%3))
+		if i%2 == 0 {
+			rb.RunOptimize()
+		}
+		bitmaps = append(bitmaps, rb)
+	}
+	bitmaps = append(bitmaps, NewBitmap(), BitmapOf(1, 3<<32+45000, 1<<40+1, 1<<41))
+
+	counts := make(map[uint64]int)
+	for _, rb := range bitmaps {
+		for x := range Values(rb) {
+			counts[x]++
+		}
+	}
+
+	for k := 0; k <= len(bitmaps)+1; k++ {
+		expected := NewBitmap()
+		for x, count := range counts {
+			if count >= k {
+				expected.Add(x)
+			}
+		}
+
+		assert.True(t, expected.Equals(ThresholdOr(k, bitmaps...)), "k=%d", k)
+		for _, p := range []int{0, 1, 3} {
+			assert.True(t, expected.Equals(ParThresholdOr(p, k, bitmaps...)), "k=%d p=%d", k, p)
+		}
+	}
+	assert.True(t, ThresholdOr(2).IsEmpty())
+	assert.True(t, ParThresholdOr(0, 2).IsEmpty())
+}
+
+func TestPoolAggregations(t *testing.T) {
+	bitmaps := make([]*Bitmap, 5)
+	for i := range bitmaps {
+		bitmaps[i] = NewBitmap()
+		for k := uint64(0); k < 50; k++ {
+			bitmaps[i].AddRange(k<<32+uint64(i*100), k<<32+uint64(i*100+5000))
+		}
+	}
+	single := []*Bitmap{BitmapOf(1, 2, 3), BitmapOf(3, 4)} // a single bucket, handed to the 32-bit pool
+
+	// 32-bit and 64-bit operations sharing a pool
+	pool := NewPool(2)
+	defer pool.Close()
+	ctx := context.Background()
+	or, err := pool.ParOr(ctx, 4, bitmaps...)
+	assert.NoError(t, err)
+	assert.True(t, or.Equals(FastOr(bitmaps...)))
+	or, err = pool.ParOr(ctx, 4, single...)
+	assert.NoError(t, err)
+	assert.True(t, or.Equals(BitmapOf(1, 2, 3, 4)))
+	threshold, err := pool.ParThresholdOr(ctx, 0, 3, bitmaps...)
+	assert.NoError(t, err)
+	assert.True(t, threshold.Equals(ThresholdOr(3, bitmaps...)))
+	and, err := pool.Pool.ParAnd(ctx, 0, roaring.BitmapOf(1, 2), roaring.BitmapOf(2, 3))
+	assert.NoError(t, err)
+	assert.Equal(t, []uint32{2}, and.ToArray())
+
+	stats := pool.Stats()
+	assert.Equal(t, 2, stats.Workers)
+	assert.Equal(t, uint64(4+2+2), stats.Submitted) // the single bucket is merged with FastOr
+	assert.Equal(t, stats.Submitted, stats.Completed)
+}
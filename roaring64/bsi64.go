@@ -1,10 +1,10 @@
 package roaring64
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"math/big"
-	"runtime"
 	"sort"
 	"sync"
 )
@@ -440,82 +440,103 @@ func negativeTwosComplementToInt(val *big.Int) *big.Int {
 
 type action func(t *task, batch []uint64, resultsChan chan *Bitmap, wg *sync.WaitGroup)
 
-func parallelExecutor(parallelism int, t *task, e action, foundSet *Bitmap) *Bitmap {
+// cancellableBatchSize is the number of columns handled between two checks of
+// the context, when it can be cancelled.
+const cancellableBatchSize = 1 << 16
+
+// runBatches splits the columns of foundSet into parallelism tasks (as many as
+// the pool has workers if it is zero), which call run on them on the workers
+// of the pool, and collects the results. If ctx can be
+// cancelled, every task cuts its columns into batches of cancellableBatchSize
+// and stops calling run once ctx is done, in which case ctx.Err() is returned
+// after all of them have returned.
+func runBatches[T any](ctx context.Context, pool *Pool, parallelism int, foundSet *Bitmap,
+	run func(batch []uint64, resultsChan chan T, wg *sync.WaitGroup)) ([]T, error) {
 
 	var n int = parallelism
 	if n == 0 {
-		n = runtime.NumCPU()
+		n = pool.Workers()
 	}
 
-	resultsChan := make(chan *Bitmap, n)
-
 	card := foundSet.GetCardinality()
 	x := card / uint64(n)
 
 	remainder := card - (x * uint64(n))
-	var batch []uint64
+	batchSize := max(card, 1)
+	if ctx.Done() != nil {
+		batchSize = cancellableBatchSize
+	}
+	resultsChan := make(chan T, uint64(n)+card/batchSize)
+
 	var wg sync.WaitGroup
 	iter := foundSet.ManyIterator()
 	for i := 0; i < n; i++ {
+		size := x
 		if i == n-1 {
-			batch = make([]uint64, x+remainder)
-		} else {
-			batch = make([]uint64, x)
+			size += remainder
 		}
+		batch := make([]uint64, size)
 		iter.NextMany(batch)
 		wg.Add(1)
-		go e(t, batch, resultsChan, &wg)
+		pool.Go(func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				part := batch[:min(uint64(len(batch)), batchSize)]
+				batch = batch[len(part):]
+				var partWg sync.WaitGroup
+				partWg.Add(1)
+				run(part, resultsChan, &partWg)
+				if len(batch) == 0 {
+					return
+				}
+			}
+		})
 	}
 
 	wg.Wait()
 
 	close(resultsChan)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
-	ba := make([]*Bitmap, 0)
-	for bm := range resultsChan {
-		ba = append(ba, bm)
+	results := make([]T, 0, len(resultsChan))
+	for r := range resultsChan {
+		results = append(results, r)
 	}
+	return results, nil
+}
 
-	return ParOr(0, ba...)
+func parallelExecutor(parallelism int, t *task, e action, foundSet *Bitmap) *Bitmap {
+	results, _ := parallelExecutorContext(context.Background(), DefaultPool(), parallelism, t, e, foundSet)
+	return results
+}
 
+func parallelExecutorContext(ctx context.Context, pool *Pool, parallelism int, t *task, e action, foundSet *Bitmap) (*Bitmap, error) {
+	ba, err := runBatches(ctx, pool, parallelism, foundSet, func(batch []uint64, resultsChan chan *Bitmap, wg *sync.WaitGroup) {
+		e(t, batch, resultsChan, wg)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pool.ParOr(ctx, 0, ba...)
 }
 
 type bsiAction func(input *BSI, filterSet *Bitmap, batch []uint64, resultsChan chan *BSI, wg *sync.WaitGroup)
 
 func parallelExecutorBSIResults(parallelism int, input *BSI, e bsiAction, foundSet, filterSet *Bitmap, sumResults bool) *BSI {
+	results, _ := parallelExecutorBSIResultsContext(context.Background(), DefaultPool(), parallelism, input, e, foundSet, filterSet, sumResults)
+	return results
+}
 
-	var n int = parallelism
-	if n == 0 {
-		n = runtime.NumCPU()
-	}
-
-	resultsChan := make(chan *BSI, n)
-
-	card := foundSet.GetCardinality()
-	x := card / uint64(n)
-
-	remainder := card - (x * uint64(n))
-	var batch []uint64
-	var wg sync.WaitGroup
-	iter := foundSet.ManyIterator()
-	for i := 0; i < n; i++ {
-		if i == n-1 {
-			batch = make([]uint64, x+remainder)
-		} else {
-			batch = make([]uint64, x)
-		}
-		iter.NextMany(batch)
-		wg.Add(1)
-		go e(input, filterSet, batch, resultsChan, &wg)
-	}
-
-	wg.Wait()
-
-	close(resultsChan)
+func parallelExecutorBSIResultsContext(ctx context.Context, pool *Pool, parallelism int, input *BSI, e bsiAction,
+	foundSet, filterSet *Bitmap, sumResults bool) (*BSI, error) {
 
-	ba := make([]*BSI, 0)
-	for bm := range resultsChan {
-		ba = append(ba, bm)
+	ba, err := runBatches(ctx, pool, parallelism, foundSet, func(batch []uint64, resultsChan chan *BSI, wg *sync.WaitGroup) {
+		e(input, filterSet, batch, resultsChan, wg)
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	results := NewDefaultBSI()
@@ -526,8 +547,7 @@ func parallelExecutorBSIResults(parallelism int, input *BSI, e bsiAction, foundS
 	} else {
 		results.ParOr(0, ba...)
 	}
-	return results
-
+	return results, nil
 }
 
 // Operation identifier
@@ -1170,6 +1190,22 @@ func (b *BSI) IntersectAndTranspose(parallelism int, foundSet *Bitmap) *Bitmap {
 	return parallelExecutor(parallelism, trans, transpose, foundSet)
 }
 
+// IntersectAndTransposeContext is IntersectAndTranspose stopping early when ctx
+// is done, in which case the workers return and ctx.Err() is reported.
+func (b *BSI) IntersectAndTransposeContext(ctx context.Context, parallelism int, foundSet *Bitmap) (*Bitmap, error) {
+	return b.IntersectAndTransposeOnPool(ctx, DefaultPool(), parallelism, foundSet)
+}
+
+// IntersectAndTransposeOnPool is IntersectAndTransposeContext running on the
+// workers of pool.
+func (b *BSI) IntersectAndTransposeOnPool(ctx context.Context, pool *Pool, parallelism int, foundSet *Bitmap) (*Bitmap, error) {
+	if foundSet == nil {
+		foundSet = &b.eBM
+	}
+	trans := &task{bsi: b}
+	return parallelExecutorContext(ctx, pool, parallelism, trans, transpose, foundSet)
+}
+
 func transpose(e *task, batch []uint64, resultsChan chan *Bitmap, wg *sync.WaitGroup) {
 
 	defer wg.Done()
@@ -1829,6 +1865,24 @@ func (b *BSI) TransposeWithCounts(parallelism int, foundSet, filterSet *Bitmap)
 	return parallelExecutorBSIResults(parallelism, b, transposeWithCounts, foundSet, filterSet, true)
 }
 
+// TransposeWithCountsContext is TransposeWithCounts stopping early when ctx is
+// done, in which case the workers return and ctx.Err() is reported.
+func (b *BSI) TransposeWithCountsContext(ctx context.Context, parallelism int, foundSet, filterSet *Bitmap) (*BSI, error) {
+	return b.TransposeWithCountsOnPool(ctx, DefaultPool(), parallelism, foundSet, filterSet)
+}
+
+// TransposeWithCountsOnPool is TransposeWithCountsContext running on the
+// workers of pool.
+func (b *BSI) TransposeWithCountsOnPool(ctx context.Context, pool *Pool, parallelism int, foundSet, filterSet *Bitmap) (*BSI, error) {
+	if foundSet == nil {
+		foundSet = &b.eBM
+	}
+	if filterSet == nil {
+		filterSet = &b.eBM
+	}
+	return parallelExecutorBSIResultsContext(ctx, pool, parallelism, b, transposeWithCounts, foundSet, filterSet, true)
+}
+
 func transposeWithCounts(input *BSI, filterSet *Bitmap, batch []uint64, resultsChan chan *BSI, wg *sync.WaitGroup) {
 
 	defer wg.Done()
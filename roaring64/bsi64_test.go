@@ -3,6 +3,7 @@ package roaring64
 import (
 	"bytes"
 	"cmp"
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -577,6 +578,44 @@ func TestTransposeWithCounts(t *testing.T) {
 	assert.Equal(t, int64(1), a)
 }
 
+func TestParallelExecutorContext(t *testing.T) {
+	bsi := setup()
+	bsi.SetValue(101, 50)
+
+	transposed, err := bsi.IntersectAndTransposeContext(context.Background(), 4, nil)
+	assert.NoError(t, err)
+	assert.True(t, transposed.Equals(bsi.IntersectAndTranspose(4, nil)))
+	counts, err := bsi.TransposeWithCountsContext(context.Background(), 4, nil, nil)
+	assert.NoError(t, err)
+	a, ok := counts.GetValue(uint64(50))
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), a)
+
+	// the executors run on the pool they are given
+	pool := NewPool(2)
+	defer pool.Close()
+	transposed, err = bsi.IntersectAndTransposeOnPool(context.Background(), pool, 4, nil)
+	assert.NoError(t, err)
+	assert.True(t, transposed.Equals(bsi.IntersectAndTranspose(4, nil)))
+	counts, err = bsi.TransposeWithCountsOnPool(context.Background(), pool, 4, nil, nil)
+	assert.NoError(t, err)
+	a, ok = counts.GetValue(uint64(50))
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), a)
+	stats := pool.Stats()
+	assert.GreaterOrEqual(t, stats.Submitted, uint64(2*4))
+	assert.Equal(t, stats.Submitted, stats.Completed)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	transposed, err = bsi.IntersectAndTransposeContext(ctx, 4, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, transposed)
+	counts, err = bsi.TransposeWithCountsContext(ctx, 4, nil, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, counts)
+}
+
 func TestRangeAllNegative(t *testing.T) {
 	bsi := setupAllNegative()
 	assert.Equal(t, uint64(100), bsi.GetCardinality())
@@ -0,0 +1,113 @@
+package roaring64
+
+import "github.com/RoaringBitmap/roaring/v2"
+
+// Builder constructs a bitmap from values added in ascending order, as when
+// ingesting sorted identifiers. The values of the current bucket (the values
+// sharing their 32 high bits) go to a roaring.Builder, whose result is
+// appended to the bitmap under construction when a value with larger high
+// bits arrives or when Build is called.
+//
+// Values need only be mostly ascending: a value whose high bits precede those
+// of the current bucket is added to the bitmap under construction with Add,
+// at the usual cost.
+//
+// A Builder is not safe for concurrent use.
+type Builder struct {
+	answer      *Bitmap
+	runOptimize bool
+	unordered   bool // whether values were added to answer directly
+
+	key    uint32
+	bucket *roaring.Builder
+}
+
+// NewBuilder returns an empty builder. If runOptimize is true, every container
+// is also considered for run compression when it is flushed, as RunOptimize
+// would do; values added out of order are run-optimized by Build.
+func NewBuilder(runOptimize bool) *Builder {
+	return &Builder{
+		answer:      NewBitmap(),
+		runOptimize: runOptimize,
+		bucket:      roaring.NewBuilder(runOptimize),
+	}
+}
+
+// Add adds the integer x to the bitmap under construction.
+func (b *Builder) Add(x uint64) {
+	hb := highbits(x)
+	if hb != b.key {
+		if hb < b.key {
+			b.answer.Add(x)
+			b.unordered = true
+			return
+		}
+		b.flush()
+		b.key = hb
+	}
+	b.bucket.Add(lowbits(x))
+}
+
+// AddMany adds all of the values in dat to the bitmap under construction.
+func (b *Builder) AddMany(dat []uint64) {
+	for _, x := range dat {
+		b.Add(x)
+	}
+}
+
+// AddRange adds the integers in [rangeStart, rangeEnd) to the bitmap under
+// construction.
+func (b *Builder) AddRange(rangeStart, rangeEnd uint64) {
+	if rangeStart >= rangeEnd {
+		return
+	}
+	hbStart := uint64(highbits(rangeStart))
+	lbStart := uint64(lowbits(rangeStart))
+	hbLast := uint64(highbits(rangeEnd - 1))
+	lbLast := uint64(lowbits(rangeEnd - 1))
+
+	var max uint64 = maxLowBit
+	for hb := hbStart; hb <= hbLast; hb++ {
+		containerStart := uint64(0)
+		if hb == hbStart {
+			containerStart = lbStart
+		}
+		containerLast := max
+		if hb == hbLast {
+			containerLast = lbLast
+		}
+
+		if uint32(hb) < b.key {
+			b.answer.AddRange(hb<<32|containerStart, hb<<32|containerLast+1)
+			b.unordered = true
+			continue
+		}
+		if uint32(hb) != b.key {
+			b.flush()
+			b.key = uint32(hb)
+		}
+		b.bucket.AddRange(containerStart, containerLast+1)
+	}
+}
+
+// Build returns the bitmap holding all the values added so far and resets the
+// builder, which can then be used to construct another bitmap.
+func (b *Builder) Build() *Bitmap {
+	b.flush()
+	answer := b.answer
+	if b.runOptimize && b.unordered {
+		answer.RunOptimize()
+	}
+	b.answer = NewBitmap()
+	b.key = 0
+	b.unordered = false
+	return answer
+}
+
+// flush appends the bucket of the current key to the bitmap under
+// construction.
+func (b *Builder) flush() {
+	if bucket := b.bucket.Build(); !bucket.IsEmpty() {
+		b.answer.highlowcontainer.appendContainer(b.key, bucket, false)
+	}
+}
@@ -0,0 +1,58 @@
+package roaring64
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuilder(t *testing.T) {
+	var values []uint64
+	for i := uint64(0); i < 5000; i++ {
+		values = append(values, i*3, 1<<32+i, 1<<40+i*70000)
+	}
+	values = append(values, 1<<50, 1<<50, 1<<63)
+
+	for _, runOptimize := range []bool{false, true} {
+		expected := BitmapOf(values...)
+		if runOptimize {
+			expected.RunOptimize()
+		}
+
+		b := NewBuilder(runOptimize)
+		b.AddMany(values)
+		rb := b.Build()
+		require.NoError(t, rb.Validate())
+		assert.True(t, expected.Equals(rb))
+		assert.Equal(t, expected.HasRunCompression(), rb.HasRunCompression())
+
+		b.Add(42)
+		assert.Equal(t, []uint64{42}, b.Build().ToArray())
+		assert.True(t, b.Build().IsEmpty())
+	}
+}
+
+func TestBuilderMostlyAscending(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	expected := NewBitmap()
+	b := NewBuilder(false)
+	for i := uint64(0); i < 100000; i++ {
+		x := i << 28
+		if r.Intn(10) == 0 {
+			x -= uint64(r.Int63n(1 << 34)) // may fall in a flushed bucket
+		}
+		expected.Add(x)
+		b.Add(x)
+	}
+	b.AddRange(1<<32-10, 3<<32+10)
+	expected.AddRange(1<<32-10, 3<<32+10)
+	b.AddRange(math.MaxUint64-5, math.MaxUint64)
+	expected.AddRange(math.MaxUint64-5, math.MaxUint64)
+
+	rb := b.Build()
+	require.NoError(t, rb.Validate())
+	assert.True(t, expected.Equals(rb))
+}
@@ -0,0 +1,196 @@
+package roaring64
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/RoaringBitmap/roaring/v2"
+	"github.com/RoaringBitmap/roaring/v2/internal"
+)
+
+/* CHECKSUMMED FORMAT DESCRIPTION (64-bit)
+ *
+ * <header>    uint32_t checksumCookie64,
+ *             uint32_t payload format (checksummedPortable or checksummedFrozen),
+ *             uint64_t payload length in bytes,
+ *             uint64_t number of 16-bit containers,
+ *             uint32_t zero,
+ *             uint32_t CRC32C of the first 28 bytes of <header> followed by <checksums>
+ * <payload>   the bitmap in the portable format (WriteTo) or in the 64-bit
+ *             frozen format (Freeze). The header is 32 bytes long, so a
+ *             frozen payload is aligned as long as the envelope is.
+ * <checksums> for every 16-bit container, in increasing key order:
+ *             uint32_t bucket key, uint16_t container key,
+ *             uint32_t CRC32C of the container (see roaring.Bitmap.ContainerChecksums)
+ *
+ * All integers are little endian. This is the layout of the 32-bit
+ * envelope, with wider keys.
+ */
+const (
+	checksumCookie64   = 0x384b4352 // "RCK8" in little endian
+	checksumHeaderSize = internal.ChecksumHeaderSize
+	checksumEntrySize  = 10
+
+	checksummedPortable = internal.ChecksummedPortable
+	checksummedFrozen   = internal.ChecksummedFrozen
+)
+
+var checksumEnvelope = internal.ChecksumEnvelope{
+	Cookie:     checksumCookie64,
+	EntrySize:  checksumEntrySize,
+	MaxEntries: 1 << 48,
+}
+
+var (
+	// ErrChecksumInvalidCookie is returned when the input is not a checksummed bitmap.
+	ErrChecksumInvalidCookie = roaring.ErrChecksumInvalidCookie
+	// ErrChecksumCorrupted is returned, possibly wrapped in a CorruptionError,
+	// when a checksummed bitmap does not match its checksums.
+	ErrChecksumCorrupted = roaring.ErrChecksumCorrupted
+)
+
+// CorruptionError reports that the 16-bit container holding the values
+// whose high 48 bits are Key does not match its checksum. A container that
+// is missing, or that should not be there, has a checksum of zero.
+//
+// CorruptionError wraps ErrChecksumCorrupted.
+type CorruptionError struct {
+	Key      uint64
+	Expected uint32 // checksum stored when the bitmap was written
+	Actual   uint32 // checksum of the container that was read
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("corrupted container with key %d (values from %d): checksum is %08x, expected %08x",
+		e.Key, e.Key<<16, e.Actual, e.Expected)
+}
+
+func (e *CorruptionError) Unwrap() error {
+	return ErrChecksumCorrupted
+}
+
+type containerChecksum struct {
+	key      uint64 // high 48 bits
+	checksum uint32
+}
+
+func (rb *Bitmap) containerChecksums() []containerChecksum {
+	var sums []containerChecksum
+	var buf []roaring.ContainerChecksum
+	ra := &rb.highlowcontainer
+	for i, c := range ra.containers {
+		buf = c.ContainerChecksums(buf[:0])
+		for _, s := range buf {
+			sums = append(sums, containerChecksum{key: uint64(ra.keys[i])<<16 | uint64(s.Key), checksum: s.Checksum})
+		}
+	}
+	return sums
+}
+
+// appendChecksumTable appends the <checksums> section of rb to dst.
+func (rb *Bitmap) appendChecksumTable(dst []byte) []byte {
+	for _, s := range rb.containerChecksums() {
+		dst = binary.LittleEndian.AppendUint32(dst, uint32(s.key>>16))
+		dst = binary.LittleEndian.AppendUint16(dst, uint16(s.key))
+		dst = binary.LittleEndian.AppendUint32(dst, s.checksum)
+	}
+	return dst
+}
+
+// verifyContainerChecksums compares the containers of rb with the
+// <checksums> section, and returns a CorruptionError for the first one
+// that does not match.
+func (rb *Bitmap) verifyContainerChecksums(table []byte) error {
+	actual := rb.containerChecksums()
+	key, expected, got, found := internal.FirstChecksumMismatch(
+		len(actual), func(i int) (uint64, uint32) {
+			return actual[i].key, actual[i].checksum
+		},
+		len(table)/checksumEntrySize, func(j int) (uint64, uint32) {
+			entry := table[checksumEntrySize*j:]
+			key := uint64(binary.LittleEndian.Uint32(entry))<<16 | uint64(binary.LittleEndian.Uint16(entry[4:]))
+			return key, binary.LittleEndian.Uint32(entry[6:])
+		})
+	if !found {
+		return nil
+	}
+	return &CorruptionError{Key: key, Expected: expected, Actual: got}
+}
+
+// WriteChecksummedTo writes the bitmap in the portable format (see WriteTo),
+// wrapped in an envelope holding the CRC32C checksum of every 16-bit
+// container. Such a bitmap is read back with ReadChecksummedFrom, which
+// detects corrupted containers.
+func (rb *Bitmap) WriteChecksummedTo(stream io.Writer) (int64, error) {
+	payload, err := rb.ToBytes()
+	if err != nil {
+		return 0, err
+	}
+	// checksum the containers exactly as they will be read back
+	view := NewBitmap()
+	if _, err := view.FromUnsafeBytes(payload); err != nil {
+		return 0, err
+	}
+	table := view.appendChecksumTable(nil)
+
+	var header [checksumHeaderSize]byte
+	checksumEnvelope.PutHeader(header[:], checksummedPortable, uint64(len(payload)), table)
+
+	var written int64
+	for _, b := range [][]byte{header[:], payload, table} {
+		n, err := stream.Write(b)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// ReadChecksummedFrom reads a bitmap written by WriteChecksummedTo, and
+// checks every container against its checksum. If a container does not
+// match, it returns a *CorruptionError naming its key; every corruption
+// error wraps ErrChecksumCorrupted. The bitmap is empty after an error.
+func (rb *Bitmap) ReadChecksummedFrom(stream io.Reader) (p int64, err error) {
+	defer func() {
+		if err != nil {
+			rb.Clear()
+		}
+	}()
+
+	var header [checksumHeaderSize]byte
+	n, err := io.ReadFull(stream, header[:])
+	p = int64(n)
+	if err != nil {
+		return p, err
+	}
+	payloadLen, tableLen, err := checksumEnvelope.ParseHeader(header[:], checksummedPortable)
+	if err != nil {
+		return p, err
+	}
+
+	m, err := rb.ReadFrom(io.LimitReader(stream, int64(payloadLen)))
+	p += m
+	if err != nil {
+		return p, fmt.Errorf("%w: %w", ErrChecksumCorrupted, err)
+	}
+	if uint64(m) != payloadLen {
+		return p, fmt.Errorf("%w: unexpected payload length", ErrChecksumCorrupted)
+	}
+	// the number of containers is bounded by the payload that was just read
+	if tableLen/checksumEntrySize > payloadLen {
+		return p, fmt.Errorf("%w: unexpected number of containers", ErrChecksumCorrupted)
+	}
+
+	table := make([]byte, tableLen)
+	n, err = io.ReadFull(stream, table)
+	p += int64(n)
+	if err != nil {
+		return p, err
+	}
+	if err := internal.CheckChecksumTable(header[:], table); err != nil {
+		return p, err
+	}
+	return p, rb.verifyContainerChecksums(table)
+}
@@ -0,0 +1,78 @@
+package roaring64
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func checksumTestBitmap() *Bitmap {
+	rb := BitmapOf(1, 2, 3, 1<<40|7)
+	rb.AddRange(3<<32+100, 3<<32+200000)
+	rb.RunOptimize()
+	return rb
+}
+
+func TestChecksummedRoundTrip(t *testing.T) {
+	for _, rb := range []*Bitmap{NewBitmap(), BitmapOf(1 << 50), checksumTestBitmap()} {
+		var buf bytes.Buffer
+		n, err := rb.WriteChecksummedTo(&buf)
+		require.NoError(t, err)
+		assert.EqualValues(t, buf.Len(), n)
+
+		buf.WriteString("tail")
+		got := BitmapOf(123)
+		p, err := got.ReadChecksummedFrom(&buf)
+		require.NoError(t, err)
+		assert.Equal(t, n, p)
+		assert.True(t, rb.Equals(got))
+		assert.Equal(t, "tail", buf.String())
+	}
+}
+
+func TestChecksummedCorruptedContainer(t *testing.T) {
+	rb := checksumTestBitmap()
+	var buf bytes.Buffer
+	_, err := rb.WriteChecksummedTo(&buf)
+	require.NoError(t, err)
+	data := buf.Bytes()
+
+	// the payload ends with the array container holding 1<<40|7
+	count := len(rb.containerChecksums())
+	payloadEnd := len(data) - count*checksumEntrySize
+	data[payloadEnd-2] ^= 0x01
+
+	got := NewBitmap()
+	_, err = got.ReadChecksummedFrom(bytes.NewReader(data))
+	var corruption *CorruptionError
+	if assert.ErrorAs(t, err, &corruption) {
+		assert.Equal(t, uint64(1<<40|7)>>16, corruption.Key)
+	}
+	assert.ErrorIs(t, err, ErrChecksumCorrupted)
+	assert.True(t, got.IsEmpty())
+}
+
+func TestChecksummedErrors(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := checksumTestBitmap().WriteChecksummedTo(&buf)
+	require.NoError(t, err)
+	data := buf.Bytes()
+
+	corrupt := func(i int) []byte {
+		c := append([]byte(nil), data...)
+		c[i] ^= 0x10
+		return c
+	}
+
+	rb := NewBitmap()
+	_, err = rb.ReadChecksummedFrom(bytes.NewReader(corrupt(0)))
+	assert.ErrorIs(t, err, ErrChecksumInvalidCookie)
+	_, err = rb.ReadChecksummedFrom(bytes.NewReader(corrupt(len(data) - 1)))
+	assert.ErrorIs(t, err, ErrChecksumCorrupted)
+	_, err = rb.ReadChecksummedFrom(bytes.NewReader(corrupt(8)))
+	assert.ErrorIs(t, err, ErrChecksumCorrupted)
+	_, err = rb.ReadChecksummedFrom(bytes.NewReader(data[:len(data)-1]))
+	assert.Error(t, err)
+}
@@ -0,0 +1,104 @@
+package roaring64
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrentBitmap(t *testing.T) {
+	var cb ConcurrentBitmap
+	assert.True(t, cb.IsEmpty())
+	assert.True(t, cb.CheckedAdd(1))
+	assert.False(t, cb.CheckedAdd(1))
+	cb.AddMany([]uint64{2, 3, 70000, 70001, 1 << 40})
+	cb.Add(5 << 32)
+	assert.True(t, cb.Contains(70001))
+	assert.False(t, cb.Contains(4))
+	assert.True(t, cb.CheckedRemove(2))
+	assert.False(t, cb.CheckedRemove(2))
+	cb.Remove(3)
+	assert.Equal(t, uint64(5), cb.GetCardinality())
+	assert.Equal(t, []uint64{1, 70000, 70001, 5 << 32, 1 << 40}, cb.Snapshot().ToArray())
+
+	other := BitmapOf(1, 4, 70001, 64<<32, 1<<50)
+	cb.Or(other)
+	assert.True(t, cb.Snapshot().Equals(BitmapOf(1, 4, 70000, 70001, 5<<32, 64<<32, 1<<40, 1<<50)))
+	cb.AndNot(BitmapOf(4, 1<<40))
+	assert.True(t, cb.Snapshot().Equals(BitmapOf(1, 70000, 70001, 5<<32, 64<<32, 1<<50)))
+	cb.And(other)
+	assert.True(t, cb.Snapshot().Equals(BitmapOf(1, 70001, 64<<32, 1<<50)))
+	assert.True(t, other.Equals(BitmapOf(1, 4, 70001, 64<<32, 1<<50)))
+
+	var buf bytes.Buffer
+	_, err := cb.WriteTo(&buf)
+	require.NoError(t, err)
+	read := NewBitmap()
+	_, err = read.ReadFrom(&buf)
+	require.NoError(t, err)
+	assert.True(t, read.Equals(cb.Snapshot()))
+
+	// the snapshot does not change with the bitmap
+	snapshot := cb.Snapshot()
+	cb.Add(2)
+	assert.False(t, snapshot.Contains(2))
+
+	cb.Clear()
+	assert.True(t, cb.IsEmpty())
+	assert.True(t, NewConcurrentBitmapFrom(other).Snapshot().Equals(other))
+}
+
+func TestConcurrentBitmapConcurrency(t *testing.T) {
+	cb := NewConcurrentBitmap()
+	// the values of a writer go to several buckets, shared with the others
+	spread := func(x uint64) uint64 { return x%100<<32 | x*7 }
+	const writers, perWriter = 8, 20000
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := uint64(0); i < perWriter; i++ {
+				x := spread(i*writers + uint64(w))
+				cb.Add(x)
+				assert.True(t, cb.Contains(x))
+				if i%3 == 0 {
+					cb.Remove(x)
+				}
+			}
+		}()
+	}
+	// readers and bulk operations running alongside the writers
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			assert.NoError(t, cb.Snapshot().Validate())
+			cb.Or(BitmapOf(1 << 50))
+			cb.GetCardinality()
+		}
+	}()
+	wg.Wait()
+	close(done)
+	readers.Wait()
+	cb.Or(BitmapOf(1 << 50)) // in case the readers got no turn
+
+	want := NewBitmap()
+	want.Add(1 << 50)
+	for x := uint64(0); x < writers*perWriter; x++ {
+		if (x/writers)%3 != 0 {
+			want.Add(spread(x))
+		}
+	}
+	assert.True(t, cb.Snapshot().Equals(want))
+}
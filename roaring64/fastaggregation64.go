@@ -1,5 +1,7 @@
 package roaring64
 
+import "github.com/RoaringBitmap/roaring/v2"
+
 // FastAnd computes the intersection between many bitmaps quickly
 // Compared to the And function, it can take many bitmaps as input, thus saving the trouble
 // of manually calling "And" many times.
@@ -29,3 +31,149 @@ func FastOr(bitmaps ...*Bitmap) *Bitmap {
 	}
 	return answer
 }
+
+var (
+	_ roaring.GenericFastOrer[*Bitmap]  = (*Bitmap)(nil)
+	_ roaring.GenericFastAnder[*Bitmap] = (*Bitmap)(nil)
+)
+
+// FastOrWith computes the union between the bitmap and others with FastOr.
+// roaring.GenericFastOr relies on it to handle 64-bit bitmaps.
+func (rb *Bitmap) FastOrWith(others ...*Bitmap) *Bitmap {
+	return FastOr(append([]*Bitmap{rb}, others...)...)
+}
+
+// FastAndWith computes the intersection between the bitmap and others with
+// FastAnd. roaring.GenericFastAnd relies on it to handle 64-bit bitmaps.
+func (rb *Bitmap) FastAndWith(others ...*Bitmap) *Bitmap {
+	return FastAnd(append([]*Bitmap{rb}, others...)...)
+}
+
+// HeapOr computes the union between many bitmaps quickly, as opposed to
+// having to call Or repeatedly. The buckets sharing a key are found with a
+// heap and merged at once with roaring.FastOr, which repairs the containers
+// only once all of them are merged.
+func HeapOr(bitmaps ...*Bitmap) *Bitmap {
+	h := newBucketHeap(bitmaps...)
+	buckets := make([]*roaring.Bitmap, 0, len(bitmaps))
+	answer := NewBitmap()
+	for h.Len() > 0 {
+		var key uint32
+		key, buckets = h.Next(buckets[:0])
+		answer.highlowcontainer.appendContainer(key, orBuckets(buckets), false)
+	}
+	return answer
+}
+
+// HeapXor computes the symmetric difference between many bitmaps quickly (as
+// opposed to calling Xor repeatedly). The buckets sharing a key are found with
+// a heap and combined with roaring.HeapXor.
+func HeapXor(bitmaps ...*Bitmap) *Bitmap {
+	h := newBucketHeap(bitmaps...)
+	buckets := make([]*roaring.Bitmap, 0, len(bitmaps))
+	answer := NewBitmap()
+	for h.Len() > 0 {
+		var key uint32
+		key, buckets = h.Next(buckets[:0])
+		if bucket := xorBuckets(buckets); !bucket.IsEmpty() {
+			answer.highlowcontainer.appendContainer(key, bucket, false)
+		}
+	}
+	return answer
+}
+
+// AndAny provides a result equivalent to rb.And(FastOr(bitmaps)), without
+// building the union: every bucket of rb is intersected, with the AndAny
+// method of 32-bit bitmaps, with the buckets the bitmaps hold for its key.
+func (rb *Bitmap) AndAny(bitmaps ...*Bitmap) {
+	if len(bitmaps) == 0 || rb.IsEmpty() {
+		return
+	}
+	ra := &rb.highlowcontainer
+	intersections := 0
+	forEachBucketWith(ra, bitmaps, 0, maxUint32, func(idx int, buckets []*roaring.Bitmap) {
+		if len(buckets) == 0 {
+			return
+		}
+		bucket := ra.getWritableContainerAtIndex(idx)
+		bucket.AndAny(buckets...)
+		if !bucket.IsEmpty() {
+			ra.replaceKeyAndContainerAtIndex(intersections, ra.getKeyAtIndex(idx), bucket, false)
+			intersections++
+		}
+	})
+	ra.resize(intersections)
+}
+
+// orBuckets returns the union of buckets sharing a key, copying a lone bucket.
+func orBuckets(buckets []*roaring.Bitmap) *roaring.Bitmap {
+	if len(buckets) == 1 {
+		return buckets[0].Clone()
+	}
+	return roaring.FastOr(buckets...)
+}
+
+// xorBuckets returns the symmetric difference of buckets sharing a key,
+// copying a lone bucket.
+func xorBuckets(buckets []*roaring.Bitmap) *roaring.Bitmap {
+	if len(buckets) == 1 {
+		return buckets[0].Clone()
+	}
+	return roaring.HeapXor(buckets...)
+}
+
+// forEachBucketWith calls f with the index of every bucket of ra whose key
+// lies from start to last, along with the buckets the bitmaps hold for that
+// key, if any.
+func forEachBucketWith(ra *roaringArray64, bitmaps []*Bitmap, start, last uint32, f func(idx int, buckets []*roaring.Bitmap)) {
+	positions := make([]int, len(bitmaps))
+	for i, b := range bitmaps {
+		positions[i] = b.highlowcontainer.advanceUntil(start, -1)
+	}
+	buckets := make([]*roaring.Bitmap, 0, len(bitmaps))
+	for idx := ra.advanceUntil(start, -1); idx < ra.size() && ra.keys[idx] <= last; idx++ {
+		key := ra.keys[idx]
+		buckets = buckets[:0]
+		for i, b := range bitmaps {
+			bra := &b.highlowcontainer
+			pos := positions[i]
+			if pos < bra.size() && bra.keys[pos] < key {
+				pos = bra.advanceUntil(key, pos)
+				positions[i] = pos
+			}
+			if pos < bra.size() && bra.keys[pos] == key {
+				buckets = append(buckets, bra.containers[pos])
+			}
+		}
+		f(idx, buckets)
+	}
+}
+
+// ThresholdOr computes the values that are present in at least k of the
+// bitmaps. With k <= 1 this is the union and with k equal to the number of
+// bitmaps the intersection. Buckets sharing a key are combined with
+// roaring.ThresholdOr, which counts occurrences with bit-sliced counters.
+func ThresholdOr(k int, bitmaps ...*Bitmap) *Bitmap {
+	if k <= 1 {
+		return FastOr(bitmaps...)
+	} else if k > len(bitmaps) {
+		return NewBitmap()
+	} else if k == len(bitmaps) {
+		return FastAnd(bitmaps...)
+	}
+
+	h := newBucketHeap(bitmaps...)
+	buckets := make([]*roaring.Bitmap, 0, len(bitmaps))
+	answer := NewBitmap()
+	for h.Len() > 0 {
+		var key uint32
+		key, buckets = h.Next(buckets[:0])
+		if len(buckets) < k {
+			continue
+		}
+		if bucket := roaring.ThresholdOr(k, buckets...); !bucket.IsEmpty() {
+			answer.highlowcontainer.appendContainer(key, bucket, false)
+		}
+	}
+	return answer
+}
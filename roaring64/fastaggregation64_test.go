@@ -6,6 +6,7 @@ import (
 	"slices"
 	"testing"
 
+	"github.com/RoaringBitmap/roaring/v2"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -70,3 +71,12 @@ func TestIssue330_64bits(t *testing.T) {
 	assert.Equal(t, FastOr(bitmaps[2], bitmaps[1], bitmaps[0]).GetCardinality(), uint64(1040))
 	assert.Equal(t, FastOr(bitmaps[0], bitmaps[1], bitmaps[2]).GetCardinality(), uint64(1040))
 }
+
+func TestGenericFastAggregations(t *testing.T) {
+	a, b, c := BitmapOf(1, 2, 3<<40), BitmapOf(2, 3<<40, 1<<60), BitmapOf(2, 3<<40, 4)
+	assert.True(t, FastOr(a, b, c).Equals(roaring.GenericFastOr(a, b, c)))
+	assert.True(t, FastAnd(a, b, c).Equals(roaring.GenericFastAnd(a, b, c)))
+	assert.True(t, FastOr(a, b).Equals(a.FastOrWith(b)))
+	assert.True(t, a.Equals(a.FastAndWith()))
+	assert.Equal(t, []uint64{1, 2, 3 << 40}, a.ToArray())
+}
@@ -29,3 +29,49 @@ func Backward(b *Bitmap) iter.Seq[uint64] {
 		}
 	}
 }
+
+// Unset creates an iterator that yields values in the range [min, max] that are NOT contained in the bitmap.
+// The iterator becomes invalid if the bitmap is modified (e.g., with Add or Remove).
+func Unset(b *Bitmap, min, max uint64) iter.Seq[uint64] {
+	return func(yield func(uint64) bool) {
+		it := b.UnsetIterator(min, max)
+		for it.HasNext() {
+			if !yield(it.Next()) {
+				return
+			}
+		}
+	}
+}
+
+// Ranges iterates contiguous ranges of values present in the bitmap as
+// inclusive [start, last] pairs: unlike the 32-bit version, an exclusive end
+// could not represent ranges that include the largest uint64. Ranges
+// spanning container and bucket boundaries are merged.
+func (b *Bitmap) Ranges() iter.Seq2[uint64, uint64] {
+	return func(yield func(uint64, uint64) bool) {
+		ra := &b.highlowcontainer
+
+		var pendingStart, pendingLast uint64
+		hasPending := false
+
+		for idx, c := range ra.containers {
+			hs := uint64(ra.keys[idx]) << 32
+			for start, end := range c.Ranges() {
+				rStart, rLast := hs|uint64(start), hs+end-1
+				if hasPending && pendingLast+1 == rStart {
+					pendingLast = rLast
+					continue
+				}
+				if hasPending && !yield(pendingStart, pendingLast) {
+					return
+				}
+				pendingStart, pendingLast = rStart, rLast
+				hasPending = true
+			}
+		}
+
+		if hasPending {
+			yield(pendingStart, pendingLast)
+		}
+	}
+}
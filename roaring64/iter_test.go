@@ -120,3 +120,83 @@ func TestValues(t *testing.T) {
 
 	assert.Equal(t, testSize, n)
 }
+
+func rangesTestBitmap() *Bitmap {
+	b := New()
+	b.Add(0)
+	b.AddRange(10, 20)
+	b.AddRange(1<<32-5, 1<<32+5) // crosses a bucket boundary
+	b.AddRange(2<<32, 2<<32+1<<16)
+	b.Add(2<<32 + 1<<16 + 1)
+	b.AddRange(math.MaxUint64-3, math.MaxUint64)
+	b.Add(math.MaxUint64)
+	return b
+}
+
+func TestRanges(t *testing.T) {
+	b := rangesTestBitmap()
+	var ranges [][2]uint64
+	for start, last := range b.Ranges() {
+		ranges = append(ranges, [2]uint64{start, last})
+	}
+	assert.Equal(t, [][2]uint64{
+		{0, 0},
+		{10, 19},
+		{1<<32 - 5, 1<<32 + 4},
+		{2 << 32, 2<<32 + 1<<16 - 1},
+		{2<<32 + 1<<16 + 1, 2<<32 + 1<<16 + 1},
+		{math.MaxUint64 - 3, math.MaxUint64},
+	}, ranges)
+
+	// early exit
+	count := 0
+	for range b.Ranges() {
+		count++
+		if count == 2 {
+			break
+		}
+	}
+	assert.Equal(t, 2, count)
+
+	for range New().Ranges() {
+		t.Fatal("empty bitmap has no range")
+	}
+}
+
+func TestUnset(t *testing.T) {
+	b := rangesTestBitmap()
+	for _, window := range [][2]uint64{
+		{0, 25},
+		{1<<32 - 10, 1<<32 + 10},
+		{2<<32 + 1<<16 - 3, 2<<32 + 1<<16 + 5},
+		{math.MaxUint64 - 10, math.MaxUint64},
+	} {
+		var expected, actual []uint64
+		for x := window[0]; ; x++ {
+			if !b.Contains(x) {
+				expected = append(expected, x)
+			}
+			if x == window[1] {
+				break
+			}
+		}
+		for x := range Unset(b, window[0], window[1]) {
+			actual = append(actual, x)
+		}
+		assert.Equal(t, expected, actual, window)
+	}
+
+	it := b.UnsetIterator(0, math.MaxUint64)
+	assert.Equal(t, uint64(1), it.PeekNext())
+	it.AdvanceIfNeeded(15)
+	assert.Equal(t, uint64(20), it.Next())
+	it.AdvanceIfNeeded(1<<32 - 6)
+	assert.Equal(t, uint64(1<<32-6), it.Next())
+	assert.Equal(t, uint64(1<<32+5), it.Next())
+	it.AdvanceIfNeeded(2 << 32)
+	assert.Equal(t, uint64(2<<32+1<<16), it.Next())
+	it.AdvanceIfNeeded(math.MaxUint64 - 5)
+	assert.Equal(t, uint64(math.MaxUint64-5), it.Next())
+	assert.Equal(t, uint64(math.MaxUint64-4), it.Next())
+	assert.False(t, it.HasNext())
+}
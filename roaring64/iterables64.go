@@ -1,6 +1,8 @@
 package roaring64
 
 import (
+	"math"
+
 	"github.com/RoaringBitmap/roaring/v2"
 )
 
@@ -212,3 +214,68 @@ func newManyIntIterator(a *Bitmap) *manyIntIterator {
 	p.Initialize(a)
 	return p
 }
+
+// unsetIterator iterates over the values of a range that are missing from
+// a bitmap, one gap between present values at a time.
+type unsetIterator struct {
+	rb      *Bitmap
+	cur     uint64 // next value, valid if hasNext
+	gapLast uint64 // last value of the gap holding cur
+	max     uint64
+	hasNext bool
+}
+
+// seek positions the iterator on the first missing value that is at least x.
+func (ui *unsetIterator) seek(x uint64) {
+	cur, ok := ui.rb.NextAbsentValue(x)
+	if !ok || cur > ui.max {
+		ui.hasNext = false
+		return
+	}
+	ui.cur = cur
+	ui.hasNext = true
+	if present, ok := ui.rb.NextValue(cur); ok {
+		ui.gapLast = present - 1
+	} else {
+		ui.gapLast = math.MaxUint64
+	}
+}
+
+// HasNext returns true if there are more integers to iterate over
+func (ui *unsetIterator) HasNext() bool {
+	return ui.hasNext
+}
+
+// Next returns the next integer
+func (ui *unsetIterator) Next() uint64 {
+	x := ui.cur
+	switch {
+	case x == ui.max:
+		ui.hasNext = false
+	case x < ui.gapLast:
+		ui.cur++
+	default:
+		ui.seek(x + 1)
+	}
+	return x
+}
+
+// PeekNext peeks the next value without advancing the iterator
+func (ui *unsetIterator) PeekNext() uint64 {
+	return ui.cur
+}
+
+// AdvanceIfNeeded advances as long as the next value is smaller than minval
+func (ui *unsetIterator) AdvanceIfNeeded(minval uint64) {
+	if !ui.hasNext || minval <= ui.cur {
+		return
+	}
+	if minval <= ui.gapLast {
+		ui.cur = minval
+		if ui.cur > ui.max {
+			ui.hasNext = false
+		}
+		return
+	}
+	ui.seek(minval)
+}
@@ -0,0 +1,55 @@
+package roaring64
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMappedBitmap(t *testing.T) {
+	rb := BitmapOf(1, 2, 3, 1<<32, 5<<40)
+	rb.AddRange(7<<32, 7<<32+100000)
+	rb.RunOptimize()
+	buf, err := rb.ToBytes()
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "bitmap.bin")
+	require.NoError(t, os.WriteFile(path, buf, 0o600))
+
+	mb, err := OpenMappedBitmap(path)
+	require.NoError(t, err)
+
+	var derived *Bitmap
+	assert.NoError(t, mb.View(func(mapped *Bitmap) error {
+		assert.True(t, rb.Equals(mapped))
+
+		// mutations must copy the buckets rather than write to the mapping
+		mapped.Add(7)
+		mapped.RemoveRange(7<<32, 7<<32+10)
+		assert.True(t, mapped.Contains(7))
+		assert.False(t, mapped.Contains(7<<32))
+
+		derived = Or(mapped, BitmapOf(8))
+		derived.CloneCopyOnWriteContainers()
+		return nil
+	}))
+	// the changes made by a View call stay in it
+	assert.NoError(t, mb.View(func(mapped *Bitmap) error {
+		assert.True(t, rb.Equals(mapped))
+		return nil
+	}))
+
+	require.NoError(t, mb.Close())
+	assert.True(t, derived.Contains(7<<32+10))
+	assert.Equal(t, rb.GetCardinality()-10+2, derived.GetCardinality())
+
+	assert.ErrorIs(t, mb.View(func(*Bitmap) error { return nil }), ErrMappingClosed)
+	assert.ErrorIs(t, mb.Close(), ErrMappingClosed)
+
+	reloaded, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, buf, reloaded)
+}
@@ -1,22 +1,156 @@
 package roaring64
 
 import (
+	"container/heap"
+	"context"
 	"fmt"
-	"runtime"
+	"sync"
 
 	"github.com/RoaringBitmap/roaring/v2"
 )
 
-var defaultWorkerCount = runtime.NumCPU()
+type bucketKey struct {
+	key    uint32
+	idx    int
+	bitmap *Bitmap
+}
+
+type bucketHeap []bucketKey
+
+func (h bucketHeap) Len() int           { return len(h) }
+func (h bucketHeap) Less(i, j int) bool { return h[i].key < h[j].key }
+func (h bucketHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *bucketHeap) Push(x interface{}) {
+	*h = append(*h, x.(bucketKey))
+}
+
+func (h *bucketHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[0 : n-1]
+	return x
+}
+
+func (h bucketHeap) Peek() bucketKey {
+	return h[0]
+}
+
+func (h *bucketHeap) popIncrementing() (key uint32, bucket *roaring.Bitmap) {
+	k := h.Peek()
+	key = k.key
+	bucket = k.bitmap.highlowcontainer.containers[k.idx]
+
+	newIdx := k.idx + 1
+	if newIdx < k.bitmap.highlowcontainer.size() {
+		(*h)[0] = bucketKey{
+			k.bitmap.highlowcontainer.keys[newIdx],
+			newIdx,
+			k.bitmap,
+		}
+		heap.Fix(h, 0)
+	} else {
+		heap.Pop(h)
+	}
+
+	return
+}
+
+// Next appends to buckets the 32-bit bitmaps of all the bitmaps sharing the
+// smallest remaining key, and returns that key along with the buckets.
+func (h *bucketHeap) Next(buckets []*roaring.Bitmap) (uint32, []*roaring.Bitmap) {
+	key, bucket := h.popIncrementing()
+	buckets = append(buckets, bucket)
+
+	for h.Len() > 0 && key == h.Peek().key {
+		_, bucket = h.popIncrementing()
+		buckets = append(buckets, bucket)
+	}
+
+	return key, buckets
+}
+
+func newBucketHeap(bitmaps ...*Bitmap) bucketHeap {
+	h := make(bucketHeap, 0, len(bitmaps))
+	for _, bitmap := range bitmaps {
+		if !bitmap.IsEmpty() {
+			h = append(h, bucketKey{bitmap.highlowcontainer.keys[0], 0, bitmap})
+		}
+	}
+
+	heap.Init(&h)
+
+	return h
+}
+
+// newBucketHeapFrom is newBucketHeap skipping the keys lower than start.
+func newBucketHeapFrom(start uint32, bitmaps ...*Bitmap) bucketHeap {
+	h := make(bucketHeap, 0, len(bitmaps))
+	for _, bitmap := range bitmaps {
+		ra := &bitmap.highlowcontainer
+		if idx := ra.advanceUntil(start, -1); idx < ra.size() {
+			h = append(h, bucketKey{ra.keys[idx], idx, bitmap})
+		}
+	}
+	heap.Init(&h)
+	return h
+}
+
+// Pool runs the work of the parallel operations of this package on the
+// workers of a roaring.Pool, which 32-bit operations can share, see
+// roaring.Pool.
+type Pool struct {
+	*roaring.Pool
+}
+
+// DefaultPool returns the pool that the parallel operations of the package
+// (ParOr, ParAnd...) run on, which shares the workers of
+// roaring.DefaultPool.
+func DefaultPool() *Pool {
+	return &Pool{roaring.DefaultPool()}
+}
+
+// NewPool starts a pool of the given number of workers (one per CPU if it is
+// 0 or less). It should be closed once it is no longer needed.
+func NewPool(workers int) *Pool {
+	return &Pool{roaring.NewPool(workers)}
+}
+
+// parallelism returns the number of tasks an operation asking for the given
+// parallelism should use, where 0 stands for as many as the pool has workers.
+func (p *Pool) parallelism(parallelism int) int {
+	if parallelism <= 0 {
+		return p.Workers()
+	}
+	return parallelism
+}
 
 // ParOr computes the union (OR) of all provided bitmaps in parallel,
 // where the parameter "parallelism" determines how many workers are to be used
 // (if it is set to 0, a default number of workers is chosen)
 func ParOr(parallelism int, bitmaps ...*Bitmap) *Bitmap {
+	bitmap, _ := ParOrContext(context.Background(), parallelism, bitmaps...)
+	return bitmap
+}
+
+// ParOrContext is ParOr stopping early when ctx is done: no more key ranges
+// are handed to the workers, the workers skip those already handed to them,
+// and ctx.Err() is returned once they have all returned.
+func ParOrContext(ctx context.Context, parallelism int, bitmaps ...*Bitmap) (*Bitmap, error) {
+	return DefaultPool().ParOr(ctx, parallelism, bitmaps...)
+}
+
+// ParOr is ParOrContext running on the workers of the pool.
+func (p *Pool) ParOr(ctx context.Context, parallelism int, bitmaps ...*Bitmap) (*Bitmap, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	var lKey uint32 = maxUint32
 	var hKey uint32
 
-	bitmapsFiltered := bitmaps[:0]
+	bitmapsFiltered := make([]*Bitmap, 0, len(bitmaps))
 	for _, b := range bitmaps {
 		if !b.IsEmpty() {
 			bitmapsFiltered = append(bitmapsFiltered, b)
@@ -30,27 +164,46 @@ func ParOr(parallelism int, bitmaps ...*Bitmap) *Bitmap {
 	}
 
 	if lKey == maxUint32 && hKey == 0 {
-		return New()
+		return New(), nil
 	} else if len(bitmaps) == 1 {
-		return bitmaps[0]
+		return bitmaps[0], nil
 	}
-	// The following might overflow and we do not want that!
-	// as it might lead to a channel of size 0 later which,
-	// on some systems, would block indefinitely.
-	keyRange := uint64(hKey) - uint64(lKey) + 1
-	if keyRange == 1 {
+	if lKey == hKey {
 		// All bitmaps have the same key,
 		// we can merge the 32-bit roaring bitmaps in parallel
 		var bms32s = make([]*roaring.Bitmap, 0, len(bitmaps))
 		for _, b := range bitmaps {
 			bms32s = append(bms32s, b.highlowcontainer.containers...)
 		}
-		return roaring32AsRoaring64(roaring.ParOr(parallelism, bms32s...), lKey)
+		bm32, err := p.Pool.ParOr(ctx, parallelism, bms32s...)
+		if err != nil {
+			return nil, err
+		}
+		return roaring32AsRoaring64(bm32, lKey), nil
 	}
 
-	if parallelism == 0 {
-		parallelism = defaultWorkerCount
-	}
+	return p.parOnRanges(ctx, parallelism, lKey, hKey, func(start, end uint32) *roaringArray64 {
+		ra := orOnRange(&bitmaps[0].highlowcontainer, &bitmaps[1].highlowcontainer, start, end)
+		for _, b := range bitmaps[2:] {
+			ra = iorOnRange(ra, &b.highlowcontainer, start, end)
+		}
+		return ra
+	})
+}
+
+// parOnRanges cuts the keys from lKey to hKey into ranges, has the tasks of
+// the pool compute the buckets of every range with onRange, and concatenates
+// them into a bitmap. When ctx is done, no more ranges are handed to the
+// tasks, the tasks skip those already handed to them, and ctx.Err() is
+// returned once they are done.
+func (p *Pool) parOnRanges(ctx context.Context, parallelism int, lKey, hKey uint32,
+	onRange func(start, end uint32) *roaringArray64) (*Bitmap, error) {
+
+	// The following might overflow and we do not want that!
+	// as it might lead to a channel of size 0 later which,
+	// on some systems, would block indefinitely.
+	keyRange := uint64(hKey) - uint64(lKey) + 1
+	parallelism = p.parallelism(parallelism)
 	// We cannot use int since int is 32-bit on 32-bit systems.
 	var chunkSize int64
 	var chunkCount int64
@@ -70,44 +223,42 @@ func ParOr(parallelism int, bitmaps ...*Bitmap) *Bitmap {
 	chunks := make([]*roaringArray64, chunkCount)
 
 	chunkSpecChan := make(chan parChunkSpec, minOfInt(maxOfInt(64, 2*parallelism), int(chunkCount)))
-	chunkChan := make(chan parChunk, minOfInt(32, int(chunkCount)))
 
-	orFunc := func() {
+	var wg sync.WaitGroup
+	rangeFunc := func() {
+		defer wg.Done()
 		for spec := range chunkSpecChan {
-			ra := orOnRange(&bitmaps[0].highlowcontainer, &bitmaps[1].highlowcontainer, spec.start, spec.end)
-			for _, b := range bitmaps[2:] {
-				ra = iorOnRange(ra, &b.highlowcontainer, spec.start, spec.end)
+			if ctx.Err() != nil {
+				continue
 			}
-
-			chunkChan <- parChunk{ra, spec.idx}
+			chunks[spec.idx] = onRange(spec.start, spec.end)
 		}
 	}
 
+	wg.Add(parallelism)
 	for i := 0; i < parallelism; i++ {
-		go orFunc()
+		p.Go(rangeFunc)
 	}
 
-	go func() {
-		for i := int64(0); i < chunkCount; i++ {
-			spec := parChunkSpec{
-				start: uint32(int64(lKey) + i*chunkSize),
-				end:   uint32(minOfInt64(int64(lKey)+(i+1)*chunkSize-1, int64(hKey))),
-				idx:   int(i),
-			}
-			chunkSpecChan <- spec
+dispatch:
+	for i := int64(0); i < chunkCount; i++ {
+		spec := parChunkSpec{
+			start: uint32(int64(lKey) + i*chunkSize),
+			end:   uint32(minOfInt64(int64(lKey)+(i+1)*chunkSize-1, int64(hKey))),
+			idx:   int(i),
 		}
-	}()
-
-	chunksRemaining := chunkCount
-	for chunk := range chunkChan {
-		chunks[chunk.idx] = chunk.ra
-		chunksRemaining--
-		if chunksRemaining == 0 {
-			break
+		select {
+		case chunkSpecChan <- spec:
+		case <-ctx.Done():
+			break dispatch
 		}
 	}
-	close(chunkChan)
 	close(chunkSpecChan)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	containerCount := 0
 	for _, chunk := range chunks {
@@ -130,22 +281,279 @@ func ParOr(parallelism int, bitmaps ...*Bitmap) *Bitmap {
 		resultOffset += chunk.size()
 	}
 
-	return &result
+	return &result, nil
 }
 
-type parChunkSpec struct {
-	start uint32
-	end   uint32
-	idx   int
+// ParThresholdOr computes the values that are present in at least k of the
+// bitmaps in parallel, see ThresholdOr, where the parameter "parallelism"
+// determines how many workers are to be used (if it is set to 0, a default
+// number of workers is chosen)
+func ParThresholdOr(parallelism int, k int, bitmaps ...*Bitmap) *Bitmap {
+	bitmap, _ := DefaultPool().ParThresholdOr(context.Background(), parallelism, k, bitmaps...)
+	return bitmap
+}
+
+// ParThresholdOr is ParThresholdOr running on the workers of the pool, and
+// stopping early when ctx is done, see ParOrContext.
+func (p *Pool) ParThresholdOr(ctx context.Context, parallelism int, k int, bitmaps ...*Bitmap) (*Bitmap, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if k <= 1 {
+		return p.ParOr(ctx, parallelism, bitmaps...)
+	} else if k > len(bitmaps) {
+		return NewBitmap(), nil
+	} else if k == len(bitmaps) {
+		return p.ParAnd(ctx, parallelism, bitmaps...)
+	}
+
+	return p.parBuckets(ctx, parallelism, bitmaps, k, func(buckets ...*roaring.Bitmap) *roaring.Bitmap {
+		return roaring.ThresholdOr(k, buckets...)
+	})
+}
+
+// ParHeapOr computes the union (OR) of all provided bitmaps in parallel,
+// where the parameter "parallelism" determines how many workers are to be used
+// (if it is set to 0, a default number of workers is chosen)
+// ParHeapOr merges the buckets sharing a key with roaring.FastOr, one key per
+// task, where ParOr splits the key space into ranges. For many bitmaps
+// sharing few keys it might be faster than ParOr
+func ParHeapOr(parallelism int, bitmaps ...*Bitmap) *Bitmap {
+	bitmap, _ := ParHeapOrContext(context.Background(), parallelism, bitmaps...)
+	return bitmap
+}
+
+// ParHeapOrContext is ParHeapOr stopping early when ctx is done: no more
+// buckets are handed to the workers, the workers skip those already handed to
+// them, and ctx.Err() is returned once they have all returned.
+func ParHeapOrContext(ctx context.Context, parallelism int, bitmaps ...*Bitmap) (*Bitmap, error) {
+	return DefaultPool().ParHeapOr(ctx, parallelism, bitmaps...)
+}
+
+// ParHeapOr is ParHeapOrContext running on the workers of the pool.
+func (p *Pool) ParHeapOr(ctx context.Context, parallelism int, bitmaps ...*Bitmap) (*Bitmap, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return p.parBuckets(ctx, parallelism, bitmaps, 1, roaring.FastOr)
+}
+
+// ParAnd computes the intersection (AND) of all provided bitmaps in parallel,
+// where the parameter "parallelism" determines how many workers are to be used
+// (if it is set to 0, a default number of workers is chosen)
+func ParAnd(parallelism int, bitmaps ...*Bitmap) *Bitmap {
+	bitmap, _ := ParAndContext(context.Background(), parallelism, bitmaps...)
+	return bitmap
+}
+
+// ParAndContext is ParAnd stopping early when ctx is done, see
+// ParHeapOrContext.
+func ParAndContext(ctx context.Context, parallelism int, bitmaps ...*Bitmap) (*Bitmap, error) {
+	return DefaultPool().ParAnd(ctx, parallelism, bitmaps...)
+}
+
+// ParAnd is ParAndContext running on the workers of the pool.
+func (p *Pool) ParAnd(ctx context.Context, parallelism int, bitmaps ...*Bitmap) (*Bitmap, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(bitmaps) == 0 {
+		return NewBitmap(), nil
+	}
+	return p.parBuckets(ctx, parallelism, bitmaps, len(bitmaps), roaring.FastAnd)
+}
+
+// parBuckets combines, on the pool, the buckets that the bitmaps share for
+// every key held by at least minCount of them, and assembles the non-empty
+// results into a bitmap. A lone bucket is copied rather than handed to
+// combine. When ctx is done, no more keys are handed to the tasks, the tasks
+// skip those already handed to them, and ctx.Err() is returned once they are
+// done.
+func (p *Pool) parBuckets(ctx context.Context, parallelism int, bitmaps []*Bitmap, minCount int,
+	combine func(buckets ...*roaring.Bitmap) *roaring.Bitmap) (*Bitmap, error) {
+	type bucketGroup struct {
+		key     uint32
+		buckets []*roaring.Bitmap
+	}
+	var groups []bucketGroup
+	h := newBucketHeap(bitmaps...)
+	for h.Len() > 0 {
+		key, buckets := h.Next(make([]*roaring.Bitmap, 0, minCount))
+		if len(buckets) >= minCount {
+			groups = append(groups, bucketGroup{key, buckets})
+		}
+	}
+
+	parallelism = p.parallelism(parallelism)
+	results := make([]*roaring.Bitmap, len(groups))
+	idxChan := make(chan int, minOfInt(maxOfInt(64, 2*parallelism), len(groups)))
+	var wg sync.WaitGroup
+	wg.Add(parallelism)
+	for i := 0; i < parallelism; i++ {
+		p.Go(func() {
+			defer wg.Done()
+			for idx := range idxChan {
+				if ctx.Err() == nil {
+					results[idx] = combine(groups[idx].buckets...)
+				}
+			}
+		})
+	}
+dispatch:
+	for idx, group := range groups {
+		if len(group.buckets) == 1 {
+			results[idx] = group.buckets[0].Clone()
+			continue
+		}
+		select {
+		case idxChan <- idx:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(idxChan)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	answer := NewBitmap()
+	for idx, bucket := range results {
+		if !bucket.IsEmpty() {
+			answer.highlowcontainer.appendContainer(groups[idx].key, bucket, false)
+		}
+	}
+	return answer, nil
 }
 
-type parChunk struct {
-	ra  *roaringArray64
-	idx int
+// ParXor computes the symmetric difference (XOR) of all provided bitmaps in
+// parallel, where the parameter "parallelism" determines how many workers are
+// to be used (if it is set to 0, a default number of workers is chosen)
+func ParXor(parallelism int, bitmaps ...*Bitmap) *Bitmap {
+	bitmap, _ := DefaultPool().ParXor(context.Background(), parallelism, bitmaps...)
+	return bitmap
 }
 
-func (c parChunk) size() int {
-	return c.ra.size()
+// ParXor is ParXor running on the workers of the pool, and stopping early
+// when ctx is done, see ParOrContext.
+func (p *Pool) ParXor(ctx context.Context, parallelism int, bitmaps ...*Bitmap) (*Bitmap, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var lKey uint32 = maxUint32
+	var hKey uint32
+
+	bitmapsFiltered := make([]*Bitmap, 0, len(bitmaps))
+	for _, b := range bitmaps {
+		if !b.IsEmpty() {
+			bitmapsFiltered = append(bitmapsFiltered, b)
+			lKey = minOfUint32(lKey, b.highlowcontainer.keys[0])
+			hKey = maxOfUint32(hKey, b.highlowcontainer.keys[b.highlowcontainer.size()-1])
+		}
+	}
+	bitmaps = bitmapsFiltered
+
+	if len(bitmaps) == 0 {
+		return NewBitmap(), nil
+	} else if len(bitmaps) == 1 {
+		return bitmaps[0].Clone(), nil
+	}
+
+	return p.parOnRanges(ctx, parallelism, lKey, hKey, func(start, end uint32) *roaringArray64 {
+		answer := &roaringArray64{}
+		h := newBucketHeapFrom(start, bitmaps...)
+		buckets := make([]*roaring.Bitmap, 0, len(bitmaps))
+		for h.Len() > 0 && h.Peek().key <= end {
+			var key uint32
+			key, buckets = h.Next(buckets[:0])
+			if bucket := xorBuckets(buckets); !bucket.IsEmpty() {
+				answer.appendContainer(key, bucket, false)
+			}
+		}
+		return answer
+	})
+}
+
+// ParAndNot computes the values of x that none of the provided bitmaps hold,
+// that is AndNot(x, FastOr(bitmaps...)), in parallel, where the parameter
+// "parallelism" determines how many workers are to be used (if it is set to
+// 0, a default number of workers is chosen)
+func ParAndNot(parallelism int, x *Bitmap, bitmaps ...*Bitmap) *Bitmap {
+	bitmap, _ := DefaultPool().ParAndNot(context.Background(), parallelism, x, bitmaps...)
+	return bitmap
+}
+
+// ParAndNot is ParAndNot running on the workers of the pool, and stopping
+// early when ctx is done, see ParOrContext.
+func (p *Pool) ParAndNot(ctx context.Context, parallelism int, x *Bitmap, bitmaps ...*Bitmap) (*Bitmap, error) {
+	return p.parFilter(ctx, parallelism, x, bitmaps, func(bucket *roaring.Bitmap, others []*roaring.Bitmap) *roaring.Bitmap {
+		if len(others) == 0 {
+			return bucket.Clone()
+		}
+		bucket = roaring.AndNot(bucket, others[0])
+		for _, next := range others[1:] {
+			bucket.AndNot(next)
+		}
+		return bucket
+	})
+}
+
+// ParAndAny computes the values of x that at least one of the provided
+// bitmaps holds, that is And(x, FastOr(bitmaps...)), in parallel, where the
+// parameter "parallelism" determines how many workers are to be used (if it
+// is set to 0, a default number of workers is chosen). As with the AndAny
+// method of 32-bit bitmaps, x is returned unchanged (here, as a copy) when no
+// bitmap is provided.
+func ParAndAny(parallelism int, x *Bitmap, bitmaps ...*Bitmap) *Bitmap {
+	bitmap, _ := DefaultPool().ParAndAny(context.Background(), parallelism, x, bitmaps...)
+	return bitmap
+}
+
+// ParAndAny is ParAndAny running on the workers of the pool, and stopping
+// early when ctx is done, see ParOrContext.
+func (p *Pool) ParAndAny(ctx context.Context, parallelism int, x *Bitmap, bitmaps ...*Bitmap) (*Bitmap, error) {
+	return p.parFilter(ctx, parallelism, x, bitmaps, func(bucket *roaring.Bitmap, others []*roaring.Bitmap) *roaring.Bitmap {
+		if len(others) == 0 {
+			return nil
+		}
+		bucket = bucket.Clone()
+		bucket.AndAny(others...)
+		return bucket
+	})
+}
+
+// parFilter computes on the pool, for every bucket of x, the bucket
+// returned by combine from it and the buckets the bitmaps hold for the same
+// key, if any; combine returns nil or an empty bitmap for an empty result.
+// x is copied when no bitmap is provided.
+func (p *Pool) parFilter(ctx context.Context, parallelism int, x *Bitmap, bitmaps []*Bitmap,
+	combine func(bucket *roaring.Bitmap, others []*roaring.Bitmap) *roaring.Bitmap) (*Bitmap, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if x.IsEmpty() {
+		return NewBitmap(), nil
+	} else if len(bitmaps) == 0 {
+		return x.Clone(), nil
+	}
+
+	ra := &x.highlowcontainer
+	return p.parOnRanges(ctx, parallelism, ra.keys[0], ra.keys[ra.size()-1], func(start, end uint32) *roaringArray64 {
+		answer := &roaringArray64{}
+		forEachBucketWith(ra, bitmaps, start, end, func(idx int, others []*roaring.Bitmap) {
+			if bucket := combine(ra.containers[idx], others); bucket != nil && !bucket.IsEmpty() {
+				answer.appendContainer(ra.keys[idx], bucket, false)
+			}
+		})
+		return answer
+	})
+}
+
+type parChunkSpec struct {
+	start uint32
+	end   uint32
+	idx   int
 }
 
 // parNaiveStartAt returns the index of the first key that is inclusive between start and last
@@ -0,0 +1,201 @@
+package roaring64
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/RoaringBitmap/roaring/v2"
+)
+
+/* PATCH FORMAT DESCRIPTION (64-bit)
+ *
+ * <header>   uint32_t patchCookie64,
+ *            uint64_t Checksum of the old bitmap,
+ *            uint64_t Checksum of the new bitmap
+ * <removed>  uint32_t number of removed buckets,
+ *            uint32_t[] their keys, in increasing order
+ * <patched>  uint32_t number of added or modified buckets, then for each of
+ *            them, in increasing key order:
+ *              uint32_t key, uint64_t length in bytes,
+ *              the 32-bit patch (roaring.Diff) turning the old bucket, or an
+ *              empty bitmap for new buckets, into the new one
+ *
+ * All integers are little endian. Since modified buckets are patched
+ * rather than replaced, only the 16-bit containers that changed are sent.
+ */
+const (
+	patchCookie64     = 0x38504252 // "RBP8" in little endian
+	patchHeaderSize64 = 20
+)
+
+var (
+	// ErrPatchInvalidCookie is returned when the input is not a patch.
+	ErrPatchInvalidCookie = roaring.ErrPatchInvalidCookie
+	// ErrPatchCorrupted is returned when a patch is inconsistent.
+	ErrPatchCorrupted = roaring.ErrPatchCorrupted
+	// ErrPatchBaseMismatch is returned when a patch is applied to a bitmap
+	// other than the one it was computed from.
+	ErrPatchBaseMismatch = roaring.ErrPatchBaseMismatch
+	// ErrPatchChecksumMismatch is returned when the patched bitmap does not
+	// have the expected checksum.
+	ErrPatchChecksumMismatch = roaring.ErrPatchChecksumMismatch
+)
+
+// Diff computes a patch that turns old into new when applied with
+// ApplyPatch. Only the 16-bit containers that differ are part of the patch.
+// The patch records the Checksum of both bitmaps, so ApplyPatch can check
+// that it is applied to old and that it yields new.
+func Diff(old, new *Bitmap) ([]byte, error) {
+	var removed []uint32
+	var patched []byte
+	nPatched := uint32(0)
+
+	addPatch := func(key uint32, c1, c2 *roaring.Bitmap) error {
+		p, err := roaring.Diff(c1, c2)
+		if err != nil {
+			return err
+		}
+		patched = binary.LittleEndian.AppendUint32(patched, key)
+		patched = binary.LittleEndian.AppendUint64(patched, uint64(len(p)))
+		patched = append(patched, p...)
+		nPatched++
+		return nil
+	}
+
+	ra1, ra2 := &old.highlowcontainer, &new.highlowcontainer
+	pos1, pos2 := 0, 0
+	for pos1 < ra1.size() || pos2 < ra2.size() {
+		switch {
+		case pos2 == ra2.size() || (pos1 < ra1.size() && ra1.getKeyAtIndex(pos1) < ra2.getKeyAtIndex(pos2)):
+			removed = append(removed, ra1.getKeyAtIndex(pos1))
+			pos1++
+		case pos1 == ra1.size() || ra2.getKeyAtIndex(pos2) < ra1.getKeyAtIndex(pos1):
+			if err := addPatch(ra2.getKeyAtIndex(pos2), roaring.NewBitmap(), ra2.getContainerAtIndex(pos2)); err != nil {
+				return nil, err
+			}
+			pos2++
+		default:
+			c1, c2 := ra1.getContainerAtIndex(pos1), ra2.getContainerAtIndex(pos2)
+			if c1.Checksum() != c2.Checksum() || !c1.Equals(c2) {
+				if err := addPatch(ra2.getKeyAtIndex(pos2), c1, c2); err != nil {
+					return nil, err
+				}
+			}
+			pos1++
+			pos2++
+		}
+	}
+
+	buf := make([]byte, 0, patchHeaderSize64+4*len(removed)+4+len(patched))
+	buf = binary.LittleEndian.AppendUint32(buf, patchCookie64)
+	buf = binary.LittleEndian.AppendUint64(buf, old.Checksum())
+	buf = binary.LittleEndian.AppendUint64(buf, new.Checksum())
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(removed)))
+	for _, key := range removed {
+		buf = binary.LittleEndian.AppendUint32(buf, key)
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, nPatched)
+	return append(buf, patched...), nil
+}
+
+// ApplyPatch applies a patch computed by Diff(old, new) to the bitmap,
+// which must be equal to old: the bitmap then becomes equal to new.
+//
+// ApplyPatch returns ErrPatchBaseMismatch if the Checksum of the bitmap is
+// not the one of old, and ErrPatchChecksumMismatch if the result would not
+// have the Checksum of new. The bitmap is left unchanged on error.
+func (rb *Bitmap) ApplyPatch(patch []byte) error {
+	if len(patch) < patchHeaderSize64+4 {
+		return ErrPatchCorrupted
+	}
+	if binary.LittleEndian.Uint32(patch) != patchCookie64 {
+		return ErrPatchInvalidCookie
+	}
+	base := binary.LittleEndian.Uint64(patch[4:])
+	target := binary.LittleEndian.Uint64(patch[12:])
+	if rb.Checksum() != base {
+		return ErrPatchBaseMismatch
+	}
+
+	nRemoved := uint64(binary.LittleEndian.Uint32(patch[20:]))
+	patch = patch[patchHeaderSize64+4:]
+	if uint64(len(patch)) < 4*nRemoved+4 {
+		return ErrPatchCorrupted
+	}
+	removed := make([]uint32, nRemoved)
+	for i := range removed {
+		removed[i] = binary.LittleEndian.Uint32(patch[4*i:])
+		if i > 0 && removed[i-1] >= removed[i] {
+			return ErrPatchCorrupted
+		}
+	}
+	patch = patch[4*nRemoved:]
+	nPatched := binary.LittleEndian.Uint32(patch)
+	patch = patch[4:]
+
+	// nextPatch returns the key and the 32-bit patch of the next patched bucket
+	var lastKey uint32
+	nextPatch := func(i uint32) (uint32, []byte, error) {
+		if len(patch) < 12 {
+			return 0, nil, ErrPatchCorrupted
+		}
+		key := binary.LittleEndian.Uint32(patch)
+		length := binary.LittleEndian.Uint64(patch[4:])
+		if (i > 0 && key <= lastKey) || length > uint64(len(patch)-12) {
+			return 0, nil, ErrPatchCorrupted
+		}
+		p := patch[12 : 12+length]
+		patch = patch[12+length:]
+		lastKey = key
+		return key, p, nil
+	}
+
+	// merge into a new array so that the bitmap is untouched on error
+	answer := roaringArray64{
+		copyOnWrite: rb.highlowcontainer.copyOnWrite,
+		fastRank:    rb.highlowcontainer.fastRank,
+	}
+	ra := &rb.highlowcontainer
+	pos, posRemoved := 0, 0
+	for i := uint32(0); i < nPatched; i++ {
+		key, p, err := nextPatch(i)
+		if err != nil {
+			return err
+		}
+		for ; pos < ra.size() && ra.getKeyAtIndex(pos) < key; pos++ {
+			if posRemoved < len(removed) && removed[posRemoved] == ra.getKeyAtIndex(pos) {
+				posRemoved++
+				continue
+			}
+			answer.appendContainer(ra.getKeyAtIndex(pos), ra.getContainerAtIndex(pos), ra.needsCopyOnWrite(pos))
+		}
+		// patch a copy: the bucket may be shared, and must stay intact on error
+		c := roaring.NewBitmap()
+		if pos < ra.size() && ra.getKeyAtIndex(pos) == key {
+			c = ra.getContainerAtIndex(pos).Clone()
+			pos++
+		}
+		if err := c.ApplyPatch(p); err != nil {
+			return fmt.Errorf("bucket %d: %w", key, err)
+		}
+		answer.appendContainer(key, c, false)
+	}
+	for ; pos < ra.size(); pos++ {
+		if posRemoved < len(removed) && removed[posRemoved] == ra.getKeyAtIndex(pos) {
+			posRemoved++
+			continue
+		}
+		answer.appendContainer(ra.getKeyAtIndex(pos), ra.getContainerAtIndex(pos), ra.needsCopyOnWrite(pos))
+	}
+	// every removed key must be present, and not patched
+	if posRemoved != len(removed) || len(patch) != 0 {
+		return ErrPatchCorrupted
+	}
+
+	patched := Bitmap{highlowcontainer: answer}
+	if patched.Checksum() != target {
+		return ErrPatchChecksumMismatch
+	}
+	rb.highlowcontainer = answer
+	return nil
+}
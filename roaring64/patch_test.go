@@ -0,0 +1,98 @@
+package roaring64
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func patchTestBitmap() *Bitmap {
+	rb := NewBitmap()
+	for i := uint64(0); i < 10; i++ {
+		for j := uint64(0); j < 20; j++ {
+			rb.AddRange(i<<32|j<<16, i<<32|j<<16+j*300+1)
+		}
+	}
+	rb.RunOptimize()
+	return rb
+}
+
+func TestDiffApplyPatch(t *testing.T) {
+	old := patchTestBitmap()
+
+	updated := old.Clone()
+	updated.Add(3<<32 | 5<<16 | 7)          // modified container
+	updated.RemoveRange(4<<32, 5<<32)       // removed bucket
+	updated.Add(1 << 50)                    // new bucket
+	updated.RemoveRange(6<<32, 6<<32+1<<16) // removed container
+
+	patch, err := Diff(old, updated)
+	require.NoError(t, err)
+	full, err := updated.ToBytes()
+	require.NoError(t, err)
+	assert.Less(t, len(patch), len(full)/4)
+
+	rb := old.Clone()
+	require.NoError(t, rb.ApplyPatch(patch))
+	assert.True(t, updated.Equals(rb))
+	assert.Equal(t, updated.Checksum(), rb.Checksum())
+	require.NoError(t, rb.Validate())
+
+	assert.ErrorIs(t, rb.ApplyPatch(patch), ErrPatchBaseMismatch)
+	assert.True(t, updated.Equals(rb))
+
+	// the old bitmap is not affected by the patched one
+	rb.AddRange(0, 1<<40)
+	assert.True(t, old.Equals(patchTestBitmap()))
+}
+
+func TestDiffApplyPatchEdgeCases(t *testing.T) {
+	for _, pair := range [][2]*Bitmap{
+		{NewBitmap(), NewBitmap()},
+		{NewBitmap(), patchTestBitmap()},
+		{patchTestBitmap(), NewBitmap()},
+		{patchTestBitmap(), patchTestBitmap()},
+	} {
+		patch, err := Diff(pair[0], pair[1])
+		require.NoError(t, err)
+		rb := pair[0].Clone()
+		require.NoError(t, rb.ApplyPatch(patch))
+		assert.True(t, pair[1].Equals(rb))
+		assert.Equal(t, pair[1].Checksum(), rb.Checksum())
+	}
+}
+
+func TestApplyPatchErrors(t *testing.T) {
+	old := patchTestBitmap()
+	updated := old.Clone()
+	updated.Add(1 << 60)
+	updated.Remove(0)
+	patch, err := Diff(old, updated)
+	require.NoError(t, err)
+
+	rb := old.Clone()
+	assert.ErrorIs(t, rb.ApplyPatch(nil), ErrPatchCorrupted)
+	assert.ErrorIs(t, rb.ApplyPatch(make([]byte, 64)), ErrPatchInvalidCookie)
+	assert.ErrorIs(t, rb.ApplyPatch(patch[:len(patch)-1]), ErrPatchCorrupted)
+	assert.ErrorIs(t, rb.ApplyPatch(append(append([]byte(nil), patch...), 0)), ErrPatchCorrupted)
+
+	tampered := append([]byte(nil), patch...)
+	tampered[12] ^= 1
+	assert.ErrorIs(t, rb.ApplyPatch(tampered), ErrPatchChecksumMismatch)
+
+	assert.True(t, old.Equals(rb))
+	assert.Equal(t, old.Checksum(), rb.Checksum())
+}
+
+func TestChecksum(t *testing.T) {
+	a := patchTestBitmap()
+	b := patchTestBitmap()
+	assert.Equal(t, a.Checksum(), b.Checksum())
+	b.Add(1 << 40)
+	assert.NotEqual(t, a.Checksum(), b.Checksum())
+	b.Remove(1 << 40)
+	assert.Equal(t, a.Checksum(), b.Checksum())
+	assert.NotEqual(t, NewBitmap().Checksum(), BitmapOf(0).Checksum())
+	assert.NotEqual(t, BitmapOf(1<<32).Checksum(), BitmapOf(1).Checksum())
+}
@@ -22,6 +22,8 @@ type Bitmap struct {
 	highlowcontainer roaringArray64
 }
 
+var _ roaring.GenericBitmap[uint64, *Bitmap] = (*Bitmap)(nil)
+
 // ToBase64 serializes a bitmap as Base64
 func (rb *Bitmap) ToBase64() (string, error) {
 	buf := new(bytes.Buffer)
@@ -121,6 +123,7 @@ func (rb *Bitmap) FromUnsafeBytes(data []byte) (p int64, err error) {
 		if n == 0 || err != nil {
 			return n, fmt.Errorf("Could not deserialize bitmap for key #%d: %s", i, err)
 		}
+		rb.highlowcontainer.markFastRank(rb.highlowcontainer.containers[i])
 	}
 
 	return stream.GetReadBytes(), nil
@@ -169,6 +172,7 @@ func (rb *Bitmap) ReadFrom(stream io.Reader) (p int64, err error) {
 		if n == 0 || err != nil {
 			return n, fmt.Errorf("Could not deserialize bitmap for key #%d: %s", i, err)
 		}
+		rb.highlowcontainer.markFastRank(rb.highlowcontainer.containers[i])
 		p += n
 	}
 	return p, nil
@@ -277,6 +281,24 @@ func (rb *Bitmap) ReverseIterator() IntIterable64 {
 	return newIntReverseIterator(rb)
 }
 
+// Iterate iterates over the bitmap, calling the given callback with each value in the bitmap.  If the callback returns
+// false, the iteration is halted.
+// The iteration results are undefined if the bitmap is modified (e.g., with Add or Remove).
+// There is no guarantee as to what order the values will be iterated.
+func (rb *Bitmap) Iterate(cb func(x uint64) bool) {
+	for i, c := range rb.highlowcontainer.containers {
+		hs := uint64(rb.highlowcontainer.keys[i]) << 32
+		shouldContinue := true
+		c.Iterate(func(x uint32) bool {
+			shouldContinue = cb(uint64(x) | hs)
+			return shouldContinue
+		})
+		if !shouldContinue {
+			return
+		}
+	}
+}
+
 // ManyIterator creates a new ManyIntIterable to iterate over the integers contained in the bitmap, in sorted order;
 // the iterator becomes invalid if the bitmap is modified (e.g., with Add or Remove).
 func (rb *Bitmap) ManyIterator() ManyIntIterable64 {
@@ -318,6 +340,83 @@ func (rb *Bitmap) Equals(srb *Bitmap) bool {
 	return srb.highlowcontainer.equals(rb.highlowcontainer)
 }
 
+// Checksum computes a hash (FNV-1a) for a bitmap that is suitable for
+// using bitmaps as elements in hash sets or as keys in hash maps, as well as
+// generally quick comparisons. It hashes the keys, and then the Checksum of
+// every 32-bit bitmap.
+func (rb *Bitmap) Checksum() uint64 {
+	const (
+		offset = 14695981039346656037
+		prime  = 1099511628211
+	)
+
+	hash := uint64(offset)
+
+	// Hash the keys (uint32 slice), low byte first (little endian)
+	for _, key := range rb.highlowcontainer.keys {
+		for shift := 0; shift < 32; shift += 8 {
+			hash ^= uint64(key>>shift) & 0xFF
+			hash *= prime
+		}
+	}
+
+	for _, c := range rb.highlowcontainer.containers {
+		// 0 separator
+		hash ^= 0
+		hash *= prime
+
+		sum := c.Checksum()
+		for shift := 0; shift < 64; shift += 8 {
+			hash ^= (sum >> shift) & 0xFF
+			hash *= prime
+		}
+	}
+
+	return hash
+}
+
+// AddOffset adds the value 'offset' to each and every value in a bitmap, generating a new bitmap in the process.
+// If offset + element is outside of the range [0,2^64), the element is dropped.
+// Offsets need not be multiples of 2^32: buckets are shifted with the 32-bit
+// AddOffset64 and values carried past a bucket end go to the next bucket.
+func AddOffset(x *Bitmap, offset int64) (answer *Bitmap) {
+	// floor division, so that inOffset is in [0, 2^32)
+	bucketOffset := offset >> 32
+	inOffset := int64(uint32(offset))
+
+	answer = New()
+	ra := &answer.highlowcontainer
+	for pos := 0; pos < x.highlowcontainer.size(); pos++ {
+		key := int64(x.highlowcontainer.getKeyAtIndex(pos)) + bucketOffset
+		if key+1 < 0 || key > maxUint32 {
+			continue
+		}
+		c := x.highlowcontainer.getContainerAtIndex(pos)
+
+		if inOffset == 0 {
+			if key >= 0 {
+				ra.appendContainer(uint32(key), c.Clone(), false)
+			}
+			continue
+		}
+
+		// values below 2^32-inOffset stay in the bucket, the others move to the next one
+		if key >= 0 && int64(c.Minimum())+inOffset <= maxUint32 {
+			lo := roaring.AddOffset64(c, inOffset)
+			if last := ra.size() - 1; last >= 0 && int64(ra.getKeyAtIndex(last)) == key {
+				ra.getWritableContainerAtIndex(last).Or(lo)
+			} else {
+				ra.appendContainer(uint32(key), lo, false)
+			}
+		}
+		if key+1 <= maxUint32 && int64(c.Maximum())+inOffset > maxUint32 {
+			hi := roaring.AddOffset64(c, inOffset-(1<<32))
+			ra.appendContainer(uint32(key+1), hi, false)
+		}
+	}
+	return answer
+}
+
 // Add the integer x to the bitmap
 func (rb *Bitmap) Add(x uint64) {
 	hb := highbits(x)
@@ -410,6 +509,94 @@ func (rb *Bitmap) Rank(x uint64) uint64 {
 	return size
 }
 
+// CardinalityInRange returns the number of integers that are in the half-open range [start, end).
+// Only the buckets overlapping the range are visited, and buckets entirely
+// inside the range contribute their cardinality without being scanned.
+func (rb *Bitmap) CardinalityInRange(start, end uint64) uint64 {
+	if start >= end {
+		return 0
+	}
+	ra := &rb.highlowcontainer
+	hbStart, hbLast := highbits(start), highbits(end-1) // end-1 is the last included value
+
+	answer := uint64(0)
+	for i := ra.advanceUntil(hbStart, -1); i < ra.size(); i++ {
+		key := ra.getKeyAtIndex(i)
+		if key > hbLast {
+			break
+		}
+		lo, hi := uint64(0), uint64(maxUint32)+1
+		if key == hbStart {
+			lo = uint64(lowbits(start))
+		}
+		if key == hbLast {
+			hi = uint64(lowbits(end-1)) + 1
+		}
+		c := ra.getContainerAtIndex(i)
+		if lo == 0 && hi == uint64(maxUint32)+1 {
+			answer += c.GetCardinality()
+		} else {
+			answer += c.CardinalityInRange(lo, hi)
+		}
+	}
+	return answer
+}
+
+// forEachRankRange calls f for every bucket holding values of rank offset to
+// offset+limit-1, with the ranks [start, end) of those values within the
+// bucket. The buckets before offset are skipped using their cardinalities.
+func (ra *roaringArray64) forEachRankRange(offset, limit uint64, f func(i int, start, end uint64)) {
+	for i := 0; i < ra.size() && limit > 0; i++ {
+		card := ra.getContainerAtIndex(i).GetCardinality()
+		if offset >= card {
+			offset -= card
+			continue
+		}
+		end := card
+		if limit < card-offset {
+			end = offset + limit
+		}
+		f(i, offset, end)
+		limit -= end - offset
+		offset = 0
+	}
+}
+
+// Slice returns a new bitmap holding the values of rank offset to
+// offset+limit-1 (ranks start at 0), that is the limit values following the
+// first offset values, or fewer if the bitmap runs out of values. It is
+// typically used to paginate the values of a bitmap.
+func (rb *Bitmap) Slice(offset, limit uint64) *Bitmap {
+	answer := NewBitmap()
+	ra := &rb.highlowcontainer
+	ra.forEachRankRange(offset, limit, func(i int, start, end uint64) {
+		bucket := ra.getContainerAtIndex(i).Slice(start, end-start)
+		answer.highlowcontainer.appendContainer(ra.getKeyAtIndex(i), bucket, false)
+	})
+	return answer
+}
+
+// SelectRange fills buf with the values of rank offset to
+// offset+len(buf)-1 (ranks start at 0) and returns how many values were
+// written, which is less than len(buf) if the bitmap runs out of values. It is
+// typically used to paginate the values of a bitmap.
+func (rb *Bitmap) SelectRange(offset uint64, buf []uint64) int {
+	n := 0
+	var lows []uint32
+	ra := &rb.highlowcontainer
+	ra.forEachRankRange(offset, uint64(len(buf)), func(i int, start, end uint64) {
+		if uint64(cap(lows)) < end-start {
+			lows = make([]uint32, end-start)
+		}
+		hs := uint64(ra.getKeyAtIndex(i)) << 32
+		for _, low := range lows[:ra.getContainerAtIndex(i).SelectRange(start, lows[:end-start])] {
+			buf[n] = hs | uint64(low)
+			n++
+		}
+	})
+	return n
+}
+
 // Select returns the xth integer in the bitmap
 func (rb *Bitmap) Select(x uint64) (uint64, error) {
 	cardinality := rb.GetCardinality()
@@ -583,6 +770,73 @@ main:
 	return answer
 }
 
+// XorCardinality returns the cardinality of the symmetric difference between two bitmaps, bitmaps are not modified
+func (rb *Bitmap) XorCardinality(x2 *Bitmap) uint64 {
+	card1, card2, andCard := rb.cardinalities(x2)
+	return card1 + card2 - 2*andCard
+}
+
+// AndNotCardinality returns the cardinality of the difference between two bitmaps, bitmaps are not modified
+func (rb *Bitmap) AndNotCardinality(x2 *Bitmap) uint64 {
+	return rb.GetCardinality() - rb.AndCardinality(x2)
+}
+
+// JaccardIndex returns the Jaccard similarity |rb AND x2| / |rb OR x2| of two bitmaps,
+// bitmaps are not modified. The index of two empty bitmaps is 1.
+func (rb *Bitmap) JaccardIndex(x2 *Bitmap) float64 {
+	return internal.JaccardIndex(rb.cardinalities(x2))
+}
+
+// DiceCoefficient returns the Sørensen-Dice similarity 2|rb AND x2| / (|rb| + |x2|) of two
+// bitmaps, bitmaps are not modified. The coefficient of two empty bitmaps is 1.
+func (rb *Bitmap) DiceCoefficient(x2 *Bitmap) float64 {
+	return internal.DiceCoefficient(rb.cardinalities(x2))
+}
+
+// OverlapCoefficient returns the overlap similarity |rb AND x2| / min(|rb|, |x2|) of two
+// bitmaps, bitmaps are not modified. It is 1 whenever one bitmap is a subset of the
+// other, including when one of them is empty.
+func (rb *Bitmap) OverlapCoefficient(x2 *Bitmap) float64 {
+	return internal.OverlapCoefficient(rb.cardinalities(x2))
+}
+
+// cardinalities returns the cardinalities of rb, of x2 and of their intersection,
+// computed in a single pass over both bitmaps.
+func (rb *Bitmap) cardinalities(x2 *Bitmap) (card1, card2, andCard uint64) {
+	pos1 := 0
+	pos2 := 0
+	length1 := rb.highlowcontainer.size()
+	length2 := x2.highlowcontainer.size()
+
+	for pos1 < length1 && pos2 < length2 {
+		s1 := rb.highlowcontainer.getKeyAtIndex(pos1)
+		s2 := x2.highlowcontainer.getKeyAtIndex(pos2)
+		switch {
+		case s1 < s2:
+			card1 += rb.highlowcontainer.getContainerAtIndex(pos1).GetCardinality()
+			pos1++
+		case s1 > s2:
+			card2 += x2.highlowcontainer.getContainerAtIndex(pos2).GetCardinality()
+			pos2++
+		default:
+			c1 := rb.highlowcontainer.getContainerAtIndex(pos1)
+			c2 := x2.highlowcontainer.getContainerAtIndex(pos2)
+			card1 += c1.GetCardinality()
+			card2 += c2.GetCardinality()
+			andCard += c1.AndCardinality(c2)
+			pos1++
+			pos2++
+		}
+	}
+	for ; pos1 < length1; pos1++ {
+		card1 += rb.highlowcontainer.getContainerAtIndex(pos1).GetCardinality()
+	}
+	for ; pos2 < length2; pos2++ {
+		card2 += x2.highlowcontainer.getContainerAtIndex(pos2).GetCardinality()
+	}
+	return card1, card2, andCard
+}
+
 // Intersects checks whether two bitmap intersects, bitmaps are not modified
 func (rb *Bitmap) Intersects(x2 *Bitmap) bool {
 	pos1 := 0
@@ -630,6 +884,106 @@ main:
 	return false
 }
 
+// IsSubset returns true if every value of rb is also in x2, bitmaps are not modified.
+// It returns as soon as a bucket of rb is found not to be contained in x2.
+func (rb *Bitmap) IsSubset(x2 *Bitmap) bool {
+	length1 := rb.highlowcontainer.size()
+	length2 := x2.highlowcontainer.size()
+	if length1 > length2 {
+		return false
+	}
+	pos2 := -1
+	for pos1 := 0; pos1 < length1; pos1++ {
+		key := rb.highlowcontainer.getKeyAtIndex(pos1)
+		pos2 = x2.highlowcontainer.advanceUntil(key, pos2)
+		if pos2 == length2 || x2.highlowcontainer.getKeyAtIndex(pos2) != key {
+			return false
+		}
+		c1 := rb.highlowcontainer.getContainerAtIndex(pos1)
+		c2 := x2.highlowcontainer.getContainerAtIndex(pos2)
+		if !c1.IsSubset(c2) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsSuperset returns true if every value of x2 is also in rb, bitmaps are not modified.
+func (rb *Bitmap) IsSuperset(x2 *Bitmap) bool {
+	return x2.IsSubset(rb)
+}
+
+// IsStrictSubset returns true if rb is a subset of x2 and x2 holds at least one
+// value that is not in rb, bitmaps are not modified.
+func (rb *Bitmap) IsStrictSubset(x2 *Bitmap) bool {
+	return rb.IsSubset(x2) && rb.GetCardinality() < x2.GetCardinality()
+}
+
+// IsDisjoint returns true if the two bitmaps have no value in common, bitmaps are not modified.
+func (rb *Bitmap) IsDisjoint(x2 *Bitmap) bool {
+	return !rb.Intersects(x2)
+}
+
+// Compare computes how rb relates to x2 in a single pass over both bitmaps,
+// without computing any intermediate bitmap. An empty bitmap is a subset of
+// any non-empty bitmap: roaring.RelationSubset and roaring.RelationSuperset
+// take precedence over roaring.RelationDisjoint.
+func (rb *Bitmap) Compare(x2 *Bitmap) roaring.SetRelation {
+	subset, superset, intersects := true, true, false
+	pos1, pos2 := 0, 0
+	length1 := rb.highlowcontainer.size()
+	length2 := x2.highlowcontainer.size()
+
+	for pos1 < length1 && pos2 < length2 && (subset || superset || !intersects) {
+		s1 := rb.highlowcontainer.getKeyAtIndex(pos1)
+		s2 := x2.highlowcontainer.getKeyAtIndex(pos2)
+		switch {
+		case s1 < s2:
+			subset = false
+			pos1++
+		case s1 > s2:
+			superset = false
+			pos2++
+		default:
+			c1 := rb.highlowcontainer.getContainerAtIndex(pos1)
+			c2 := x2.highlowcontainer.getContainerAtIndex(pos2)
+			subset = subset && c1.IsSubset(c2)
+			superset = superset && c2.IsSubset(c1)
+			// non-empty buckets intersect if one contains the other
+			intersects = intersects || subset || superset || c1.Intersects(c2)
+			pos1++
+			pos2++
+		}
+	}
+	if pos1 < length1 {
+		subset = false
+	}
+	if pos2 < length2 {
+		superset = false
+	}
+
+	switch {
+	case subset && superset:
+		return roaring.RelationEqual
+	case subset:
+		return roaring.RelationSubset
+	case superset:
+		return roaring.RelationSuperset
+	case !intersects:
+		return roaring.RelationDisjoint
+	}
+	return roaring.RelationOverlap
+}
+
+// IntersectsWithInterval checks whether a bitmap 'rb' and an open interval '[x,y)' intersect.
+func (rb *Bitmap) IntersectsWithInterval(x, y uint64) bool {
+	if x >= y {
+		return false
+	}
+	v, ok := rb.NextValue(x)
+	return ok && v < y
+}
+
 // Xor computes the symmetric difference between two bitmaps and stores the result in the current bitmap
 func (rb *Bitmap) Xor(x2 *Bitmap) {
 	pos1 := 0
@@ -869,6 +1223,132 @@ main:
 	return answer
 }
 
+// bucketRange returns the values of the half-open range [rangeStart,
+// rangeEnd) whose high bits are key, as a half-open range of low bits.
+func bucketRange(key uint32, rangeStart, rangeEnd uint64) (uint64, uint64) {
+	lo, hi := uint64(0), uint64(maxUint32)+1
+	if key == highbits(rangeStart) {
+		lo = uint64(lowbits(rangeStart))
+	}
+	if key == highbits(rangeEnd-1) {
+		hi = uint64(lowbits(rangeEnd-1)) + 1
+	}
+	return lo, hi
+}
+
+// AndInRange computes the intersection between two bitmaps restricted to the
+// half-open range [rangeStart, rangeEnd) and returns the result. Only the
+// buckets overlapping the range are visited, and they are intersected with
+// roaring.AndInRange.
+func AndInRange(x1, x2 *Bitmap, rangeStart, rangeEnd uint64) *Bitmap {
+	answer := NewBitmap()
+	if rangeStart >= rangeEnd {
+		return answer
+	}
+	hbStart, hbLast := highbits(rangeStart), highbits(rangeEnd-1)
+
+	ra1, ra2 := &x1.highlowcontainer, &x2.highlowcontainer
+	pos1, pos2 := ra1.advanceUntil(hbStart, -1), ra2.advanceUntil(hbStart, -1)
+	for pos1 < ra1.size() && pos2 < ra2.size() {
+		s1, s2 := ra1.getKeyAtIndex(pos1), ra2.getKeyAtIndex(pos2)
+		if s1 > hbLast || s2 > hbLast {
+			break
+		}
+		if s1 < s2 {
+			pos1 = ra1.advanceUntil(s2, pos1)
+			continue
+		} else if s1 > s2 {
+			pos2 = ra2.advanceUntil(s1, pos2)
+			continue
+		}
+
+		lo, hi := bucketRange(s1, rangeStart, rangeEnd)
+		c := roaring.AndInRange(ra1.getContainerAtIndex(pos1), ra2.getContainerAtIndex(pos2), lo, hi)
+		if !c.IsEmpty() {
+			answer.highlowcontainer.appendContainer(s1, c, false)
+		}
+		pos1++
+		pos2++
+	}
+	return answer
+}
+
+// AndCardinalityInRange returns the cardinality of the intersection between
+// two bitmaps restricted to the half-open range [rangeStart, rangeEnd),
+// bitmaps are not modified. Only the buckets overlapping the range are
+// visited.
+func (rb *Bitmap) AndCardinalityInRange(x2 *Bitmap, rangeStart, rangeEnd uint64) uint64 {
+	if rangeStart >= rangeEnd {
+		return 0
+	}
+	hbStart, hbLast := highbits(rangeStart), highbits(rangeEnd-1)
+
+	answer := uint64(0)
+	ra1, ra2 := &rb.highlowcontainer, &x2.highlowcontainer
+	pos1, pos2 := ra1.advanceUntil(hbStart, -1), ra2.advanceUntil(hbStart, -1)
+	for pos1 < ra1.size() && pos2 < ra2.size() {
+		s1, s2 := ra1.getKeyAtIndex(pos1), ra2.getKeyAtIndex(pos2)
+		if s1 > hbLast || s2 > hbLast {
+			break
+		}
+		if s1 < s2 {
+			pos1 = ra1.advanceUntil(s2, pos1)
+			continue
+		} else if s1 > s2 {
+			pos2 = ra2.advanceUntil(s1, pos2)
+			continue
+		}
+
+		lo, hi := bucketRange(s1, rangeStart, rangeEnd)
+		answer += ra1.getContainerAtIndex(pos1).AndCardinalityInRange(ra2.getContainerAtIndex(pos2), lo, hi)
+		pos1++
+		pos2++
+	}
+	return answer
+}
+
+// OrInRange computes the union between two bitmaps restricted to the
+// half-open range [rangeStart, rangeEnd) and returns the result. Only the
+// buckets overlapping the range are visited, and they are merged with
+// roaring.OrInRange.
+func OrInRange(x1, x2 *Bitmap, rangeStart, rangeEnd uint64) *Bitmap {
+	answer := NewBitmap()
+	if rangeStart >= rangeEnd {
+		return answer
+	}
+	hbStart, hbLast := highbits(rangeStart), highbits(rangeEnd-1)
+
+	empty := roaring.NewBitmap()
+	ra1, ra2 := &x1.highlowcontainer, &x2.highlowcontainer
+	pos1, pos2 := ra1.advanceUntil(hbStart, -1), ra2.advanceUntil(hbStart, -1)
+	for {
+		has1 := pos1 < ra1.size() && ra1.getKeyAtIndex(pos1) <= hbLast
+		has2 := pos2 < ra2.size() && ra2.getKeyAtIndex(pos2) <= hbLast
+
+		var key uint32
+		c1, c2 := empty, empty
+		switch {
+		case has1 && (!has2 || ra1.getKeyAtIndex(pos1) < ra2.getKeyAtIndex(pos2)):
+			key, c1 = ra1.getKeyAtIndex(pos1), ra1.getContainerAtIndex(pos1)
+			pos1++
+		case has2 && (!has1 || ra2.getKeyAtIndex(pos2) < ra1.getKeyAtIndex(pos1)):
+			key, c2 = ra2.getKeyAtIndex(pos2), ra2.getContainerAtIndex(pos2)
+			pos2++
+		case has1 && has2:
+			key, c1, c2 = ra1.getKeyAtIndex(pos1), ra1.getContainerAtIndex(pos1), ra2.getContainerAtIndex(pos2)
+			pos1++
+			pos2++
+		default:
+			return answer
+		}
+
+		lo, hi := bucketRange(key, rangeStart, rangeEnd)
+		if c := roaring.OrInRange(c1, c2, lo, hi); !c.IsEmpty() {
+			answer.highlowcontainer.appendContainer(key, c, false)
+		}
+	}
+}
+
 // Xor computes the symmetric difference between two bitmaps and returns the result
 func Xor(x1, x2 *Bitmap) *Bitmap {
 	answer := NewBitmap()
@@ -985,6 +1465,71 @@ func (rb *Bitmap) AddMany(dat []uint64) {
 	rb.getOrCreateContainer(batchHighBits).AddMany(batch)
 }
 
+// RemoveMany removes all of the values in dat from the bitmap. Consecutive
+// values sharing their 32 high bits are removed from the same bucket with
+// roaring.Bitmap.RemoveMany, and ascending values are found without a full
+// search, so sorted input is fastest.
+func (rb *Bitmap) RemoveMany(dat []uint64) {
+	ra := &rb.highlowcontainer
+	ra.forEachKeyRun(dat, func(i int, hb uint32, run []uint32) int {
+		if i < 0 {
+			return i
+		}
+		c := ra.getWritableContainerAtIndex(i)
+		c.RemoveMany(run)
+		if c.IsEmpty() {
+			ra.removeAtIndex(i)
+			return -i - 1
+		}
+		return i
+	})
+}
+
+// ContainsMany reports, for every value in dat, whether it is contained in
+// the bitmap. Consecutive values sharing their 32 high bits are looked up in
+// the same bucket with roaring.Bitmap.ContainsMany, and ascending values are
+// found without a full search, so sorted input is fastest.
+func (rb *Bitmap) ContainsMany(dat []uint64) []bool {
+	answer := make([]bool, len(dat))
+	ra := &rb.highlowcontainer
+	pos := 0
+	ra.forEachKeyRun(dat, func(i int, hb uint32, run []uint32) int {
+		if i >= 0 {
+			copy(answer[pos:], ra.getContainerAtIndex(i).ContainsMany(run))
+		}
+		pos += len(run)
+		return i
+	})
+	return answer
+}
+
+// FlipMany negates every value in dat: values present in the bitmap are
+// removed and the others are added. A value occurring twice in dat is thus
+// left unchanged. Consecutive values sharing their 32 high bits are flipped in
+// the same bucket with roaring.Bitmap.FlipMany, and ascending values are found
+// without a full search, so sorted input is fastest.
+func (rb *Bitmap) FlipMany(dat []uint64) {
+	ra := &rb.highlowcontainer
+	ra.forEachKeyRun(dat, func(i int, hb uint32, run []uint32) int {
+		if i < 0 {
+			c := roaring.NewBitmap()
+			c.FlipMany(run)
+			if c.IsEmpty() {
+				return i
+			}
+			ra.insertNewKeyValueAt(-i-1, hb, c)
+			return -i - 1
+		}
+		c := ra.getWritableContainerAtIndex(i)
+		c.FlipMany(run)
+		if c.IsEmpty() {
+			ra.removeAtIndex(i)
+			return -i - 1
+		}
+		return i
+	})
+}
+
 // getOrCreateContainer gets the roaring.Bitmap for key hb,
 // or creates an *empty* roaring.Bitmap, inserts it to rb.highlowcontainer, and returns the new roaring.Bitmap.
 func (rb *Bitmap) getOrCreateContainer(hb uint32) *roaring.Bitmap {
@@ -1193,6 +1738,24 @@ func (rb *Bitmap) GetCopyOnWrite() (val bool) {
 	return rb.highlowcontainer.copyOnWrite
 }
 
+// SetFastRank sets every bucket of this bitmap to keep the cumulative
+// cardinalities of its containers if the parameter is true, as
+// roaring.Bitmap.SetFastRank does. The buckets are still visited in order, but
+// their cardinalities no longer need to be computed and Select finds its value
+// within a bucket by binary search. Buckets shared copy-on-write with another
+// bitmap are only switched once they are copied.
+//
+// As with roaring.Bitmap, a bitmap with fast rank must not be queried
+// concurrently without synchronization, even if it is not modified.
+func (rb *Bitmap) SetFastRank(val bool) {
+	rb.highlowcontainer.setFastRank(val)
+}
+
+// GetFastRank gets this bitmap's fast rank property, see SetFastRank
+func (rb *Bitmap) GetFastRank() (val bool) {
+	return rb.highlowcontainer.fastRank
+}
+
 // CloneCopyOnWriteContainers clones all containers which have
 // needCopyOnWrite set to true.
 // This can be used to make sure it is safe to munmap a []byte
@@ -1208,6 +1771,122 @@ func (rb *Bitmap) CloneCopyOnWriteContainers() {
 	rb.highlowcontainer.cloneCopyOnWriteContainers()
 }
 
+// NextValue returns the smallest value in the bitmap that is greater than
+// or equal to target, and false if there is none. This function should not
+// be used inside a performance-sensitive loop: prefer iterators if
+// performance is a concern.
+func (rb *Bitmap) NextValue(target uint64) (uint64, bool) {
+	ra := &rb.highlowcontainer
+	hb, lb := highbits(target), lowbits(target)
+	for i := ra.advanceUntil(hb, -1); i < ra.size(); i++ {
+		key, c := ra.getKeyAtIndex(i), ra.getContainerAtIndex(i)
+		if key > hb {
+			if !c.IsEmpty() {
+				return uint64(key)<<32 | uint64(c.Minimum()), true
+			}
+			continue
+		}
+		if v := c.NextValue(lb); v >= 0 {
+			return uint64(key)<<32 | uint64(v), true
+		}
+	}
+	return 0, false
+}
+
+// PreviousValue returns the largest value in the bitmap that is smaller than
+// or equal to target, and false if there is none. This function should not
+// be used inside a performance-sensitive loop: prefer iterators if
+// performance is a concern.
+func (rb *Bitmap) PreviousValue(target uint64) (uint64, bool) {
+	ra := &rb.highlowcontainer
+	hb, lb := highbits(target), lowbits(target)
+	i := ra.getIndex(hb)
+	if i < 0 {
+		// start from the last bucket before target
+		i = -i - 2
+	}
+	for ; i >= 0; i-- {
+		key, c := ra.getKeyAtIndex(i), ra.getContainerAtIndex(i)
+		if key < hb {
+			if !c.IsEmpty() {
+				return uint64(key)<<32 | uint64(c.Maximum()), true
+			}
+			continue
+		}
+		if v := c.PreviousValue(lb); v >= 0 {
+			return uint64(key)<<32 | uint64(v), true
+		}
+	}
+	return 0, false
+}
+
+// NextAbsentValue returns the smallest value missing from the bitmap that
+// is greater than or equal to target, and false if there is none. This
+// function should not be used inside a performance-sensitive loop: prefer
+// iterators if performance is a concern.
+func (rb *Bitmap) NextAbsentValue(target uint64) (uint64, bool) {
+	ra := &rb.highlowcontainer
+	hb, lb := highbits(target), lowbits(target)
+	i := ra.getIndex(hb)
+	if i < 0 {
+		return target, true
+	}
+	v := ra.getContainerAtIndex(i).NextAbsentValue(lb)
+	for {
+		if v >= 0 {
+			return uint64(hb)<<32 | uint64(v), true
+		}
+		// the bucket is full from the query up to its end
+		if hb == maxUint32 {
+			return 0, false
+		}
+		hb++
+		i++
+		if i == ra.size() || ra.getKeyAtIndex(i) != hb {
+			return uint64(hb) << 32, true
+		}
+		v = ra.getContainerAtIndex(i).NextAbsentValue(0)
+	}
+}
+
+// PreviousAbsentValue returns the largest value missing from the bitmap
+// that is smaller than or equal to target, and false if there is none. This
+// function should not be used inside a performance-sensitive loop: prefer
+// iterators if performance is a concern.
+func (rb *Bitmap) PreviousAbsentValue(target uint64) (uint64, bool) {
+	ra := &rb.highlowcontainer
+	hb, lb := highbits(target), lowbits(target)
+	i := ra.getIndex(hb)
+	if i < 0 {
+		return target, true
+	}
+	v := ra.getContainerAtIndex(i).PreviousAbsentValue(lb)
+	for {
+		if v >= 0 {
+			return uint64(hb)<<32 | uint64(v), true
+		}
+		// the bucket is full from its start up to the query
+		if hb == 0 {
+			return 0, false
+		}
+		hb--
+		i--
+		if i < 0 || ra.getKeyAtIndex(i) != hb {
+			return uint64(hb)<<32 | maxUint32, true
+		}
+		v = ra.getContainerAtIndex(i).PreviousAbsentValue(maxUint32)
+	}
+}
+
+// UnsetIterator creates a new IntPeekable64 to iterate over values in the range [min, max] that are NOT contained in the bitmap.
+// Unlike the 32-bit version, max is inclusive so that the range may end at the largest uint64.
+// The iterator becomes invalid if the bitmap is modified (e.g., with Add or Remove).
+func (rb *Bitmap) UnsetIterator(min, max uint64) IntPeekable64 {
+	p := &unsetIterator{rb: rb, max: max}
+	p.seek(min)
+	return p
+}
+
 // FlipInt calls Flip after casting the parameters (convenience method)
 func FlipInt(bm *Bitmap, rangeStart, rangeEnd int) *Bitmap {
 	return Flip(bm, uint64(rangeStart), uint64(rangeEnd))
@@ -1,8 +1,10 @@
 package roaring64
 
 import (
+	"bytes"
 	"math"
 	"math/rand"
+	"sort"
 	"strconv"
 	"testing"
 
@@ -2076,3 +2078,431 @@ func TestRoaringArray64SortOrder(t *testing.T) {
 		assert.True(t, bm.highlowcontainer.checkKeysSorted())
 	})
 }
+
+func TestIterate(t *testing.T) {
+	rb := BitmapOf(1, 2, 1<<32, 1<<32|7, 1<<50)
+	var values []uint64
+	rb.Iterate(func(x uint64) bool {
+		values = append(values, x)
+		return true
+	})
+	assert.Equal(t, rb.ToArray(), values)
+
+	values = values[:0]
+	rb.Iterate(func(x uint64) bool {
+		values = append(values, x)
+		return x < 1<<32
+	})
+	assert.Equal(t, []uint64{1, 2, 1 << 32}, values)
+}
+
+func TestNextPreviousValues(t *testing.T) {
+	b := New()
+	b.AddRange(5, 10)
+	b.AddRange(1<<32-2, 1<<32+2)
+	b.AddRange(3<<32, 3<<32+1<<16) // full container
+	b.Add(3<<32 + 1<<16 + 1)
+	b.Add(math.MaxUint64)
+	values := b.ToArray()
+
+	var probes []uint64
+	for start, last := range b.Ranges() {
+		for d := uint64(0); d < 3; d++ {
+			probes = append(probes, start+d, start-d, last+d, last-d)
+		}
+	}
+	probes = append(probes, 0, 3<<32+12345, 1<<40)
+
+	for _, x := range probes {
+		i := sort.Search(len(values), func(i int) bool { return values[i] >= x })
+		next, ok := b.NextValue(x)
+		if i < len(values) {
+			assert.True(t, ok, x)
+			assert.Equal(t, values[i], next, x)
+		} else {
+			assert.False(t, ok, x)
+		}
+
+		j := sort.Search(len(values), func(i int) bool { return values[i] > x }) - 1
+		prev, ok := b.PreviousValue(x)
+		if j >= 0 {
+			assert.True(t, ok, x)
+			assert.Equal(t, values[j], prev, x)
+		} else {
+			assert.False(t, ok, x)
+		}
+
+		expected, found := x, true
+		for b.Contains(expected) {
+			if expected == math.MaxUint64 {
+				found = false
+				break
+			}
+			expected++
+		}
+		absent, ok := b.NextAbsentValue(x)
+		assert.Equal(t, found, ok, x)
+		if found {
+			assert.Equal(t, expected, absent, x)
+		}
+
+		expected, found = x, true
+		for b.Contains(expected) {
+			if expected == 0 {
+				found = false
+				break
+			}
+			expected--
+		}
+		absent, ok = b.PreviousAbsentValue(x)
+		assert.Equal(t, found, ok, x)
+		if found {
+			assert.Equal(t, expected, absent, x)
+		}
+	}
+
+	_, ok := New().NextValue(0)
+	assert.False(t, ok)
+	_, ok = New().PreviousValue(math.MaxUint64)
+	assert.False(t, ok)
+	absent, ok := New().NextAbsentValue(42)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(42), absent)
+
+	full := New()
+	full.AddRange(0, 1<<32)
+	full.AddRange(1<<32, 2<<32)
+	absent, ok = full.NextAbsentValue(7)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(2<<32), absent)
+	_, ok = full.PreviousAbsentValue(1<<32 + 7)
+	assert.False(t, ok)
+}
+
+func offsetTestBitmap() *Bitmap {
+	b := BitmapOf(0, 1, 100, 1<<31, 1<<32-1, 1<<32, 5<<32|7, 1<<63, math.MaxUint64)
+	b.AddRange(2<<32-1000, 2<<32+1000)
+	b.AddRange(3<<32, 3<<32+100000)
+	b.RunOptimize()
+	return b
+}
+
+func TestCardinalityInRange(t *testing.T) {
+	b := offsetTestBitmap()
+	values := b.ToArray()
+	ranges := [][2]uint64{
+		{0, 0}, {5, 3}, {0, 1}, {0, 101}, {1, 1 << 32}, {0, math.MaxUint64},
+		{1<<32 - 1, 1<<32 + 1}, {2<<32 - 10, 2<<32 + 10}, {2 << 32, 3<<32 + 50000},
+		{3<<32 + 1, 6 << 32}, {1 << 63, math.MaxUint64}, {6 << 32, 1 << 63},
+	}
+	for _, r := range ranges {
+		expected := uint64(0)
+		for _, v := range values {
+			if v >= r[0] && v < r[1] {
+				expected++
+			}
+		}
+		assert.Equal(t, expected, b.CardinalityInRange(r[0], r[1]), r)
+		assert.Equal(t, expected > 0, b.IntersectsWithInterval(r[0], r[1]), r)
+	}
+	assert.Zero(t, New().CardinalityInRange(0, math.MaxUint64))
+	assert.False(t, New().IntersectsWithInterval(0, math.MaxUint64))
+}
+
+func TestAddOffset(t *testing.T) {
+	b := offsetTestBitmap()
+	values := b.ToArray()
+	offsets := []int64{
+		0, 1, -1, 1000, -1000, 1 << 32, -(1 << 32), 1<<32 + 5, -(1<<32 + 5),
+		1<<32 - 1, 1 << 31, -(1 << 31), 3<<32 - 70000, math.MaxInt64, math.MinInt64,
+	}
+	for _, offset := range offsets {
+		var expected []uint64
+		for _, v := range values {
+			shifted := v + uint64(offset)
+			// keep values that did not wrap around
+			if (offset >= 0 && shifted >= v) || (offset < 0 && shifted < v) {
+				expected = append(expected, shifted)
+			}
+		}
+		sort.Slice(expected, func(i, j int) bool { return expected[i] < expected[j] })
+
+		answer := AddOffset(b, offset)
+		assert.Equal(t, len(expected), int(answer.GetCardinality()), offset)
+		if len(expected) > 0 {
+			assert.Equal(t, expected, answer.ToArray(), offset)
+		}
+	}
+	assert.Equal(t, values, b.ToArray())
+	assert.True(t, AddOffset(New(), 12345).IsEmpty())
+}
+
+func TestSetRelations(t *testing.T) {
+	a := BitmapOf(1, 2, 3, 1<<40|5)
+	a.AddRange(3<<32, 3<<32+100000)
+	b := a.Clone()
+	b.Add(7 << 32)
+	b.RunOptimize()
+	c := BitmapOf(1, 1<<50)
+	d := BitmapOf(4, 1<<50)
+	empty := NewBitmap()
+
+	cases := []struct {
+		x, y     *Bitmap
+		relation roaring.SetRelation
+	}{
+		{a, a.Clone(), roaring.RelationEqual},
+		{a, b, roaring.RelationSubset},
+		{b, a, roaring.RelationSuperset},
+		{a, c, roaring.RelationOverlap},
+		{a, d, roaring.RelationDisjoint},
+		{empty, a, roaring.RelationSubset},
+		{empty, NewBitmap(), roaring.RelationEqual},
+	}
+	for i, tc := range cases {
+		assert.Equal(t, tc.relation, tc.x.Compare(tc.y), i)
+
+		subset := AndNot(tc.x, tc.y).IsEmpty()
+		superset := AndNot(tc.y, tc.x).IsEmpty()
+		assert.Equal(t, subset, tc.x.IsSubset(tc.y), i)
+		assert.Equal(t, superset, tc.x.IsSuperset(tc.y), i)
+		assert.Equal(t, subset && !superset, tc.x.IsStrictSubset(tc.y), i)
+		assert.Equal(t, And(tc.x, tc.y).IsEmpty(), tc.x.IsDisjoint(tc.y), i)
+	}
+
+	e := b.Clone()
+	e.Remove(3<<32 + 5)
+	assert.False(t, a.IsSubset(e))
+	assert.Equal(t, roaring.RelationOverlap, a.Compare(e))
+}
+
+func TestCardinalityOnlyOperations(t *testing.T) {
+	a := BitmapOf(1, 2, 3, 1<<40|5, 9<<32)
+	a.AddRange(3<<32, 3<<32+100000)
+	b := BitmapOf(2, 3, 4, 2<<32)
+	b.AddRange(3<<32+50000, 3<<32+200000)
+	b.RunOptimize()
+
+	for _, pair := range [][2]*Bitmap{{a, b}, {b, a}, {a, a}, {a, NewBitmap()}, {NewBitmap(), NewBitmap()}} {
+		x, y := pair[0], pair[1]
+		assert.Equal(t, Xor(x, y).GetCardinality(), x.XorCardinality(y))
+		assert.Equal(t, AndNot(x, y).GetCardinality(), x.AndNotCardinality(y))
+	}
+
+	and := float64(And(a, b).GetCardinality())
+	card1, card2 := float64(a.GetCardinality()), float64(b.GetCardinality())
+	assert.InDelta(t, and/float64(Or(a, b).GetCardinality()), a.JaccardIndex(b), 1e-12)
+	assert.InDelta(t, 2*and/(card1+card2), a.DiceCoefficient(b), 1e-12)
+	assert.InDelta(t, and/min(card1, card2), a.OverlapCoefficient(b), 1e-12)
+
+	assert.Equal(t, 1.0, a.JaccardIndex(a.Clone()))
+	assert.Equal(t, 0.0, a.JaccardIndex(BitmapOf(7)))
+	assert.Equal(t, 1.0, NewBitmap().JaccardIndex(NewBitmap()))
+}
+
+func TestBatchOperations(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	base := NewBitmap()
+	for i := uint64(0); i < 6000; i++ {
+		base.Add(i * 2)
+	}
+	base.AddRange(3<<32, 3<<32+200000)
+	base.AddMany([]uint64{5<<32 + 1, 5<<32 + 9, 8 << 32})
+	base.RunOptimize()
+
+	var values []uint64
+	for i := 0; i < 20000; i++ {
+		values = append(values, uint64(r.Int63n(10<<32))&^0xFFFF0000) // few containers per bucket
+	}
+	values = append(values, 5<<32+1, 5<<32+9, 8<<32) // empties their buckets
+	sorted := append([]uint64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	for _, dat := range [][]uint64{nil, values, sorted} {
+		shared := base.Clone()
+		shared.SetCopyOnWrite(true)
+		rb := shared.Clone() // the buckets are shared with copy-on-write
+
+		contains := rb.ContainsMany(dat)
+		assert.Len(t, contains, len(dat))
+		for i, x := range dat {
+			assert.Equal(t, base.Contains(x), contains[i])
+		}
+
+		expected := base.Clone()
+		for _, x := range dat {
+			if expected.Contains(x) {
+				expected.Remove(x)
+			} else {
+				expected.Add(x)
+			}
+		}
+		rb.FlipMany(dat)
+		assert.NoError(t, rb.Validate())
+		assert.True(t, expected.Equals(rb))
+
+		for _, x := range dat {
+			expected.Remove(x)
+		}
+		rb.RemoveMany(dat)
+		assert.NoError(t, rb.Validate())
+		assert.True(t, expected.Equals(rb))
+
+		assert.True(t, base.Equals(shared))
+	}
+}
+
+func TestRangeRestrictedOperations(t *testing.T) {
+	x1 := NewBitmap()
+	x2 := NewBitmap()
+	for i := uint64(0); i < 200000; i += 3 {
+		x1.Add(i)
+		x2.Add(3<<32 + i*2)
+	}
+	for i := uint64(0); i < 300000; i += 5 {
+		x2.Add(i)
+		x1.Add(3<<32 + i)
+	}
+	x1.AddRange(6<<32-70000, 6<<32+100)
+	x2.AddRange(6<<32-10, 6<<32+50000)
+	x1.AddMany([]uint64{20 << 32, math.MaxUint64})
+	x2.AddMany([]uint64{20<<32 + 1, math.MaxUint64})
+	x2.RunOptimize()
+
+	ranges := [][2]uint64{
+		{0, 0}, {10, 5}, {0, math.MaxUint64}, {7, 100}, {1<<32 - 7, 3<<32 + 11},
+		{1 << 32, 3 << 32}, {3<<32 + 5, 3<<32 + 70000}, {6<<32 + 5, 6<<32 + 50},
+		{100, 8<<32 + 3}, {20 << 32, 20<<32 + 2}, {math.MaxUint64 - 1, math.MaxUint64},
+	}
+	// clip keeps the values of x in [r[0], r[1])
+	clip := func(x *Bitmap, r [2]uint64) *Bitmap {
+		answer := NewBitmap()
+		for v := range Values(x) {
+			if v >= r[0] && v < r[1] {
+				answer.Add(v)
+			}
+		}
+		return answer
+	}
+	for _, r := range ranges {
+		expected := clip(And(x1, x2), r)
+		actual := AndInRange(x1, x2, r[0], r[1])
+		assert.NoError(t, actual.Validate())
+		assert.True(t, expected.Equals(actual), "range %v", r)
+		assert.Equal(t, expected.GetCardinality(), x1.AndCardinalityInRange(x2, r[0], r[1]), "range %v", r)
+
+		expected = clip(Or(x1, x2), r)
+		actual = OrInRange(x1, x2, r[0], r[1])
+		assert.NoError(t, actual.Validate())
+		assert.True(t, expected.Equals(actual), "range %v", r)
+	}
+}
+
+func TestSliceAndSelectRange(t *testing.T) {
+	rb := NewBitmap()
+	for i := uint64(0); i < 10000; i += 3 {
+		rb.Add(i)
+		rb.Add(1<<32 + i*7)
+	}
+	rb.AddRange(5<<32-100, 5<<32+70000)
+	rb.Add(math.MaxUint64)
+	all := rb.ToArray()
+	total := uint64(len(all))
+
+	for _, offset := range []uint64{0, 1, 3333, 3334, 6668, 6670, 76767, total - 1, total, total + 5} {
+		for _, limit := range []uint64{0, 1, 500, 80000, math.MaxUint64} {
+			var expected []uint64
+			if offset < total {
+				expected = all[offset:]
+				if limit < uint64(len(expected)) {
+					expected = expected[:limit]
+				}
+			}
+
+			slice := rb.Slice(offset, limit)
+			assert.NoError(t, slice.Validate())
+			assert.True(t, BitmapOf(expected...).Equals(slice), "offset=%d limit=%d", offset, limit)
+
+			if limit > 80000 {
+				continue
+			}
+			buf := make([]uint64, limit)
+			n := rb.SelectRange(offset, buf)
+			assert.Equal(t, len(expected), n, "offset=%d limit=%d", offset, limit)
+			if len(expected) > 0 {
+				assert.Equal(t, expected, buf[:n], "offset=%d limit=%d", offset, limit)
+			}
+		}
+	}
+}
+
+func TestFastRank(t *testing.T) {
+	fast := NewBitmap()
+	fast.SetFastRank(true)
+	assert.True(t, fast.GetFastRank())
+	slow := NewBitmap()
+
+	check := func(step string) {
+		t.Helper()
+		card := slow.GetCardinality()
+		assert.Equal(t, card, fast.GetCardinality(), step)
+		for _, x := range []uint64{0, 1, 100, 1 << 32, 3<<32 + 7, 9 << 32, math.MaxUint64} {
+			assert.Equal(t, slow.Rank(x), fast.Rank(x), "%s: rank %d", step, x)
+		}
+		for _, i := range []uint64{0, 1, card / 3, card / 2, card - 1, card} {
+			want, wantErr := slow.Select(i)
+			got, err := fast.Select(i)
+			assert.Equal(t, wantErr != nil, err != nil, "%s: select %d", step, i)
+			assert.Equal(t, want, got, "%s: select %d", step, i)
+		}
+		for i, c := range fast.highlowcontainer.containers {
+			if !fast.highlowcontainer.needCopyOnWrite[i] {
+				assert.Equal(t, fast.GetFastRank(), c.GetFastRank(), "%s: bucket %d", step, i)
+			}
+		}
+	}
+	both := func(step string, f func(rb *Bitmap)) {
+		f(fast)
+		f(slow)
+		check(step)
+	}
+
+	check("empty")
+	both("add", func(rb *Bitmap) {
+		for i := uint64(0); i < 20000; i += 7 {
+			rb.Add(i)
+		}
+	})
+	both("add range", func(rb *Bitmap) { rb.AddRange(3<<32, 3<<32+100000) })
+	both("remove", func(rb *Bitmap) { rb.Remove(14) })
+	both("remove range", func(rb *Bitmap) { rb.RemoveRange(3<<32+10, 3<<32+100) })
+	both("or", func(rb *Bitmap) { rb.Or(BitmapOf(1, 2<<32, 7<<32)) })
+	both("and not", func(rb *Bitmap) { rb.AndNot(BitmapOf(21, 2<<32)) })
+	both("xor", func(rb *Bitmap) { rb.Xor(BitmapOf(21, 22, 10<<32)) })
+
+	fast.SetCopyOnWrite(true)
+	slow.SetCopyOnWrite(true)
+	fastClone, slowClone := fast.Clone(), slow.Clone()
+	assert.True(t, fastClone.GetFastRank())
+	both("clone", func(rb *Bitmap) { rb.Add(3<<32 - 1) })
+	fastClone.Remove(3<<32 + 5)
+	slowClone.Remove(3<<32 + 5)
+	fast, slow = fastClone, slowClone
+	check("clone modified")
+
+	data, err := fast.ToBytes()
+	assert.NoError(t, err)
+	read := NewBitmap()
+	read.SetFastRank(true)
+	_, err = read.ReadFrom(bytes.NewReader(data))
+	assert.NoError(t, err)
+	fast = read
+	check("read")
+
+	both("clear", func(rb *Bitmap) { rb.Clear() })
+
+	both("refill", func(rb *Bitmap) { rb.AddRange(0, 1000) })
+	fast.SetFastRank(false)
+	assert.False(t, fast.GetFastRank())
+	check("disabled")
+}
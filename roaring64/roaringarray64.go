@@ -11,6 +11,11 @@ type roaringArray64 struct {
 	containers      []*roaring.Bitmap
 	needCopyOnWrite []bool
 	copyOnWrite     bool
+
+	// fastRank asks every bucket to keep its cumulative-cardinality index
+	// (see roaring.Bitmap.SetFastRank), so that bucket cardinalities come
+	// for free and selecting within a bucket is logarithmic.
+	fastRank bool
 }
 
 var (
@@ -34,6 +39,9 @@ func (ra *roaringArray64) runOptimize() {
 }
 
 func (ra *roaringArray64) appendContainer(key uint32, value *roaring.Bitmap, mustCopyOnWrite bool) {
+	if !mustCopyOnWrite {
+		ra.markFastRank(value)
+	}
 	ra.keys = append(ra.keys, key)
 	ra.containers = append(ra.containers, value)
 	ra.needCopyOnWrite = append(ra.needCopyOnWrite, mustCopyOnWrite)
@@ -151,6 +159,7 @@ func (ra *roaringArray64) clear() {
 func (ra *roaringArray64) clone() *roaringArray64 {
 	sa := roaringArray64{}
 	sa.copyOnWrite = ra.copyOnWrite
+	sa.fastRank = ra.fastRank
 
 	// this is where copyOnWrite is used.
 	if ra.copyOnWrite {
@@ -213,10 +222,30 @@ func (ra *roaringArray64) getWritableContainerAtIndex(i int) *roaring.Bitmap {
 	if ra.needCopyOnWrite[i] {
 		ra.containers[i] = ra.containers[i].Clone()
 		ra.needCopyOnWrite[i] = false
+		ra.markFastRank(ra.containers[i])
 	}
 	return ra.containers[i]
 }
 
+// markFastRank enables the rank index of a bucket entering a fast-rank bitmap.
+// Buckets shared with another bitmap are left alone until they are copied.
+func (ra *roaringArray64) markFastRank(c *roaring.Bitmap) {
+	if ra.fastRank && !c.GetFastRank() {
+		c.SetFastRank(true)
+	}
+}
+
+// setFastRank enables or disables the rank index of every bucket that is not
+// shared with another bitmap.
+func (ra *roaringArray64) setFastRank(val bool) {
+	ra.fastRank = val
+	for i, c := range ra.containers {
+		if !ra.needCopyOnWrite[i] && c.GetFastRank() != val {
+			c.SetFastRank(val)
+		}
+	}
+}
+
 func (ra *roaringArray64) getIndex(x uint32) int {
 	// before the binary search, we optimize for frequent cases
 	size := len(ra.keys)
@@ -226,11 +255,54 @@ func (ra *roaringArray64) getIndex(x uint32) int {
 	return ra.binarySearch(0, int64(size), x)
 }
 
+// getIndexFrom is getIndex for a key known to be larger than the key at index
+// pos (or any key, if pos is -1). It gallops forward from pos, which is
+// cheaper than a binary search when successive keys are ascending.
+func (ra *roaringArray64) getIndexFrom(x uint32, pos int) int {
+	i := ra.advanceUntil(x, pos)
+	if i < len(ra.keys) && ra.keys[i] == x {
+		return i
+	}
+	return -i - 1
+}
+
+// forEachKeyRun calls f for every run of consecutive values of dat sharing
+// their 32 high bits, with the index of the bucket of that key as getIndex
+// would return it and the low bits of the values. f may insert or remove the
+// bucket of the key and returns its new index in the same form, so that the
+// next key can be looked up from there.
+func (ra *roaringArray64) forEachKeyRun(dat []uint64, f func(i int, hb uint32, run []uint32) int) {
+	var run []uint32
+	below := -1 // index of the last bucket whose key precedes the current one
+	for start := 0; start < len(dat); {
+		hb := highbits(dat[start])
+		run = run[:0]
+		end := start
+		for ; end < len(dat) && highbits(dat[end]) == hb; end++ {
+			run = append(run, lowbits(dat[end]))
+		}
+
+		var i int
+		if start > 0 && hb > highbits(dat[start-1]) {
+			i = ra.getIndexFrom(hb, below)
+		} else {
+			i = ra.getIndex(hb)
+		}
+		if i = f(i, hb, run); i >= 0 {
+			below = i
+		} else {
+			below = -i - 2
+		}
+		start = end
+	}
+}
+
 func (ra *roaringArray64) getKeyAtIndex(i int) uint32 {
 	return ra.keys[i]
 }
 
 func (ra *roaringArray64) insertNewKeyValueAt(i int, key uint32, value *roaring.Bitmap) {
+	ra.markFastRank(value)
 	ra.keys = append(ra.keys, 0)
 	ra.containers = append(ra.containers, nil)
 
@@ -264,6 +336,7 @@ func (ra *roaringArray64) removeAtIndex(i int) {
 }
 
 func (ra *roaringArray64) setContainerAtIndex(i int, c *roaring.Bitmap) {
+	ra.markFastRank(c)
 	ra.containers[i] = c
 }
 
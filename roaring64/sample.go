@@ -0,0 +1,125 @@
+package roaring64
+
+import (
+	"math/rand"
+	"sort"
+
+	"github.com/RoaringBitmap/roaring/v2"
+	"github.com/RoaringBitmap/roaring/v2/internal"
+)
+
+// Sample returns a bitmap holding k values of the bitmap drawn uniformly at
+// random without replacement, using rng as the source of randomness. A copy of
+// the whole bitmap is returned if k is at least its cardinality.
+//
+// The ranks of the values are drawn first, which decides how many values each
+// bucket contributes; the buckets then draw their own values.
+func (rb *Bitmap) Sample(k uint64, rng *rand.Rand) *Bitmap {
+	n := rb.GetCardinality()
+	if k >= n {
+		return rb.Clone()
+	}
+	answer := NewBitmap()
+	ra := &rb.highlowcontainer
+	rb.forEachBucketCount(rankCounter(internal.SampleRanks[uint64](NewBitmap(), n, k, rng)), func(i int, count uint64) {
+		answer.highlowcontainer.appendContainer(ra.getKeyAtIndex(i), ra.getContainerAtIndex(i).Sample(count, rng), false)
+	})
+	return answer
+}
+
+// SampleInto fills buf with values of the bitmap drawn uniformly at random
+// without replacement, in ascending order, using rng as the source of
+// randomness. It returns the number of values written, which is the smaller
+// of len(buf) and the cardinality of the bitmap.
+func (rb *Bitmap) SampleInto(buf []uint64, rng *rand.Rand) int {
+	n := rb.GetCardinality()
+	k := uint64(len(buf))
+	if k >= n {
+		return rb.ManyIterator().NextMany(buf[:n])
+	}
+	return rb.sampleBuckets(buf, rankCounter(internal.SampleRanks[uint64](NewBitmap(), n, k, rng)), func(c *roaring.Bitmap, lows []uint32) int {
+		return c.SampleInto(lows, rng)
+	})
+}
+
+// SampleWithReplacement fills buf with values of the bitmap drawn uniformly
+// and independently at random, so that a value may appear more than once,
+// using rng as the source of randomness. The values are written in ascending
+// order. It returns len(buf), or 0 if the bitmap is empty.
+func (rb *Bitmap) SampleWithReplacement(buf []uint64, rng *rand.Rand) int {
+	n := rb.GetCardinality()
+	if n == 0 {
+		return 0
+	}
+	ranks := make([]uint64, len(buf))
+	internal.RandomRanks(ranks, n, rng)
+	below := func(r uint64) uint64 {
+		return uint64(sort.Search(len(ranks), func(i int) bool { return ranks[i] >= r }))
+	}
+	return rb.sampleBuckets(buf, below, func(c *roaring.Bitmap, lows []uint32) int {
+		return c.SampleWithReplacement(lows, rng)
+	})
+}
+
+// Bernoulli returns a bitmap holding each value of the bitmap independently
+// with probability p, using rng as the source of randomness.
+func (rb *Bitmap) Bernoulli(p float64, rng *rand.Rand) *Bitmap {
+	if p >= 1 {
+		return rb.Clone()
+	}
+	answer := NewBitmap()
+	if !(p > 0) {
+		return answer
+	}
+	ra := &rb.highlowcontainer
+	for i, c := range ra.containers {
+		if sample := c.Bernoulli(p, rng); !sample.IsEmpty() {
+			answer.highlowcontainer.appendContainer(ra.getKeyAtIndex(i), sample, false)
+		}
+	}
+	return answer
+}
+
+// sampleBuckets writes to buf the values drawn by sample from every bucket,
+// given below(r), the number of drawn ranks smaller than r.
+func (rb *Bitmap) sampleBuckets(buf []uint64, below func(r uint64) uint64, sample func(c *roaring.Bitmap, lows []uint32) int) int {
+	n := 0
+	var lows []uint32
+	ra := &rb.highlowcontainer
+	rb.forEachBucketCount(below, func(i int, count uint64) {
+		if uint64(cap(lows)) < count {
+			lows = make([]uint32, count)
+		}
+		hs := uint64(ra.getKeyAtIndex(i)) << 32
+		for _, low := range lows[:sample(ra.getContainerAtIndex(i), lows[:count])] {
+			buf[n] = hs | uint64(low)
+			n++
+		}
+	})
+	return n
+}
+
+// forEachBucketCount calls f with the index of every bucket receiving drawn
+// ranks and their number, given below(r), the number of drawn ranks smaller
+// than r.
+func (rb *Bitmap) forEachBucketCount(below func(r uint64) uint64, f func(i int, count uint64)) {
+	end, seen := uint64(0), uint64(0)
+	for i, c := range rb.highlowcontainer.containers {
+		end += c.GetCardinality()
+		if count := below(end) - seen; count > 0 {
+			f(i, count)
+			seen += count
+		}
+	}
+}
+
+// rankCounter returns the function counting the ranks of a bitmap smaller
+// than r, as expected by forEachBucketCount.
+func rankCounter(ranks *Bitmap) func(r uint64) uint64 {
+	return func(r uint64) uint64 {
+		if r == 0 {
+			return 0
+		}
+		return ranks.Rank(r - 1)
+	}
+}
@@ -0,0 +1,154 @@
+//go:build (386 && !appengine) || (amd64 && !appengine) || (arm && !appengine) || (arm64 && !appengine) || (ppc64le && !appengine) || (mipsle && !appengine) || (mips64le && !appengine) || (mips64p32le && !appengine) || (wasm && !appengine)
+// +build 386,!appengine amd64,!appengine arm,!appengine arm64,!appengine ppc64le,!appengine mipsle,!appengine mips64le,!appengine mips64p32le,!appengine wasm,!appengine
+
+package roaring64
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func frozenTestBitmap() *Bitmap {
+	rb := NewBitmap()
+	// array container
+	rb.AddMany([]uint64{1, 2, 3, 1000, 1 << 20})
+	// bitmap container in a second bucket
+	for i := uint64(0); i < 10000; i += 3 {
+		rb.Add(1<<32 + i)
+	}
+	// run container in a third bucket, spanning several 16-bit keys
+	rb.AddRange(5<<32+100, 5<<32+300000)
+	rb.Add(maxUint32<<32 | maxUint32)
+	rb.RunOptimize()
+	return rb
+}
+
+func TestFrozenRoundTrip(t *testing.T) {
+	for _, rb := range []*Bitmap{NewBitmap(), BitmapOf(42), frozenTestBitmap()} {
+		buf, err := rb.Freeze()
+		require.NoError(t, err)
+		assert.EqualValues(t, rb.GetFrozenSizeInBytes(), len(buf))
+
+		view := NewBitmap()
+		require.NoError(t, view.MustFrozenView(buf))
+		assert.True(t, rb.Equals(view))
+		assert.Equal(t, rb.GetCardinality(), view.GetCardinality())
+
+		wr := &bytes.Buffer{}
+		n, err := rb.WriteFrozenTo(wr)
+		require.NoError(t, err)
+		assert.Equal(t, len(buf), n)
+		assert.Equal(t, buf, wr.Bytes())
+	}
+}
+
+func TestFrozenViewCopyOnWrite(t *testing.T) {
+	rb := frozenTestBitmap()
+	buf, err := rb.Freeze()
+	require.NoError(t, err)
+	orig := append([]byte(nil), buf...)
+
+	view := NewBitmap()
+	require.NoError(t, view.FrozenView(buf))
+
+	view.Add(7)
+	view.Remove(1<<32 + 3)
+	view.RemoveRange(5<<32, 6<<32)
+	view.Or(BitmapOf(1<<32+1, 9<<40))
+
+	assert.Equal(t, orig, buf)
+	assert.True(t, view.Contains(7))
+	assert.False(t, view.Contains(5<<32+100))
+
+	again := NewBitmap()
+	require.NoError(t, again.FrozenView(buf))
+	assert.True(t, rb.Equals(again))
+}
+
+func TestFrozenFreezeToBufferTooSmall(t *testing.T) {
+	rb := frozenTestBitmap()
+	buf := make([]byte, rb.GetFrozenSizeInBytes()-1)
+	_, err := rb.FreezeTo(buf)
+	assert.ErrorIs(t, err, ErrFrozenBitmapBufferTooSmall)
+}
+
+func TestFrozenViewErrors(t *testing.T) {
+	buf, err := frozenTestBitmap().Freeze()
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, NewBitmap().FrozenView(buf[:8]), ErrFrozenBitmapIncomplete)
+
+	badCookie := append([]byte(nil), buf...)
+	badCookie[len(badCookie)-1] ^= 0xff
+	assert.ErrorIs(t, NewBitmap().FrozenView(badCookie), ErrFrozenBitmapInvalidCookie)
+
+	bigEndian := append([]byte(nil), buf...)
+	binary.BigEndian.PutUint32(bigEndian[len(bigEndian)-4:], frozenCookie64)
+	assert.ErrorIs(t, NewBitmap().FrozenView(bigEndian), ErrFrozenBitmapBigEndian)
+
+	tooMany := append([]byte(nil), buf...)
+	binary.LittleEndian.PutUint64(tooMany[len(tooMany)-12:], 1<<32)
+	assert.ErrorIs(t, NewBitmap().FrozenView(tooMany), ErrFrozenBitmapOverpopulated)
+
+	single, err := BitmapOf(42).Freeze()
+	require.NoError(t, err)
+	// one bucket: the trailer holds 12 bytes of metadata plus 12 bytes for the bucket
+	spurious := append([]byte(nil), single[:len(single)-24]...)
+	spurious = append(spurious, make([]byte, frozenBucketAlignment)...)
+	spurious = append(spurious, single[len(single)-24:]...)
+	assert.ErrorIs(t, NewBitmap().FrozenView(spurious), ErrFrozenBitmapUnexpectedData)
+
+	truncated := append([]byte(nil), buf[frozenBucketAlignment:]...)
+	assert.Error(t, NewBitmap().FrozenView(truncated))
+}
+
+func TestMappedFrozenBitmap(t *testing.T) {
+	rb := frozenTestBitmap()
+	buf, err := rb.Freeze()
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "bitmap.frozen")
+	require.NoError(t, os.WriteFile(path, buf, 0o600))
+
+	mb, err := OpenMappedFrozenBitmap(path)
+	require.NoError(t, err)
+	assert.NoError(t, mb.View(func(mapped *Bitmap) error {
+		assert.True(t, rb.Equals(mapped))
+		mapped.Add(7)
+		mapped.RemoveRange(5<<32, 6<<32)
+		assert.True(t, mapped.Contains(7))
+		return nil
+	}))
+	assert.NoError(t, mb.Close())
+	assert.ErrorIs(t, mb.View(func(*Bitmap) error { return nil }), ErrMappingClosed)
+}
+
+func TestChecksummedFrozen(t *testing.T) {
+	rb := frozenTestBitmap()
+	buf, err := rb.FreezeChecksummed()
+	require.NoError(t, err)
+
+	view := NewBitmap()
+	require.NoError(t, view.ChecksummedFrozenView(buf))
+	assert.True(t, rb.Equals(view))
+
+	// the frozen payload starts with the first container of the first bucket
+	first := rb.highlowcontainer.containers[0].ContainerChecksums(nil)[0]
+	corrupted := append([]byte(nil), buf...)
+	corrupted[checksumHeaderSize] ^= 0x01
+	err = view.ChecksummedFrozenView(corrupted)
+	var corruption *CorruptionError
+	if assert.ErrorAs(t, err, &corruption) {
+		assert.Equal(t, uint64(rb.highlowcontainer.keys[0])<<16|uint64(first.Key), corruption.Key)
+	}
+	assert.True(t, view.IsEmpty())
+
+	assert.ErrorIs(t, view.ChecksummedFrozenView(buf[:len(buf)-1]), ErrChecksumCorrupted)
+	assert.ErrorIs(t, view.ChecksummedFrozenView(make([]byte, 64)), ErrChecksumInvalidCookie)
+}
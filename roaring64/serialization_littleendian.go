@@ -0,0 +1,315 @@
+//go:build (386 && !appengine) || (amd64 && !appengine) || (arm && !appengine) || (arm64 && !appengine) || (ppc64le && !appengine) || (mipsle && !appengine) || (mips64le && !appengine) || (mips64p32le && !appengine) || (wasm && !appengine)
+// +build 386,!appengine amd64,!appengine arm,!appengine arm64,!appengine ppc64le,!appengine mipsle,!appengine mips64le,!appengine mips64p32le,!appengine wasm,!appengine
+
+package roaring64
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/RoaringBitmap/roaring/v2"
+	"github.com/RoaringBitmap/roaring/v2/internal"
+)
+
+/* FROZEN SERIALIZATION FORMAT DESCRIPTION (64-bit)
+ *
+ * -- (beginning must be aligned by 32 bytes) --
+ * <buckets>  for every high-32 bucket, the 32-bit frozen bitmap holding its
+ *            low 32 bits, followed by zero padding up to a multiple of 32 bytes
+ * <sizes>    uint64_t[num_buckets]
+ * <keys>     uint32_t[num_buckets]
+ * <count>    uint64_t
+ * <header>   uint32_t
+ *
+ * <header> is the frozenCookie64 value.
+ *
+ * <count> is the number of buckets, i.e., the number of distinct high 32 bits.
+ *
+ * <sizes> stores the unpadded size in bytes of every frozen bucket. The offset
+ * of a bucket is the sum of the padded sizes of all buckets before it.
+ *
+ * Every bucket uses the 32-bit frozen format of roaring.Bitmap.Freeze, so the
+ * containers of a view point directly into the buffer, exactly as they do for
+ * roaring.Bitmap.FrozenView. Padding keeps every bucket aligned by 32 bytes
+ * as long as the buffer itself is.
+ */
+const frozenCookie64 = 0x52463634 // "46FR" in little endian
+
+const frozenBucketAlignment = 32
+
+var (
+	// ErrFrozenBitmapInvalidCookie is returned when the trailer does not contain the frozenCookie64.
+	ErrFrozenBitmapInvalidCookie = errors.New("trailer does not contain the 64-bit frozen cookie")
+	// ErrFrozenBitmapBigEndian is returned when the trailer is big endian.
+	ErrFrozenBitmapBigEndian = errors.New("loading big endian frozen bitmaps is not supported")
+	// ErrFrozenBitmapIncomplete is returned when the buffer is too small to contain a frozen bitmap.
+	ErrFrozenBitmapIncomplete = errors.New("input buffer too small to contain a frozen bitmap")
+	// ErrFrozenBitmapOverpopulated is returned when the number of buckets is too large.
+	ErrFrozenBitmapOverpopulated = errors.New("too many buckets")
+	// ErrFrozenBitmapUnexpectedData is returned when the buffer contains unexpected data.
+	ErrFrozenBitmapUnexpectedData = errors.New("spurious data in input")
+	// ErrFrozenBitmapBufferTooSmall is returned when the buffer is too small.
+	ErrFrozenBitmapBufferTooSmall = errors.New("buffer too small")
+)
+
+// frozenPadding returns the number of zero bytes following a frozen bucket of size sz.
+func frozenPadding(sz uint64) uint64 {
+	return (frozenBucketAlignment - sz%frozenBucketAlignment) % frozenBucketAlignment
+}
+
+// FrozenView creates a static view of a serialized bitmap stored in buf,
+// as written by Freeze, FreezeTo or WriteFrozenTo.
+//
+// The high 32 bits of every value select a bucket, and every bucket is
+// loaded with roaring.Bitmap.FrozenView, so the same rules apply: buf is
+// expected to be a constant, the function makes the best effort attempt
+// not to copy data and only little endian is supported.
+// If said buffer comes from a memory map, it's advisable to give it read
+// only permissions, either at creation or by calling Mprotect from the
+// golang.org/x/sys/unix package.
+//
+// Resulting bitmaps are effectively immutable in the following sense:
+// a copy-on-write marker is used so that when you modify the resulting
+// bitmap, copies of selected data (containers) are made.
+// You should *not* change the copy-on-write status of the resulting
+// bitmaps (SetCopyOnWrite).
+//
+// If buf becomes unavailable, then a bitmap created with
+// FrozenView would be effectively broken. Furthermore, any
+// bitmap derived from this bitmap (e.g., via Or, And) might
+// also be broken. Thus, before making buf unavailable, you should
+// call CloneCopyOnWriteContainers on all such bitmaps.
+func (rb *Bitmap) FrozenView(buf []byte) error {
+	return rb.highlowcontainer.frozenView(buf)
+}
+
+// MustFrozenView calls FrozenView internally.
+// After loading the view, Validate will be called and its error returned.
+func (rb *Bitmap) MustFrozenView(buf []byte) error {
+	if err := rb.FrozenView(buf); err != nil {
+		return err
+	}
+	return rb.Validate()
+}
+
+// OpenMappedFrozenBitmap maps the file at path read-only and loads it with
+// FrozenView. The file is expected to hold a bitmap in the 64-bit frozen
+// format (e.g., as written by WriteFrozenTo). See MappedBitmap.
+func OpenMappedFrozenBitmap(path string) (*MappedBitmap, error) {
+	return openMapped(path, func(rb *Bitmap, buf []byte) error {
+		return rb.FrozenView(buf)
+	})
+}
+
+func (ra *roaringArray64) frozenView(buf []byte) error {
+	if len(buf) < 12 {
+		return ErrFrozenBitmapIncomplete
+	}
+
+	if binary.BigEndian.Uint32(buf[len(buf)-4:]) == frozenCookie64 {
+		return ErrFrozenBitmapBigEndian
+	}
+	if binary.LittleEndian.Uint32(buf[len(buf)-4:]) != frozenCookie64 {
+		return ErrFrozenBitmapInvalidCookie
+	}
+	buf = buf[:len(buf)-4]
+
+	count := binary.LittleEndian.Uint64(buf[len(buf)-8:])
+	buf = buf[:len(buf)-8]
+	if count >= 1<<32 {
+		return ErrFrozenBitmapOverpopulated
+	}
+
+	// 8 bytes per size, 4 bytes per key.
+	nBuckets := int(count)
+	if uint64(len(buf)) < 12*count {
+		return ErrFrozenBitmapIncomplete
+	}
+
+	keysBuf := buf[len(buf)-4*nBuckets:]
+	buf = buf[:len(buf)-4*nBuckets]
+
+	sizesBuf := buf[len(buf)-8*nBuckets:]
+	buf = buf[:len(buf)-8*nBuckets]
+
+	keys := make([]uint32, nBuckets)
+	containers := make([]*roaring.Bitmap, nBuckets)
+	needCOW := make([]bool, nBuckets)
+
+	for i := 0; i < nBuckets; i++ {
+		keys[i] = binary.LittleEndian.Uint32(keysBuf[4*i:])
+		sz := binary.LittleEndian.Uint64(sizesBuf[8*i:])
+		if sz > uint64(len(buf)) {
+			return ErrFrozenBitmapIncomplete
+		}
+
+		c := roaring.NewBitmap()
+		if err := c.FrozenView(buf[:sz]); err != nil {
+			return err
+		}
+		containers[i] = c
+		needCOW[i] = true
+
+		sz += frozenPadding(sz)
+		if sz > uint64(len(buf)) {
+			return ErrFrozenBitmapIncomplete
+		}
+		buf = buf[sz:]
+	}
+
+	if len(buf) != 0 {
+		return ErrFrozenBitmapUnexpectedData
+	}
+
+	ra.keys = keys
+	ra.containers = containers
+	ra.needCopyOnWrite = needCOW
+	ra.copyOnWrite = true
+
+	return nil
+}
+
+// GetFrozenSizeInBytes returns the size in bytes of the frozen bitmap.
+func (rb *Bitmap) GetFrozenSizeInBytes() uint64 {
+	size := uint64(12)
+	for _, c := range rb.highlowcontainer.containers {
+		sz := c.GetFrozenSizeInBytes()
+		size += sz + frozenPadding(sz) + 12
+	}
+	return size
+}
+
+// Freeze serializes the bitmap in the 64-bit frozen format (see FrozenView).
+func (rb *Bitmap) Freeze() ([]byte, error) {
+	sz := rb.GetFrozenSizeInBytes()
+	buf := make([]byte, sz)
+	_, err := rb.FreezeTo(buf)
+	return buf, err
+}
+
+// FreezeTo serializes the bitmap in the 64-bit frozen format (see FrozenView).
+func (rb *Bitmap) FreezeTo(buf []byte) (int, error) {
+	serialSize := rb.GetFrozenSizeInBytes()
+	if uint64(len(buf)) < serialSize {
+		return 0, ErrFrozenBitmapBufferTooSmall
+	}
+
+	ra := &rb.highlowcontainer
+	nBuckets := len(ra.keys)
+	pos := uint64(0)
+	sizes := make([]uint64, nBuckets)
+
+	for i, c := range ra.containers {
+		sz := c.GetFrozenSizeInBytes()
+		if _, err := c.FreezeTo(buf[pos : pos+sz]); err != nil {
+			return 0, err
+		}
+		sizes[i] = sz
+		pos += sz
+		pad := frozenPadding(sz)
+		clear(buf[pos : pos+pad])
+		pos += pad
+	}
+
+	for _, sz := range sizes {
+		binary.LittleEndian.PutUint64(buf[pos:], sz)
+		pos += 8
+	}
+	for _, key := range ra.keys {
+		binary.LittleEndian.PutUint32(buf[pos:], key)
+		pos += 4
+	}
+	binary.LittleEndian.PutUint64(buf[pos:], uint64(nBuckets))
+	pos += 8
+	binary.LittleEndian.PutUint32(buf[pos:], frozenCookie64)
+
+	return int(serialSize), nil
+}
+
+// WriteFrozenTo serializes the bitmap in the 64-bit frozen format (see FrozenView).
+func (rb *Bitmap) WriteFrozenTo(wr io.Writer) (int, error) {
+	ra := &rb.highlowcontainer
+	nBuckets := len(ra.keys)
+	written := 0
+	var padding [frozenBucketAlignment]byte
+
+	trailer := make([]byte, 12*nBuckets+12)
+	for i, c := range ra.containers {
+		n, err := c.WriteFrozenTo(wr)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		sz := uint64(n)
+		n, err = wr.Write(padding[:frozenPadding(sz)])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		binary.LittleEndian.PutUint64(trailer[8*i:], sz)
+		binary.LittleEndian.PutUint32(trailer[8*nBuckets+4*i:], ra.keys[i])
+	}
+	binary.LittleEndian.PutUint64(trailer[12*nBuckets:], uint64(nBuckets))
+	binary.LittleEndian.PutUint32(trailer[12*nBuckets+8:], frozenCookie64)
+
+	n, err := wr.Write(trailer)
+	written += n
+	return written, err
+}
+
+// FreezeChecksummed serializes the bitmap in the 64-bit frozen format (see
+// Freeze), wrapped in an envelope holding the CRC32C checksum of every
+// 16-bit container (see WriteChecksummedTo). Such a bitmap is loaded with
+// ChecksummedFrozenView.
+func (rb *Bitmap) FreezeChecksummed() ([]byte, error) {
+	sz := rb.GetFrozenSizeInBytes()
+	buf := make([]byte, checksumHeaderSize+sz)
+	payload := buf[checksumHeaderSize:]
+	if _, err := rb.FreezeTo(payload); err != nil {
+		return nil, err
+	}
+	// checksum the containers exactly as they will be read back
+	view := NewBitmap()
+	if err := view.FrozenView(payload); err != nil {
+		return nil, err
+	}
+	buf = view.appendChecksumTable(buf)
+	checksumEnvelope.PutHeader(buf, checksummedFrozen, sz, buf[checksumHeaderSize+sz:])
+	return buf, nil
+}
+
+// ChecksummedFrozenView loads a bitmap written by FreezeChecksummed with
+// FrozenView, so the same rules apply to buf, and checks every container
+// against its checksum. If a container does not match, it returns a
+// *CorruptionError naming its key; every corruption error wraps
+// ErrChecksumCorrupted. The bitmap is empty after an error.
+func (rb *Bitmap) ChecksummedFrozenView(buf []byte) (err error) {
+	defer func() {
+		if err != nil {
+			rb.Clear()
+		}
+	}()
+
+	if len(buf) < checksumHeaderSize {
+		return ErrFrozenBitmapIncomplete
+	}
+	payloadLen, tableLen, err := checksumEnvelope.ParseHeader(buf, checksummedFrozen)
+	if err != nil {
+		return err
+	}
+	rest := uint64(len(buf) - checksumHeaderSize)
+	if payloadLen > rest || tableLen != rest-payloadLen {
+		return fmt.Errorf("%w: unexpected payload length", ErrChecksumCorrupted)
+	}
+	payload := buf[checksumHeaderSize : checksumHeaderSize+payloadLen]
+	table := buf[checksumHeaderSize+payloadLen:]
+	if err := internal.CheckChecksumTable(buf, table); err != nil {
+		return err
+	}
+	if err := rb.FrozenView(payload); err != nil {
+		return fmt.Errorf("%w: %w", ErrChecksumCorrupted, err)
+	}
+	return rb.verifyContainerChecksums(table)
+}
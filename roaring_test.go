@@ -8,6 +8,7 @@ import (
 	"math/rand"
 	randv2 "math/rand/v2"
 
+	"sort"
 	"strconv"
 	"testing"
 
@@ -4184,3 +4185,309 @@ func TestBitmapOrBulkMergeCopyOnWriteTailOwnership(t *testing.T) {
 		t.Fatalf("source became invalid after tail mutations: %v", err)
 	}
 }
+
+func TestAbsentValueAtContainerBoundaries(t *testing.T) {
+	rb := NewBitmap()
+	rb.AddRange(0, 1<<16)
+	assert.Equal(t, int64(1<<16), rb.NextAbsentValue(5))
+	assert.Equal(t, int64(-1), rb.PreviousAbsentValue(5))
+
+	rb = NewBitmap()
+	rb.AddRange(1<<16, 1<<17)
+	assert.Equal(t, int64(1<<16-1), rb.PreviousAbsentValue(70000))
+	assert.Equal(t, int64(1<<17), rb.NextAbsentValue(70000))
+
+	// adjacent full containers
+	rb.AddRange(1<<17, 1<<17+10)
+	assert.Equal(t, int64(1<<17+10), rb.NextAbsentValue(70000))
+
+	rb = NewBitmap()
+	rb.AddRange(0, MaxUint32+1)
+	assert.Equal(t, int64(-1), rb.NextAbsentValue(5))
+	assert.Equal(t, int64(-1), rb.PreviousAbsentValue(5))
+
+	rb = NewBitmap()
+	rb.AddRange(MaxUint32-10, MaxUint32+1)
+	assert.Equal(t, int64(-1), rb.NextAbsentValue(MaxUint32-5))
+	assert.Equal(t, int64(MaxUint32-11), rb.PreviousAbsentValue(MaxUint32-5))
+}
+
+func TestSetRelations(t *testing.T) {
+	a := BitmapOf(1, 2, 3, 1<<16|5)
+	a.AddRange(3<<16, 3<<16+10000)
+	b := a.Clone()
+	b.Add(7 << 16)
+	b.AddRange(3<<16+10000, 3<<16+20000)
+	b.RunOptimize()
+	c := BitmapOf(1, 1<<20)
+	d := BitmapOf(4, 1<<20)
+	empty := NewBitmap()
+
+	cases := []struct {
+		x, y     *Bitmap
+		relation SetRelation
+	}{
+		{a, a, RelationEqual},
+		{a, a.Clone(), RelationEqual},
+		{a, b, RelationSubset},
+		{b, a, RelationSuperset},
+		{a, c, RelationOverlap},
+		{a, d, RelationDisjoint},
+		{empty, a, RelationSubset},
+		{a, empty, RelationSuperset},
+		{empty, NewBitmap(), RelationEqual},
+	}
+	for i, tc := range cases {
+		assert.Equal(t, tc.relation, tc.x.Compare(tc.y), i)
+
+		// the predicates agree with materialized set operations
+		subset := AndNot(tc.x, tc.y).IsEmpty()
+		superset := AndNot(tc.y, tc.x).IsEmpty()
+		assert.Equal(t, subset, tc.x.IsSubset(tc.y), i)
+		assert.Equal(t, superset, tc.x.IsSuperset(tc.y), i)
+		assert.Equal(t, subset && !superset, tc.x.IsStrictSubset(tc.y), i)
+		assert.Equal(t, And(tc.x, tc.y).IsEmpty(), tc.x.IsDisjoint(tc.y), i)
+	}
+
+	// a missing value in a shared container
+	e := b.Clone()
+	e.Remove(3<<16 + 5)
+	assert.False(t, a.IsSubset(e))
+	assert.Equal(t, RelationOverlap, a.Compare(e))
+	assert.Equal(t, "overlap", a.Compare(e).String())
+}
+
+func TestCardinalityOnlyOperations(t *testing.T) {
+	a := BitmapOf(1, 2, 3, 1<<16|5, 9<<16)
+	a.AddRange(3<<16, 3<<16+10000)
+	b := BitmapOf(2, 3, 4, 2<<16)
+	b.AddRange(3<<16+5000, 3<<16+20000)
+	b.RunOptimize()
+
+	for _, pair := range [][2]*Bitmap{{a, b}, {b, a}, {a, a}, {a, NewBitmap()}, {NewBitmap(), NewBitmap()}} {
+		x, y := pair[0], pair[1]
+		assert.Equal(t, Xor(x, y).GetCardinality(), x.XorCardinality(y))
+		assert.Equal(t, AndNot(x, y).GetCardinality(), x.AndNotCardinality(y))
+	}
+
+	and := float64(And(a, b).GetCardinality())
+	card1, card2 := float64(a.GetCardinality()), float64(b.GetCardinality())
+	assert.InDelta(t, and/float64(Or(a, b).GetCardinality()), a.JaccardIndex(b), 1e-12)
+	assert.InDelta(t, 2*and/(card1+card2), a.DiceCoefficient(b), 1e-12)
+	assert.InDelta(t, and/min(card1, card2), a.OverlapCoefficient(b), 1e-12)
+
+	assert.Equal(t, 1.0, a.JaccardIndex(a.Clone()))
+	assert.Equal(t, 0.0, a.JaccardIndex(BitmapOf(7)))
+	assert.Equal(t, 1.0, NewBitmap().JaccardIndex(NewBitmap()))
+	assert.Equal(t, 1.0, NewBitmap().DiceCoefficient(NewBitmap()))
+	assert.Equal(t, 1.0, a.OverlapCoefficient(BitmapOf(2, 3)))
+	assert.Equal(t, 1.0, a.OverlapCoefficient(NewBitmap()))
+}
+
+func TestBatchOperations(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	base := NewBitmap()
+	for i := uint32(0); i < 6000; i++ {
+		base.Add(i * 2) // key 0 holds a bitmap container
+	}
+	base.AddRange(3<<16, 3<<16+50000) // key 3 holds a run container
+	base.AddMany([]uint32{5<<16 + 1, 5<<16 + 9, 8 << 16})
+	base.RunOptimize()
+
+	var values []uint32
+	for i := 0; i < 20000; i++ {
+		values = append(values, uint32(r.Intn(10<<16)))
+	}
+	values = append(values, 5<<16+1, 5<<16+9, 8<<16) // empties their containers
+	sorted := append([]uint32(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var unique []uint32
+	for i, x := range sorted {
+		if i == 0 || x != sorted[i-1] {
+			unique = append(unique, x)
+		}
+	}
+
+	for _, dat := range [][]uint32{nil, values, sorted, unique} {
+		shared := base.Clone()
+		shared.SetCopyOnWrite(true)
+		rb := shared.Clone() // the containers are shared with copy-on-write
+
+		contains := rb.ContainsMany(dat)
+		require.Len(t, contains, len(dat))
+		for i, x := range dat {
+			assert.Equal(t, base.Contains(x), contains[i])
+		}
+
+		expected := base.Clone()
+		for _, x := range dat {
+			if expected.Contains(x) {
+				expected.Remove(x)
+			} else {
+				expected.Add(x)
+			}
+		}
+		rb.FlipMany(dat)
+		require.NoError(t, rb.Validate())
+		assert.True(t, expected.Equals(rb))
+
+		for _, x := range dat {
+			expected.Remove(x)
+		}
+		rb.RemoveMany(dat)
+		require.NoError(t, rb.Validate())
+		assert.True(t, expected.Equals(rb))
+
+		assert.True(t, base.Equals(shared))
+	}
+}
+
+func TestRangeRestrictedOperations(t *testing.T) {
+	x1 := NewBitmap()
+	x2 := NewBitmap()
+	for i := uint32(0); i < 200000; i += 3 {
+		x1.Add(i)
+	}
+	for i := uint32(0); i < 300000; i += 5 {
+		x2.Add(i)
+	}
+	x1.AddRange(5<<16, 7<<16+100)
+	x2.AddRange(6<<16+10, 9<<16)
+	x1.AddMany([]uint32{20 << 16, MaxUint32})
+	x2.AddMany([]uint32{20<<16 + 1, MaxUint32})
+	x2.RunOptimize()
+
+	ranges := [][2]uint64{
+		{0, 0}, {10, 5}, {0, 1 << 32}, {0, 1<<32 + 10}, {7, 100}, {1<<16 - 7, 3<<16 + 11},
+		{1 << 16, 3 << 16}, {6<<16 + 5, 6<<16 + 50}, {100, 8<<16 + 3}, {20 << 16, 20<<16 + 2},
+		{MaxUint32, 1 << 32},
+	}
+	for _, r := range ranges {
+		window := NewBitmap()
+		if r[1] > MaxUint32+1 {
+			window.AddRange(r[0], MaxUint32+1)
+		} else {
+			window.AddRange(r[0], r[1])
+		}
+
+		expected := And(And(x1, x2), window)
+		actual := AndInRange(x1, x2, r[0], r[1])
+		require.NoError(t, actual.Validate())
+		assert.True(t, expected.Equals(actual), "range %v", r)
+		assert.Equal(t, expected.GetCardinality(), x1.AndCardinalityInRange(x2, r[0], r[1]), "range %v", r)
+
+		expected = And(Or(x1, x2), window)
+		actual = OrInRange(x1, x2, r[0], r[1])
+		require.NoError(t, actual.Validate())
+		assert.True(t, expected.Equals(actual), "range %v", r)
+	}
+}
+
+func TestSliceAndSelectRange(t *testing.T) {
+	rb := NewBitmap()
+	for i := uint32(0); i < 10000; i += 3 {
+		rb.Add(i) // an array container
+	}
+	for i := uint32(0); i < 30000; i += 2 {
+		rb.Add(2<<16 + i) // a bitmap container
+	}
+	rb.AddRange(3<<16+100, 5<<16+50) // run containers, one of them full
+	rb.RunOptimize()
+	all := rb.ToArray()
+	total := uint64(len(all))
+
+	for _, offset := range []uint64{0, 1, 3333, 3334, 10000, 18334, 18335, 100000, total - 1, total, total + 5} {
+		for _, limit := range []uint64{0, 1, 500, 70000, math.MaxUint64} {
+			var expected []uint32
+			if offset < total {
+				expected = all[offset:]
+				if limit < uint64(len(expected)) {
+					expected = expected[:limit]
+				}
+			}
+
+			slice := rb.Slice(offset, limit)
+			require.NoError(t, slice.Validate())
+			assert.Equal(t, len(expected), int(slice.GetCardinality()), "offset=%d limit=%d", offset, limit)
+			assert.True(t, BitmapOf(expected...).Equals(slice), "offset=%d limit=%d", offset, limit)
+
+			if limit > 70000 {
+				continue
+			}
+			buf := make([]uint32, limit)
+			n := rb.SelectRange(offset, buf)
+			assert.Equal(t, len(expected), n, "offset=%d limit=%d", offset, limit)
+			if len(expected) > 0 {
+				assert.Equal(t, expected, buf[:n], "offset=%d limit=%d", offset, limit)
+			}
+		}
+	}
+
+	// the bitmap is left untouched
+	assert.Equal(t, all, rb.ToArray())
+}
+
+func TestFastRank(t *testing.T) {
+	fast := NewBitmap()
+	fast.SetFastRank(true)
+	assert.True(t, fast.GetFastRank())
+	slow := NewBitmap()
+
+	check := func(step string) {
+		t.Helper()
+		card := slow.GetCardinality()
+		require.Equal(t, card, fast.GetCardinality(), step)
+		for _, x := range []uint32{0, 1, 100, 1 << 16, 3<<16 + 7, 9 << 16, MaxUint32} {
+			assert.Equal(t, slow.Rank(x), fast.Rank(x), "%s: rank %d", step, x)
+			assert.Equal(t, slow.CardinalityInRange(1, uint64(x)), fast.CardinalityInRange(1, uint64(x)), "%s: range %d", step, x)
+		}
+		for _, i := range []uint64{0, 1, card / 3, card / 2, card - 1, card} {
+			want, wantErr := slow.Select(uint32(i))
+			got, err := fast.Select(uint32(i))
+			assert.Equal(t, wantErr != nil, err != nil, "%s: select %d", step, i)
+			assert.Equal(t, want, got, "%s: select %d", step, i)
+		}
+		assert.Equal(t, slow.Slice(card/4, card/2).ToArray(), fast.Slice(card/4, card/2).ToArray(), step)
+	}
+	both := func(step string, f func(rb *Bitmap)) {
+		f(fast)
+		f(slow)
+		check(step)
+	}
+
+	check("empty")
+	both("add", func(rb *Bitmap) {
+		for i := uint32(0); i < 20000; i += 7 {
+			rb.Add(i)
+		}
+	})
+	both("add range", func(rb *Bitmap) { rb.AddRange(3<<16, 5<<16+9) })
+	both("remove", func(rb *Bitmap) { rb.Remove(14) })
+	both("remove range", func(rb *Bitmap) { rb.RemoveRange(4<<16, 4<<16+100) })
+	both("flip", func(rb *Bitmap) { rb.Flip(8<<16, 9<<16+3) })
+	both("or", func(rb *Bitmap) { rb.Or(BitmapOf(1, 2<<16, 7<<16)) })
+	both("and not", func(rb *Bitmap) { rb.AndNot(BitmapOf(21, 2<<16)) })
+	both("xor", func(rb *Bitmap) { rb.Xor(BitmapOf(21, 22, 10<<16)) })
+	both("and", func(rb *Bitmap) { rb.And(Flip(BitmapOf(0, 28), 0, 11<<16)) })
+	both("run optimize", func(rb *Bitmap) { rb.RunOptimize() })
+
+	// a copy-on-write clone keeps the property, and modifying either of the
+	// two bitmaps leaves the other one's ranks intact
+	fast.SetCopyOnWrite(true)
+	slow.SetCopyOnWrite(true)
+	fastClone, slowClone := fast.Clone(), slow.Clone()
+	assert.True(t, fastClone.GetFastRank())
+	both("clone", func(rb *Bitmap) { rb.Add(3<<16 - 1) })
+	fastClone.Remove(3 << 16)
+	slowClone.Remove(3 << 16)
+	check("clone modified")
+	fast, slow = fastClone, slowClone
+	check("clone")
+
+	both("clear", func(rb *Bitmap) { rb.Clear() })
+
+	fast.AddRange(0, 1000)
+	fast.SetFastRank(false)
+	assert.False(t, fast.GetFastRank())
+	assert.Equal(t, uint64(1000), fast.GetCardinality())
+}
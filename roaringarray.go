@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 
 	"github.com/RoaringBitmap/roaring/v2/internal"
 )
@@ -65,6 +66,7 @@ type container interface {
 	isFull() bool
 	ior(r container) container   // i stands for inplace
 	intersects(r container) bool // whether the two containers intersect
+	isSubset(r container) bool   // whether every value of the container is in r
 	lazyOR(r container) container
 	lazyIOR(r container) container
 	getSizeInBytes() int
@@ -123,6 +125,12 @@ type roaringArray struct {
 	containers      []container `msg:"-"` // don't try to serialize directly.
 	needCopyOnWrite []bool
 	copyOnWrite     bool
+
+	// fastRank enables cumulativeCards: cumulativeCards[i] is the total
+	// cardinality of containers[:i+1]. It is discarded (set to nil) by every
+	// modification and rebuilt by the next query needing it.
+	fastRank        bool
+	cumulativeCards []uint64
 }
 
 func newRoaringArray() *roaringArray {
@@ -143,6 +151,7 @@ func (ra *roaringArray) runOptimize() {
 }
 
 func (ra *roaringArray) appendContainer(key uint16, value container, mustCopyOnWrite bool) {
+	ra.invalidateRanks()
 	ra.keys = append(ra.keys, key)
 	ra.containers = append(ra.containers, value)
 	ra.needCopyOnWrite = append(ra.needCopyOnWrite, mustCopyOnWrite)
@@ -241,6 +250,7 @@ func (ra *roaringArray) removeIndexRange(begin, end int) {
 }
 
 func (ra *roaringArray) resize(newsize int) {
+	ra.invalidateRanks()
 	for k := newsize; k < len(ra.containers); k++ {
 		ra.containers[k] = nil
 	}
@@ -258,6 +268,7 @@ func (ra *roaringArray) clear() {
 func (ra *roaringArray) clone() *roaringArray {
 	sa := roaringArray{}
 	sa.copyOnWrite = ra.copyOnWrite
+	sa.fastRank = ra.fastRank
 
 	// this is where copyOnWrite is used.
 	if ra.copyOnWrite {
@@ -299,6 +310,54 @@ func (ra *roaringArray) cloneCopyOnWriteContainers() {
 	}
 }
 
+// invalidateRanks discards the cumulative cardinalities of the containers.
+// It must be called by every modification of the containers.
+func (ra *roaringArray) invalidateRanks() {
+	ra.cumulativeCards = nil
+}
+
+// ranks returns the cumulative cardinalities of the containers, building them
+// if needed, or nil if fast rank is disabled.
+func (ra *roaringArray) ranks() []uint64 {
+	if !ra.fastRank || len(ra.containers) == 0 {
+		return nil
+	}
+	if ra.cumulativeCards == nil {
+		cards := make([]uint64, len(ra.containers))
+		total := uint64(0)
+		for i, c := range ra.containers {
+			total += uint64(c.getCardinality())
+			cards[i] = total
+		}
+		ra.cumulativeCards = cards
+	}
+	return ra.cumulativeCards
+}
+
+// seekRank returns the index of the container holding the value of rank x
+// (ranks start at 0) and the number of values in the containers before it.
+// The index is the number of containers if the bitmap has no more than x
+// values.
+func (ra *roaringArray) seekRank(x uint64) (int, uint64) {
+	if cards := ra.ranks(); cards != nil {
+		i := sort.Search(len(cards), func(i int) bool { return cards[i] > x })
+		if i == 0 {
+			return 0, 0
+		}
+		return i, cards[i-1]
+	}
+
+	before := uint64(0)
+	for i, c := range ra.containers {
+		card := uint64(c.getCardinality())
+		if x < before+card {
+			return i, before
+		}
+		before += card
+	}
+	return len(ra.containers), before
+}
+
 // unused function:
 //func (ra *roaringArray) containsKey(x uint16) bool {
 //	return (ra.binarySearch(0, int64(len(ra.keys)), x) >= 0)
@@ -319,6 +378,9 @@ func (ra *roaringArray) getContainerAtIndex(i int) container {
 }
 
 func (ra *roaringArray) getFastContainerAtIndex(i int, needsWriteable bool) container {
+	if needsWriteable {
+		ra.invalidateRanks()
+	}
 	c := ra.getContainerAtIndex(i)
 	switch t := c.(type) {
 	case *arrayContainer:
@@ -339,6 +401,7 @@ func (ra *roaringArray) getFastContainerAtIndex(i int, needsWriteable bool) cont
 // depending on whether the container requires a copy on write.
 // If it does using the non-inplace or() method leads to fewer allocations.
 func (ra *roaringArray) getUnionedWritableContainer(pos int, other container) container {
+	ra.invalidateRanks()
 	if ra.needCopyOnWrite[pos] {
 		return ra.getContainerAtIndex(pos).or(other)
 	}
@@ -346,6 +409,7 @@ func (ra *roaringArray) getUnionedWritableContainer(pos int, other container) co
 }
 
 func (ra *roaringArray) getWritableContainerAtIndex(i int) container {
+	ra.invalidateRanks()
 	if ra.needCopyOnWrite[i] {
 		ra.containers[i] = ra.containers[i].clone()
 		ra.needCopyOnWrite[i] = false
@@ -365,11 +429,52 @@ func (ra *roaringArray) getIndex(x uint16) int {
 	return ra.binarySearch(0, int64(size), x)
 }
 
+// getIndexFrom is getIndex for a key known to be larger than the key at index
+// pos (or any key, if pos is -1). It gallops forward from pos, which is
+// cheaper than a binary search when successive keys are ascending.
+func (ra *roaringArray) getIndexFrom(x uint16, pos int) int {
+	i := ra.advanceUntil(x, pos)
+	if i < len(ra.keys) && ra.keys[i] == x {
+		return i
+	}
+	return -i - 1
+}
+
+// forEachKeyRun calls f for every run of consecutive values of dat sharing
+// their 16 high bits, with the index of the container of that key as getIndex
+// would return it. f may insert or remove the container of the key and returns
+// its new index in the same form, so that the next key can be looked up from
+// there.
+func (ra *roaringArray) forEachKeyRun(dat []uint32, f func(i int, hb uint16, run []uint32) int) {
+	below := -1 // index of the last container whose key precedes the current one
+	for start := 0; start < len(dat); {
+		hb := highbits(dat[start])
+		end := start + 1
+		for end < len(dat) && highbits(dat[end]) == hb {
+			end++
+		}
+
+		var i int
+		if start > 0 && hb > highbits(dat[start-1]) {
+			i = ra.getIndexFrom(hb, below)
+		} else {
+			i = ra.getIndex(hb)
+		}
+		if i = f(i, hb, dat[start:end]); i >= 0 {
+			below = i
+		} else {
+			below = -i - 2
+		}
+		start = end
+	}
+}
+
 func (ra *roaringArray) getKeyAtIndex(i int) uint16 {
 	return ra.keys[i]
 }
 
 func (ra *roaringArray) insertNewKeyValueAt(i int, key uint16, value container) {
+	ra.invalidateRanks()
 	ra.keys = append(ra.keys, 0)
 	ra.containers = append(ra.containers, nil)
 
@@ -420,6 +525,7 @@ func (ra *roaringArray) copyOrSourceContainerAt(other *roaringArray, index int,
 // their keys in sorted order; that invariant is enforced at the load boundary
 // (Validate), not re-checked here.
 func (ra *roaringArray) mergeBulk(other *roaringArray, dst, left, right int, xor bool) {
+	ra.invalidateRanks()
 	length1 := ra.size()
 	length2 := other.size()
 	receiverLastKey := ra.keys[length1-1]
@@ -519,10 +625,12 @@ func (ra *roaringArray) removeAtIndex(i int) {
 }
 
 func (ra *roaringArray) setContainerAtIndex(i int, c container) {
+	ra.invalidateRanks()
 	ra.containers[i] = c
 }
 
 func (ra *roaringArray) replaceKeyAndContainerAtIndex(i int, key uint16, c container, mustCopyOnWrite bool) {
+	ra.invalidateRanks()
 	ra.keys[i] = key
 	ra.containers[i] = c
 	ra.needCopyOnWrite[i] = mustCopyOnWrite
@@ -691,24 +799,72 @@ func (ra *roaringArray) toBytes() ([]byte, error) {
 
 // Reads a serialized roaringArray from a byte slice.
 func (ra *roaringArray) readFrom(stream internal.ByteInput, cookieHeader ...byte) (int64, error) {
-	var cookie uint32
-	var err error
+	ra.invalidateRanks()
 	if len(cookieHeader) > 0 && len(cookieHeader) != 4 {
 		return int64(len(cookieHeader)), fmt.Errorf("error in roaringArray.readFrom: could not read initial cookie: incorrect size of cookie header")
 	}
+	// If NextReturnsSafeSlice is false, then willNeedCopyOnWrite should be true
+	willNeedCopyOnWrite := !stream.NextReturnsSafeSlice()
+
+	keycard, isRunBitmap, err := readSerializedHeader(stream, cookieHeader...)
+	if err != nil {
+		return stream.GetReadBytes(), err
+	}
+	size := uint32(len(keycard) / 2)
+
+	// Allocate slices upfront as number of containers is known
+	if cap(ra.containers) >= int(size) {
+		ra.containers = ra.containers[:size]
+	} else {
+		ra.containers = make([]container, size)
+	}
+
+	if cap(ra.keys) >= int(size) {
+		ra.keys = ra.keys[:size]
+	} else {
+		ra.keys = make([]uint16, size)
+	}
+
+	if cap(ra.needCopyOnWrite) >= int(size) {
+		ra.needCopyOnWrite = ra.needCopyOnWrite[:size]
+	} else {
+		ra.needCopyOnWrite = make([]bool, size)
+	}
+
+	for i := uint32(0); i < size; i++ {
+		key := keycard[2*i]
+		card := int(keycard[2*i+1]) + 1
+		ra.keys[i] = key
+		ra.needCopyOnWrite[i] = willNeedCopyOnWrite
+
+		isRun := isRunBitmap != nil && isRunBitmap[i/8]&(1<<(i%8)) != 0
+		c, err := readSerializedContainer(stream, card, isRun)
+		if err != nil {
+			return stream.GetReadBytes(), err
+		}
+		ra.containers[i] = c
+	}
+
+	return stream.GetReadBytes(), nil
+}
+
+// readSerializedHeader reads the cookie (unless it is passed as cookieHeader),
+// the is-run bitmap and the descriptive header of a serialized roaringArray,
+// leaving the stream positioned at the first container.
+// It returns the interleaved key and cardinality-minus-one pairs, and the
+// is-run bitmap or nil if the bitmap has no run container.
+func readSerializedHeader(stream internal.ByteInput, cookieHeader ...byte) (keycard []uint16, isRunBitmap []byte, err error) {
+	var cookie uint32
 	if len(cookieHeader) == 4 {
 		cookie = binary.LittleEndian.Uint32(cookieHeader)
 	} else {
 		cookie, err = stream.ReadUInt32()
 		if err != nil {
-			return stream.GetReadBytes(), fmt.Errorf("error in roaringArray.readFrom: could not read initial cookie: %s", err)
+			return nil, nil, fmt.Errorf("error in roaringArray.readFrom: could not read initial cookie: %s", err)
 		}
 	}
-	// If NextReturnsSafeSlice is false, then willNeedCopyOnWrite should be true
-	willNeedCopyOnWrite := !stream.NextReturnsSafeSlice()
 
 	var size uint32
-	var isRunBitmap []byte
 
 	if cookie&0x0000FFFF == serialCookie {
 		size = cookie>>16 + 1
@@ -716,106 +872,98 @@ func (ra *roaringArray) readFrom(stream internal.ByteInput, cookieHeader ...byte
 		isRunBitmapSize := (int(size) + 7) / 8
 		isRunBitmap, err = stream.Next(isRunBitmapSize)
 		if err != nil {
-			return stream.GetReadBytes(), fmt.Errorf("malformed bitmap, failed to read is-run bitmap, got: %s", err)
+			return nil, nil, fmt.Errorf("malformed bitmap, failed to read is-run bitmap, got: %s", err)
 		}
 	} else if cookie == serialCookieNoRunContainer {
 		size, err = stream.ReadUInt32()
 		if err != nil {
-			return stream.GetReadBytes(), fmt.Errorf("malformed bitmap, failed to read a bitmap size: %s", err)
+			return nil, nil, fmt.Errorf("malformed bitmap, failed to read a bitmap size: %s", err)
 		}
 	} else {
-		return stream.GetReadBytes(), fmt.Errorf("error in roaringArray.readFrom: did not find expected serialCookie in header")
+		return nil, nil, fmt.Errorf("error in roaringArray.readFrom: did not find expected serialCookie in header")
 	}
 
 	if size > (1 << 16) {
-		return stream.GetReadBytes(), fmt.Errorf("it is logically impossible to have more than (1<<16) containers")
+		return nil, nil, fmt.Errorf("it is logically impossible to have more than (1<<16) containers")
 	}
 
 	// descriptive header
 	buf, err := stream.Next(2 * 2 * int(size))
 	if err != nil {
-		return stream.GetReadBytes(), fmt.Errorf("failed to read descriptive header: %s", err)
+		return nil, nil, fmt.Errorf("failed to read descriptive header: %s", err)
 	}
 
-	keycard := byteSliceAsUint16Slice(buf)
+	keycard = byteSliceAsUint16Slice(buf)
 
 	if isRunBitmap == nil || size >= noOffsetThreshold {
 		if err := stream.SkipBytes(int(size) * 4); err != nil {
-			return stream.GetReadBytes(), fmt.Errorf("failed to skip bytes: %s", err)
+			return nil, nil, fmt.Errorf("failed to skip bytes: %s", err)
 		}
 	}
+	return keycard, isRunBitmap, nil
+}
 
-	// Allocate slices upfront as number of containers is known
-	if cap(ra.containers) >= int(size) {
-		ra.containers = ra.containers[:size]
-	} else {
-		ra.containers = make([]container, size)
-	}
-
-	if cap(ra.keys) >= int(size) {
-		ra.keys = ra.keys[:size]
-	} else {
-		ra.keys = make([]uint16, size)
-	}
-
-	if cap(ra.needCopyOnWrite) >= int(size) {
-		ra.needCopyOnWrite = ra.needCopyOnWrite[:size]
-	} else {
-		ra.needCopyOnWrite = make([]bool, size)
-	}
-
-	for i := uint32(0); i < size; i++ {
-		key := keycard[2*i]
-		card := int(keycard[2*i+1]) + 1
-		ra.keys[i] = key
-		ra.needCopyOnWrite[i] = willNeedCopyOnWrite
-
-		if isRunBitmap != nil && isRunBitmap[i/8]&(1<<(i%8)) != 0 {
-			// run container
-			nr, err := stream.ReadUInt16()
-			if err != nil {
-				return 0, fmt.Errorf("failed to read runtime container size: %s", err)
-			}
-
-			buf, err := stream.Next(int(nr) * 4)
-			if err != nil {
-				return stream.GetReadBytes(), fmt.Errorf("failed to read runtime container content: %s", err)
-			}
-
-			nb := runContainer16{
-				iv: byteSliceAsInterval16Slice(buf),
-			}
+// readSerializedContainer decodes the next container of a serialized
+// roaringArray, given its cardinality and whether it is a run container.
+// The container points into the bytes returned by the stream.
+func readSerializedContainer(stream internal.ByteInput, card int, isRun bool) (container, error) {
+	if isRun {
+		// run container
+		nr, err := stream.ReadUInt16()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read runtime container size: %s", err)
+		}
 
-			ra.containers[i] = &nb
-		} else if card > arrayDefaultMaxSize {
-			// bitmap container
-			buf, err := stream.Next(arrayDefaultMaxSize * 2)
-			if err != nil {
-				return stream.GetReadBytes(), fmt.Errorf("failed to read bitmap container: %s", err)
-			}
+		buf, err := stream.Next(int(nr) * 4)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read runtime container content: %s", err)
+		}
 
-			nb := bitmapContainer{
-				cardinality: card,
-				bitmap:      byteSliceAsUint64Slice(buf),
-			}
+		return &runContainer16{
+			iv: byteSliceAsInterval16Slice(buf),
+		}, nil
+	} else if card > arrayDefaultMaxSize {
+		// bitmap container
+		buf, err := stream.Next(arrayDefaultMaxSize * 2)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bitmap container: %s", err)
+		}
 
-			ra.containers[i] = &nb
-		} else {
-			// array container
-			buf, err := stream.Next(card * 2)
-			if err != nil {
-				return stream.GetReadBytes(), fmt.Errorf("failed to read array container: %s", err)
-			}
+		return &bitmapContainer{
+			cardinality: card,
+			bitmap:      byteSliceAsUint64Slice(buf),
+		}, nil
+	}
+	// array container
+	buf, err := stream.Next(card * 2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read array container: %s", err)
+	}
 
-			nb := arrayContainer{
-				byteSliceAsUint16Slice(buf),
-			}
+	return &arrayContainer{
+		byteSliceAsUint16Slice(buf),
+	}, nil
+}
 
-			ra.containers[i] = &nb
+// skipSerializedContainer moves the stream past the next container of a
+// serialized roaringArray without decoding it.
+func skipSerializedContainer(stream internal.ByteInput, card int, isRun bool) error {
+	var err error
+	if isRun {
+		var nr uint16
+		nr, err = stream.ReadUInt16()
+		if err == nil {
+			err = stream.SkipBytes(int(nr) * 4)
 		}
+	} else if card > arrayDefaultMaxSize {
+		err = stream.SkipBytes(arrayDefaultMaxSize * 2)
+	} else {
+		err = stream.SkipBytes(card * 2)
 	}
-
-	return stream.GetReadBytes(), nil
+	if err != nil {
+		return fmt.Errorf("failed to skip container: %s", err)
+	}
+	return nil
 }
 
 func (ra *roaringArray) hasRunCompression() bool {
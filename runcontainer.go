@@ -2418,9 +2418,81 @@ func (rc *runContainer16) lazyOR(a container) container {
 }
 
 func (rc *runContainer16) intersects(a container) bool {
-	// TODO: optimize by doing inplace/less allocation
-	isect := rc.and(a)
-	return !isect.isEmpty()
+	switch x := a.(type) {
+	case *arrayContainer:
+		i := 0
+		for _, v := range x.content {
+			for i < len(rc.iv) && rc.iv[i].last() < v {
+				i++
+			}
+			if i == len(rc.iv) {
+				return false
+			}
+			if rc.iv[i].start <= v {
+				return true
+			}
+		}
+		return false
+	case *bitmapContainer:
+		for _, iv := range rc.iv {
+			v := x.NextSetBit(uint(iv.start))
+			if v < 0 {
+				return false
+			}
+			if v <= int(iv.last()) {
+				return true
+			}
+		}
+		return false
+	case *runContainer16:
+		i, j := 0, 0
+		for i < len(rc.iv) && j < len(x.iv) {
+			if rc.iv[i].last() < x.iv[j].start {
+				i++
+			} else if x.iv[j].last() < rc.iv[i].start {
+				j++
+			} else {
+				return true
+			}
+		}
+		return false
+	}
+	panic("unsupported container type")
+}
+
+func (rc *runContainer16) isSubset(a container) bool {
+	switch x := a.(type) {
+	case *arrayContainer:
+		// the values of a run are consecutive in the array
+		for _, iv := range rc.iv {
+			i := binarySearch(x.content, iv.start)
+			j := i + int(iv.length)
+			if i < 0 || j >= len(x.content) || x.content[j] != iv.last() {
+				return false
+			}
+		}
+		return true
+	case *bitmapContainer:
+		for _, iv := range rc.iv {
+			if x.getCardinalityInRange(uint(iv.start), uint(iv.last())+1) != int(iv.length)+1 {
+				return false
+			}
+		}
+		return true
+	case *runContainer16:
+		// runs are maximal, so each run must fit in a single run of x
+		j := 0
+		for _, iv := range rc.iv {
+			for j < len(x.iv) && x.iv[j].last() < iv.start {
+				j++
+			}
+			if j == len(x.iv) || x.iv[j].start > iv.start || x.iv[j].last() < iv.last() {
+				return false
+			}
+		}
+		return true
+	}
+	panic("unsupported container type")
 }
 
 func (rc *runContainer16) xor(a container) container {
@@ -2879,6 +2951,7 @@ func (rc *runContainer16) nextValue(target uint16) int {
 // Ex: if our runs resemble [[a,b],[c,d]] and a <= target <= b  then b+1 will not be equal to c, b+1 will be returned
 // Ex: if target < a then target is returned
 // Ex: if target > d then target is returned
+// Ex: if d is 1<<16-1 and c <= target <= d then 1<<16 is returned
 func (rc *runContainer16) nextAbsentValue(target uint16) int {
 	whichIndex, alreadyPresent, _ := rc.search(int(target))
 
@@ -2921,6 +2994,7 @@ func (rc *runContainer16) previousValue(target uint16) int {
 // If our run structure resmembles [[x,z], [a,c], [d,f]] with a <= target  <= c then a-1 will be returned.
 // if the target < x then target is returned
 // if target > f then target is returned
+// if x is 0 and x <= target <= z then -1 is returned
 func (rc *runContainer16) previousAbsentValue(target uint16) int {
 	whichIndex, alreadyPresent, _ := rc.search(int(target))
 
@@ -0,0 +1,142 @@
+package roaring
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/RoaringBitmap/roaring/v2/internal"
+)
+
+// Sample returns a bitmap holding k values of the bitmap drawn uniformly at
+// random without replacement, using rng as the source of randomness. A copy of
+// the whole bitmap is returned if k is at least its cardinality.
+func (rb *Bitmap) Sample(k uint64, rng *rand.Rand) *Bitmap {
+	n := rb.GetCardinality()
+	if k >= n {
+		return rb.Clone()
+	}
+	b := NewBuilder(false)
+	rb.forEachRank(iterateRanks(internal.SampleRanks[uint32](NewBitmap(), n, k, rng)), b.Add)
+	return b.Build()
+}
+
+// SampleInto fills buf with values of the bitmap drawn uniformly at random
+// without replacement, in ascending order, using rng as the source of
+// randomness. It returns the number of values written, which is the smaller
+// of len(buf) and the cardinality of the bitmap.
+func (rb *Bitmap) SampleInto(buf []uint32, rng *rand.Rand) int {
+	n := rb.GetCardinality()
+	k := uint64(len(buf))
+	if k >= n {
+		return rb.ManyIterator().NextMany(buf[:n])
+	}
+	i := 0
+	rb.forEachRank(iterateRanks(internal.SampleRanks[uint32](NewBitmap(), n, k, rng)), func(x uint32) {
+		buf[i] = x
+		i++
+	})
+	return i
+}
+
+// SampleWithReplacement fills buf with values of the bitmap drawn uniformly
+// and independently at random, so that a value may appear more than once,
+// using rng as the source of randomness. The values are written in ascending
+// order. It returns len(buf), or 0 if the bitmap is empty.
+func (rb *Bitmap) SampleWithReplacement(buf []uint32, rng *rand.Rand) int {
+	n := rb.GetCardinality()
+	if n == 0 {
+		return 0
+	}
+	ranks := make([]uint64, len(buf))
+	internal.RandomRanks(ranks, n, rng)
+	i, j := 0, 0
+	rb.forEachRank(func() (uint64, bool) {
+		if j == len(ranks) {
+			return 0, false
+		}
+		j++
+		return ranks[j-1], true
+	}, func(x uint32) {
+		buf[i] = x
+		i++
+	})
+	return i
+}
+
+// Bernoulli returns a bitmap holding each value of the bitmap independently
+// with probability p, using rng as the source of randomness. Rather than
+// drawing a number per value, it draws the geometrically distributed gaps
+// between the values kept.
+func (rb *Bitmap) Bernoulli(p float64, rng *rand.Rand) *Bitmap {
+	if p >= 1 {
+		return rb.Clone()
+	}
+	if !(p > 0) {
+		return NewBitmap()
+	}
+	n := rb.GetCardinality()
+	logq := math.Log1p(-p)
+	pos := uint64(0)
+	b := NewBuilder(false)
+	rb.forEachRank(func() (uint64, bool) {
+		gap := math.Floor(math.Log(1-rng.Float64()) / logq)
+		if gap >= float64(n-pos) {
+			return 0, false
+		}
+		r := pos + uint64(gap)
+		pos = r + 1
+		return r, true
+	}, b.Add)
+	return b.Build()
+}
+
+// iterateRanks returns the ranks held in a bitmap, in the form expected by
+// forEachRank.
+func iterateRanks(ranks *Bitmap) func() (uint64, bool) {
+	it := ranks.Iterator()
+	return func() (uint64, bool) {
+		if !it.HasNext() {
+			return 0, false
+		}
+		return uint64(it.Next()), true
+	}
+}
+
+// forEachRank calls f with the values of the bitmap at the ranks returned by
+// next, which must be ascending (repetitions are allowed) and reports false
+// once they are exhausted. Containers receiving few ranks are searched with
+// selectInt; the values of the others are listed once.
+func (rb *Bitmap) forEachRank(next func() (uint64, bool), f func(x uint32)) {
+	var local []uint16
+	var values []uint32
+	ra := &rb.highlowcontainer
+	r, ok := next()
+	base := uint64(0)
+	for i := 0; ok && i < ra.size(); i++ {
+		c := ra.getContainerAtIndex(i)
+		card := uint64(c.getCardinality())
+		local = local[:0]
+		for ; ok && r < base+card; r, ok = next() {
+			local = append(local, uint16(r-base))
+		}
+		base += card
+		if len(local) == 0 {
+			continue
+		}
+
+		hs := uint32(ra.getKeyAtIndex(i)) << 16
+		if uint64(len(local)) < card/64 {
+			for _, l := range local {
+				f(hs | uint32(c.selectInt(l)))
+			}
+			continue
+		}
+		if values == nil {
+			values = make([]uint32, maxCapacity)
+		}
+		c.getManyIterator().nextMany(hs, values[:card])
+		for _, l := range local {
+			f(values[l])
+		}
+	}
+}
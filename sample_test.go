@@ -0,0 +1,85 @@
+package roaring
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSample(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	rb := NewBitmap()
+	for i := uint32(0); i < 3000; i += 3 {
+		rb.Add(i) // an array container
+	}
+	for i := uint32(0); i < 40000; i += 2 {
+		rb.Add(1<<16 + i) // a bitmap container
+	}
+	rb.AddRange(3<<16, 4<<16+10) // run containers
+	rb.RunOptimize()
+	n := rb.GetCardinality()
+
+	t.Run("without replacement", func(t *testing.T) {
+		for _, k := range []uint64{0, 1, 10, 1000, n / 2, n/2 + 1, n - 1, n, n + 1} {
+			sample := rb.Sample(k, rng)
+			require.NoError(t, sample.Validate())
+			want := min(k, n)
+			assert.Equal(t, want, sample.GetCardinality(), "k=%d", k)
+			assert.Equal(t, want, sample.AndCardinality(rb), "k=%d", k)
+
+			buf := make([]uint32, k)
+			m := rb.SampleInto(buf, rng)
+			assert.Equal(t, int(want), m, "k=%d", k)
+			assert.True(t, slices.IsSorted(buf[:m]), "k=%d", k)
+			assert.Equal(t, want, BitmapOf(buf[:m]...).AndCardinality(rb), "k=%d", k)
+		}
+	})
+
+	t.Run("with replacement", func(t *testing.T) {
+		buf := make([]uint32, 5000)
+		assert.Equal(t, len(buf), rb.SampleWithReplacement(buf, rng))
+		assert.True(t, slices.IsSorted(buf))
+		for _, x := range buf {
+			assert.True(t, rb.Contains(x), "%d", x)
+		}
+		assert.Equal(t, 0, NewBitmap().SampleWithReplacement(buf, rng))
+	})
+
+	t.Run("bernoulli", func(t *testing.T) {
+		assert.True(t, rb.Bernoulli(0, rng).IsEmpty())
+		assert.True(t, rb.Bernoulli(1, rng).Equals(rb))
+		sample := rb.Bernoulli(0.25, rng)
+		require.NoError(t, sample.Validate())
+		assert.Equal(t, sample.GetCardinality(), sample.AndCardinality(rb))
+		assert.InDelta(t, float64(n)/4, float64(sample.GetCardinality()), float64(n)/50)
+	})
+
+	// every value is drawn with the same frequency
+	t.Run("uniform", func(t *testing.T) {
+		small := BitmapOf(1, 5, 70000, 70001, 200000)
+		const rounds = 20000
+		counts := map[uint32]int{}
+		countsReplaced := map[uint32]int{}
+		countsBernoulli := map[uint32]int{}
+		buf := make([]uint32, 2)
+		for i := 0; i < rounds; i++ {
+			for _, x := range small.Sample(2, rng).ToArray() {
+				counts[x]++
+			}
+			for _, x := range buf[:small.SampleWithReplacement(buf, rng)] {
+				countsReplaced[x]++
+			}
+			for _, x := range small.Bernoulli(0.4, rng).ToArray() {
+				countsBernoulli[x]++
+			}
+		}
+		for _, x := range small.ToArray() {
+			assert.InDelta(t, rounds*2/5, counts[x], rounds/50, "%d", x)
+			assert.InDelta(t, rounds*2/5, countsReplaced[x], rounds/50, "%d", x)
+			assert.InDelta(t, rounds*2/5, countsBernoulli[x], rounds/50, "%d", x)
+		}
+	})
+}
@@ -7,6 +7,7 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
@@ -224,3 +225,81 @@ func TestBitMapValidationFromFrozen(t *testing.T) {
 		})
 	}
 }
+
+func TestMappedFrozenBitmap(t *testing.T) {
+	rb := BitmapOf(1, 2, 3, 1000, 1<<20)
+	rb.AddRange(1<<24, 1<<24+100000)
+	rb.RunOptimize()
+	buf, err := rb.Freeze()
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "bitmap.frozen")
+	assert.NoError(t, os.WriteFile(path, buf, 0o600))
+
+	mb, err := OpenMappedFrozenBitmap(path)
+	assert.NoError(t, err)
+	assert.NoError(t, mb.View(func(mapped *Bitmap) error {
+		assert.True(t, rb.Equals(mapped))
+		mapped.Add(7)
+		assert.True(t, mapped.Contains(7))
+		return nil
+	}))
+	assert.NoError(t, mb.Close())
+	assert.ErrorIs(t, mb.View(func(*Bitmap) error { return nil }), ErrMappingClosed)
+}
+
+func TestMultiBitmapFrozen(t *testing.T) {
+	portable := BitmapOf(1, 2, 3)
+	frozen := BitmapOf(4, 5, 6, 1<<20)
+	frozen.AddRange(1<<24, 1<<24+100000)
+	frozen.RunOptimize()
+
+	var buf bytes.Buffer
+	mw := NewMultiBitmapWriter(&buf)
+	assert.NoError(t, mw.Add("portable", portable))
+	assert.NoError(t, mw.AddFrozen("frozen", frozen))
+	assert.NoError(t, mw.AddFrozen("frozen-again", frozen))
+	assert.NoError(t, mw.Close())
+
+	mr, err := NewMultiBitmapReader(buf.Bytes())
+	assert.NoError(t, err)
+	for key, want := range map[string]*Bitmap{"portable": portable, "frozen": frozen, "frozen-again": frozen} {
+		rb, err := mr.Bitmap(key)
+		assert.NoError(t, err)
+		assert.True(t, want.Equals(rb), key)
+	}
+	for _, e := range mr.entries {
+		if e.format == multiBitmapFrozen {
+			assert.Zero(t, e.offset%32)
+		}
+	}
+}
+
+func TestChecksummedFrozen(t *testing.T) {
+	rb := checksumTestBitmap()
+	buf, err := rb.FreezeChecksummed()
+	assert.NoError(t, err)
+
+	view := NewBitmap()
+	assert.NoError(t, view.ChecksummedFrozenView(buf))
+	assert.True(t, rb.Equals(view))
+
+	// the frozen payload starts with the bitmap container
+	corrupted := append([]byte(nil), buf...)
+	corrupted[checksumHeaderSize] ^= 0x01
+	err = view.ChecksummedFrozenView(corrupted)
+	var corruption *CorruptionError
+	if assert.ErrorAs(t, err, &corruption) {
+		assert.EqualValues(t, 7, corruption.Key)
+	}
+	assert.True(t, view.IsEmpty())
+
+	assert.ErrorIs(t, view.ChecksummedFrozenView(buf[:len(buf)-1]), ErrChecksumCorrupted)
+	assert.ErrorIs(t, view.ChecksummedFrozenView(append(buf, 0)), ErrChecksumCorrupted)
+
+	var portable bytes.Buffer
+	_, err = rb.WriteChecksummedTo(&portable)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, view.ChecksummedFrozenView(portable.Bytes()), ErrChecksumCorrupted)
+	assert.ErrorIs(t, view.ChecksummedFrozenView(make([]byte, 64)), ErrChecksumInvalidCookie)
+}
@@ -9,6 +9,12 @@ import (
 	"io"
 )
 
+// frozenViewOf reports an error: the frozen format is only supported on
+// little endian platforms.
+func frozenViewOf(rb *Bitmap, buf []byte) error {
+	return errors.New("frozen bitmaps are not supported on this platform")
+}
+
 func (b *arrayContainer) writeTo(stream io.Writer) (int, error) {
 	buf := make([]byte, 2*len(b.content))
 	for i, v := range b.content {
@@ -9,6 +9,8 @@ import (
 	"fmt"
 	"io"
 	"unsafe"
+
+	"github.com/RoaringBitmap/roaring/v2/internal"
 )
 
 func (ac *arrayContainer) writeTo(stream io.Writer) (int, error) {
@@ -201,6 +203,29 @@ func (rb *Bitmap) MustFrozenView(buf []byte) error {
 	return err
 }
 
+// AddFrozen writes rb under key in the frozen format (see WriteFrozenTo),
+// aligned by 32 bytes from the beginning of the file, so that readers can
+// load it with FrozenView. Keys may be added in any order but must be distinct.
+func (mw *MultiBitmapWriter) AddFrozen(key string, rb *Bitmap) error {
+	return mw.add(key, multiBitmapFrozen, func(w io.Writer) (int64, error) {
+		n, err := rb.WriteFrozenTo(w)
+		return int64(n), err
+	})
+}
+
+func frozenViewOf(rb *Bitmap, buf []byte) error {
+	return rb.FrozenView(buf)
+}
+
+// OpenMappedFrozenBitmap maps the file at path read-only and loads it with
+// FrozenView. The file is expected to hold a bitmap in the frozen format
+// (e.g., as written by WriteFrozenTo). See MappedBitmap.
+func OpenMappedFrozenBitmap(path string) (*MappedBitmap, error) {
+	return openMapped(path, func(rb *Bitmap, buf []byte) error {
+		return rb.FrozenView(buf)
+	})
+}
+
 /* Verbatim specification from CRoaring.
  *
  * FROZEN SERIALIZATION FORMAT DESCRIPTION
@@ -379,6 +404,7 @@ func (ra *roaringArray) frozenView(buf []byte) error {
 	ra.containers = containers
 	ra.needCopyOnWrite = needCOW
 	ra.copyOnWrite = true
+	ra.invalidateRanks()
 
 	return nil
 }
@@ -562,3 +588,60 @@ func (rb *Bitmap) WriteFrozenTo(wr io.Writer) (int, error) {
 
 	return written, nil
 }
+
+// FreezeChecksummed serializes the bitmap in the frozen format (see Freeze),
+// wrapped in an envelope holding the CRC32C checksum of every container
+// (see WriteChecksummedTo). Such a bitmap is loaded with ChecksummedFrozenView.
+func (rb *Bitmap) FreezeChecksummed() ([]byte, error) {
+	sz := rb.GetFrozenSizeInBytes()
+	buf := make([]byte, checksumHeaderSize+sz, checksumHeaderSize+sz+uint64(checksumEntrySize*rb.highlowcontainer.size()))
+	payload := buf[checksumHeaderSize:]
+	if _, err := rb.FreezeTo(payload); err != nil {
+		return nil, err
+	}
+	// checksum the containers exactly as they will be read back
+	view := NewBitmap()
+	if err := view.FrozenView(payload); err != nil {
+		return nil, err
+	}
+	buf = appendChecksumTable(buf, view.ContainerChecksums(nil))
+	checksumEnvelope.PutHeader(buf, checksummedFrozen, sz, buf[checksumHeaderSize+sz:])
+	return buf, nil
+}
+
+// ChecksummedFrozenView loads a bitmap written by FreezeChecksummed with
+// FrozenView, so the same rules apply to buf, and checks every container
+// against its checksum. If a container does not match, it returns a
+// *CorruptionError naming its key; every corruption error wraps
+// ErrChecksumCorrupted. The bitmap is empty after an error.
+//
+// Checking the containers reads all of buf: when only a few containers are
+// needed, e.g., from a memory-mapped file, FrozenView may be preferable.
+func (rb *Bitmap) ChecksummedFrozenView(buf []byte) (err error) {
+	defer func() {
+		if err != nil {
+			rb.Clear()
+		}
+	}()
+
+	if len(buf) < checksumHeaderSize {
+		return ErrFrozenBitmapIncomplete
+	}
+	payloadLen, tableLen, err := checksumEnvelope.ParseHeader(buf, checksummedFrozen)
+	if err != nil {
+		return err
+	}
+	rest := uint64(len(buf) - checksumHeaderSize)
+	if payloadLen > rest || tableLen != rest-payloadLen {
+		return fmt.Errorf("%w: unexpected payload length", ErrChecksumCorrupted)
+	}
+	payload := buf[checksumHeaderSize : checksumHeaderSize+payloadLen]
+	table := buf[checksumHeaderSize+payloadLen:]
+	if err := internal.CheckChecksumTable(buf, table); err != nil {
+		return err
+	}
+	if err := rb.FrozenView(payload); err != nil {
+		return fmt.Errorf("%w: %w", ErrChecksumCorrupted, err)
+	}
+	return rb.verifyContainerChecksums(table)
+}
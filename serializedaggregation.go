@@ -0,0 +1,381 @@
+package roaring
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/RoaringBitmap/roaring/v2/internal"
+)
+
+// serializedBitmap walks a bitmap in the portable format (see WriteTo)
+// without deserializing it: only the descriptive header is read upfront,
+// and containers are decoded, or skipped, on demand and in increasing
+// key order.
+type serializedBitmap struct {
+	stream          internal.ByteInput
+	keycard         []uint16
+	isRunBitmap     []byte
+	next            int  // index of the container the stream is positioned at
+	needCopyOnWrite bool // whether decoded containers point into data we don't own
+}
+
+func newSerializedBitmap(stream internal.ByteInput) (*serializedBitmap, error) {
+	keycard, isRunBitmap, err := readSerializedHeader(stream)
+	if err != nil {
+		return nil, err
+	}
+	sb := &serializedBitmap{
+		stream:          stream,
+		keycard:         keycard,
+		isRunBitmap:     isRunBitmap,
+		needCopyOnWrite: !stream.NextReturnsSafeSlice(),
+	}
+	// the aggregations merge the sources by key
+	for i := 1; i < sb.size(); i++ {
+		if sb.getKeyAtIndex(i-1) >= sb.getKeyAtIndex(i) {
+			return nil, ErrKeySortOrder
+		}
+	}
+	return sb, nil
+}
+
+func (sb *serializedBitmap) size() int {
+	return len(sb.keycard) / 2
+}
+
+func (sb *serializedBitmap) getKeyAtIndex(i int) uint16 {
+	return sb.keycard[2*i]
+}
+
+func (sb *serializedBitmap) cardinalityAtIndex(i int) int {
+	return int(sb.keycard[2*i+1]) + 1
+}
+
+func (sb *serializedBitmap) isRunAtIndex(i int) bool {
+	return sb.isRunBitmap != nil && sb.isRunBitmap[i/8]&(1<<(i%8)) != 0
+}
+
+// skipUntil moves the stream to the container at index i, which must not
+// precede the current position.
+func (sb *serializedBitmap) skipUntil(i int) error {
+	for ; sb.next < i; sb.next++ {
+		if err := skipSerializedContainer(sb.stream, sb.cardinalityAtIndex(sb.next), sb.isRunAtIndex(sb.next)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getContainerAtIndex decodes the container at index i. Containers must be
+// requested in increasing index order; the ones in between are skipped.
+// Decoded containers are validated, since they are combined right away and
+// the container operations assume well-formed input.
+func (sb *serializedBitmap) getContainerAtIndex(i int) (container, error) {
+	if err := sb.skipUntil(i); err != nil {
+		return nil, err
+	}
+	c, err := readSerializedContainer(sb.stream, sb.cardinalityAtIndex(i), sb.isRunAtIndex(i))
+	if err != nil {
+		return nil, err
+	}
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("invalid container #%d (key %d): %w", i, sb.getKeyAtIndex(i), err)
+	}
+	sb.next = i + 1
+	return c, nil
+}
+
+func serializedBitmapsFromBuffers(bufs [][]byte) ([]*serializedBitmap, error) {
+	sources := make([]*serializedBitmap, len(bufs))
+	for i, buf := range bufs {
+		sb, err := newSerializedBitmap(internal.NewByteBuffer(buf))
+		if err != nil {
+			return nil, fmt.Errorf("serialized bitmap #%d: %w", i, err)
+		}
+		sources[i] = sb
+	}
+	return sources, nil
+}
+
+func serializedBitmapsFromReaders(readers []io.Reader) ([]*serializedBitmap, error) {
+	sources := make([]*serializedBitmap, len(readers))
+	for i, r := range readers {
+		stream, ok := r.(internal.ByteInput)
+		if !ok {
+			stream = internal.NewByteInputFromReader(r)
+		}
+		sb, err := newSerializedBitmap(stream)
+		if err != nil {
+			return nil, fmt.Errorf("serialized bitmap #%d: %w", i, err)
+		}
+		sources[i] = sb
+	}
+	return sources, nil
+}
+
+// drainSerializedBitmaps skips the containers that were not decoded so that
+// every reader is left positioned right after its bitmap, as with ReadFrom.
+func drainSerializedBitmaps(sources []*serializedBitmap) error {
+	for _, sb := range sources {
+		if err := sb.skipUntil(sb.size()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OrSerialized computes the union of bitmaps serialized in the portable
+// format (e.g., as written by WriteTo) without deserializing them first.
+//
+// As with FromBuffer, the buffers must not be modified while the result is
+// in use: containers present in a single input are not copied.
+func OrSerialized(bufs ...[]byte) (*Bitmap, error) {
+	sources, err := serializedBitmapsFromBuffers(bufs)
+	if err != nil {
+		return nil, err
+	}
+	return orSerialized(sources)
+}
+
+// AndSerialized computes the intersection of bitmaps serialized in the
+// portable format (e.g., as written by WriteTo). Only the containers whose
+// keys are present in every input are decoded.
+func AndSerialized(bufs ...[]byte) (*Bitmap, error) {
+	sources, err := serializedBitmapsFromBuffers(bufs)
+	if err != nil {
+		return nil, err
+	}
+	return andSerialized(sources)
+}
+
+// AndNotSerialized computes the difference between the bitmap serialized in
+// buf and the union of the bitmaps serialized in others, all in the portable
+// format (e.g., as written by WriteTo). Only the containers of others whose
+// keys are present in buf are decoded.
+//
+// As with FromBuffer, buf must not be modified while the result is in use:
+// containers of buf that are left untouched are not copied.
+func AndNotSerialized(buf []byte, others ...[]byte) (*Bitmap, error) {
+	sources, err := serializedBitmapsFromBuffers(append([][]byte{buf}, others...))
+	if err != nil {
+		return nil, err
+	}
+	return andNotSerialized(sources[0], sources[1:])
+}
+
+// OrReaders computes the union of bitmaps read in the portable format
+// (e.g., as written by WriteTo) from readers, one bitmap per reader.
+// Every reader is consumed up to the end of its bitmap.
+func OrReaders(readers ...io.Reader) (*Bitmap, error) {
+	sources, err := serializedBitmapsFromReaders(readers)
+	if err != nil {
+		return nil, err
+	}
+	return orSerialized(sources)
+}
+
+// AndReaders computes the intersection of bitmaps read in the portable
+// format (e.g., as written by WriteTo) from readers, one bitmap per reader.
+// Only the containers whose keys are present in every input are decoded,
+// the others are skipped. Every reader is consumed up to the end of its bitmap.
+func AndReaders(readers ...io.Reader) (*Bitmap, error) {
+	sources, err := serializedBitmapsFromReaders(readers)
+	if err != nil {
+		return nil, err
+	}
+	answer, err := andSerialized(sources)
+	if err != nil {
+		return nil, err
+	}
+	return answer, drainSerializedBitmaps(sources)
+}
+
+// AndNotReaders computes the difference between the bitmap read from r and
+// the union of the bitmaps read from others, all in the portable format
+// (e.g., as written by WriteTo). Only the containers of others whose keys
+// are present in the first bitmap are decoded, the others are skipped.
+// Every reader is consumed up to the end of its bitmap.
+func AndNotReaders(r io.Reader, others ...io.Reader) (*Bitmap, error) {
+	sources, err := serializedBitmapsFromReaders(append([]io.Reader{r}, others...))
+	if err != nil {
+		return nil, err
+	}
+	answer, err := andNotSerialized(sources[0], sources[1:])
+	if err != nil {
+		return nil, err
+	}
+	return answer, drainSerializedBitmaps(sources)
+}
+
+func orSerialized(sources []*serializedBitmap) (*Bitmap, error) {
+	answer := NewBitmap()
+	pos := make([]int, len(sources))
+	for {
+		// find the smallest key not consumed yet
+		found := false
+		var key uint16
+		for i, sb := range sources {
+			if pos[i] < sb.size() && (!found || sb.getKeyAtIndex(pos[i]) < key) {
+				key = sb.getKeyAtIndex(pos[i])
+				found = true
+			}
+		}
+		if !found {
+			return answer, nil
+		}
+
+		var c container
+		needCopyOnWrite := false
+		for i, sb := range sources {
+			if pos[i] == sb.size() || sb.getKeyAtIndex(pos[i]) != key {
+				continue
+			}
+			c2, err := sb.getContainerAtIndex(pos[i])
+			if err != nil {
+				return nil, err
+			}
+			pos[i]++
+			switch {
+			case c == nil:
+				c = c2
+				needCopyOnWrite = sb.needCopyOnWrite
+			case needCopyOnWrite:
+				c = c.lazyOR(c2)
+				needCopyOnWrite = false
+			default:
+				// see Bitmap.lazyOR on why run containers are promoted
+				if rc, ok := c.(*runContainer16); ok && !rc.isFull() {
+					c = rc.toBitmapContainer()
+				}
+				c = c.lazyIOR(c2)
+			}
+		}
+		answer.highlowcontainer.appendContainer(key, c, needCopyOnWrite)
+		// lazy unions leave the cardinality of bitmap containers undefined
+		// until they are repaired; do it as we go
+		answer.repairLastAfterLazy()
+	}
+}
+
+// repairLastAfterLazy is repairAfterLazy restricted to the last container.
+func (x1 *Bitmap) repairLastAfterLazy() {
+	pos := x1.highlowcontainer.size() - 1
+	if bc, ok := x1.highlowcontainer.getContainerAtIndex(pos).(*bitmapContainer); ok && bc.cardinality == invalidCardinality {
+		bc.computeCardinality()
+		if bc.getCardinality() <= arrayDefaultMaxSize {
+			x1.highlowcontainer.setContainerAtIndex(pos, bc.toArrayContainer())
+		} else if bc.isFull() {
+			x1.highlowcontainer.setContainerAtIndex(pos, newRunContainer16Range(0, MaxUint16))
+		}
+	}
+}
+
+func andSerialized(sources []*serializedBitmap) (*Bitmap, error) {
+	answer := NewBitmap()
+	if len(sources) == 0 {
+		return answer, nil
+	}
+	pos := make([]int, len(sources))
+main:
+	for {
+		// align every source on the largest of the current keys
+		var key uint16
+		for i, sb := range sources {
+			if pos[i] == sb.size() {
+				break main
+			}
+			if k := sb.getKeyAtIndex(pos[i]); k > key {
+				key = k
+			}
+		}
+		aligned := true
+		for i, sb := range sources {
+			for pos[i] < sb.size() && sb.getKeyAtIndex(pos[i]) < key {
+				pos[i]++
+			}
+			if pos[i] == sb.size() {
+				break main
+			}
+			if sb.getKeyAtIndex(pos[i]) != key {
+				aligned = false
+			}
+		}
+		if !aligned {
+			continue
+		}
+
+		var c container
+		needCopyOnWrite := false
+		for i, sb := range sources {
+			c2, err := sb.getContainerAtIndex(pos[i])
+			if err != nil {
+				return nil, err
+			}
+			pos[i]++
+			switch {
+			case c == nil:
+				c = c2
+				needCopyOnWrite = sb.needCopyOnWrite
+			case needCopyOnWrite:
+				c = c.and(c2)
+				needCopyOnWrite = false
+			default:
+				c = c.iand(c2)
+			}
+			if c.isEmpty() {
+				break
+			}
+		}
+		if !c.isEmpty() {
+			answer.highlowcontainer.appendContainer(key, c, needCopyOnWrite)
+		}
+		// sources not decoded because c became empty are skipped lazily
+		for i, sb := range sources {
+			if pos[i] < sb.size() && sb.getKeyAtIndex(pos[i]) == key {
+				pos[i]++
+			}
+		}
+	}
+	return answer, nil
+}
+
+func andNotSerialized(x *serializedBitmap, others []*serializedBitmap) (*Bitmap, error) {
+	answer := NewBitmap()
+	pos := make([]int, len(others))
+	for i := 0; i < x.size(); i++ {
+		key := x.getKeyAtIndex(i)
+		c, err := x.getContainerAtIndex(i)
+		if err != nil {
+			return nil, err
+		}
+		needCopyOnWrite := x.needCopyOnWrite
+		for j, sb := range others {
+			for pos[j] < sb.size() && sb.getKeyAtIndex(pos[j]) < key {
+				pos[j]++
+			}
+			if pos[j] == sb.size() || sb.getKeyAtIndex(pos[j]) != key {
+				continue
+			}
+			if c.isEmpty() {
+				// nothing left to remove, skip the container
+				pos[j]++
+				continue
+			}
+			c2, err := sb.getContainerAtIndex(pos[j])
+			if err != nil {
+				return nil, err
+			}
+			pos[j]++
+			if needCopyOnWrite {
+				c = c.andNot(c2)
+				needCopyOnWrite = false
+			} else {
+				c = c.iandNot(c2)
+			}
+		}
+		if !c.isEmpty() {
+			answer.highlowcontainer.appendContainer(key, c, needCopyOnWrite)
+		}
+	}
+	return answer, nil
+}
@@ -0,0 +1,209 @@
+package roaring
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serializedAggregationInputs(t *testing.T) ([]*Bitmap, [][]byte) {
+	r := rand.New(rand.NewSource(1234))
+	bitmaps := []*Bitmap{
+		BitmapOf(1, 2, 3, 1<<16+5, 5<<16+1, 7<<16),
+		NewBitmap(),
+	}
+	for i := 0; i < 4; i++ {
+		rb := NewBitmap()
+		for j := 0; j < 20000; j++ {
+			rb.Add(uint32(r.Intn(12 << 16)))
+		}
+		rb.AddRange(uint64(i)<<16, uint64(i)<<16+uint64(r.Intn(1<<16)))
+		rb.AddRange(9<<16, 10<<16)
+		if i%2 == 0 {
+			rb.RunOptimize()
+		}
+		bitmaps = append(bitmaps, rb)
+	}
+	bufs := make([][]byte, len(bitmaps))
+	for i, rb := range bitmaps {
+		buf, err := rb.ToBytes()
+		require.NoError(t, err)
+		bufs[i] = buf
+	}
+	return bitmaps, bufs
+}
+
+func readersOf(bufs [][]byte) []io.Reader {
+	readers := make([]io.Reader, len(bufs))
+	for i, buf := range bufs {
+		// hide the ByteInput fast path to exercise plain streams
+		readers[i] = io.MultiReader(bytes.NewReader(buf))
+	}
+	return readers
+}
+
+func TestOrSerialized(t *testing.T) {
+	bitmaps, bufs := serializedAggregationInputs(t)
+	for n := 0; n <= len(bitmaps); n++ {
+		want := FastOr(bitmaps[:n]...)
+
+		got, err := OrSerialized(bufs[:n]...)
+		require.NoError(t, err)
+		assert.NoError(t, got.Validate())
+		assert.True(t, want.Equals(got))
+
+		got, err = OrReaders(readersOf(bufs[:n])...)
+		require.NoError(t, err)
+		assert.NoError(t, got.Validate())
+		assert.True(t, want.Equals(got))
+	}
+}
+
+func TestAndSerialized(t *testing.T) {
+	bitmaps, bufs := serializedAggregationInputs(t)
+	for start := 0; start < len(bitmaps); start++ {
+		want := FastAnd(bitmaps[start:]...)
+
+		got, err := AndSerialized(bufs[start:]...)
+		require.NoError(t, err)
+		assert.NoError(t, got.Validate())
+		assert.True(t, want.Equals(got))
+
+		got, err = AndReaders(readersOf(bufs[start:])...)
+		require.NoError(t, err)
+		assert.True(t, want.Equals(got))
+	}
+}
+
+func TestAndNotSerialized(t *testing.T) {
+	bitmaps, bufs := serializedAggregationInputs(t)
+	for i := range bitmaps {
+		want := bitmaps[i].Clone()
+		for j, rb := range bitmaps {
+			if j != i {
+				want.AndNot(rb)
+			}
+		}
+		others := append(append([][]byte{}, bufs[:i]...), bufs[i+1:]...)
+
+		got, err := AndNotSerialized(bufs[i], others...)
+		require.NoError(t, err)
+		assert.NoError(t, got.Validate())
+		assert.True(t, want.Equals(got))
+
+		readers := readersOf(bufs)
+		otherReaders := append(append([]io.Reader{}, readers[:i]...), readers[i+1:]...)
+		got, err = AndNotReaders(readers[i], otherReaders...)
+		require.NoError(t, err)
+		assert.True(t, want.Equals(got))
+	}
+}
+
+func TestSerializedAggregationLeavesBuffersIntact(t *testing.T) {
+	_, bufs := serializedAggregationInputs(t)
+	orig := make([][]byte, len(bufs))
+	for i, buf := range bufs {
+		orig[i] = append([]byte(nil), buf...)
+	}
+
+	or, err := OrSerialized(bufs...)
+	require.NoError(t, err)
+	and, err := AndSerialized(bufs[2:]...)
+	require.NoError(t, err)
+	andNot, err := AndNotSerialized(bufs[2], bufs[3])
+	require.NoError(t, err)
+	for _, rb := range []*Bitmap{or, and, andNot} {
+		rb.AddRange(0, 1<<20)
+		rb.RemoveRange(1<<19, 1<<21)
+	}
+	assert.Equal(t, orig, bufs)
+}
+
+func TestReadersPositionedAfterBitmap(t *testing.T) {
+	a, b := BitmapOf(1, 2, 3), BitmapOf(100000, 200000)
+	var ra, rb bytes.Buffer
+	_, err := a.WriteTo(&ra)
+	require.NoError(t, err)
+	ra.WriteString("tail")
+	_, err = b.WriteTo(&rb)
+	require.NoError(t, err)
+	rb.WriteString("tail")
+
+	got, err := AndReaders(io.MultiReader(&ra), io.MultiReader(&rb))
+	require.NoError(t, err)
+	assert.True(t, got.IsEmpty())
+	assert.Equal(t, "tail", ra.String())
+	assert.Equal(t, "tail", rb.String())
+}
+
+func TestSerializedAggregationErrors(t *testing.T) {
+	buf, err := BitmapOf(1, 2, 3).ToBytes()
+	require.NoError(t, err)
+
+	_, err = OrSerialized(buf, []byte{1, 2, 3})
+	assert.Error(t, err)
+	_, err = AndSerialized(buf, buf[:len(buf)-1])
+	assert.Error(t, err)
+	_, err = AndNotSerialized(buf[:len(buf)-1], buf)
+	assert.Error(t, err)
+}
+
+func TestSerializedAggregationCorrupted(t *testing.T) {
+	rb := BitmapOf(1, 2, 3, 1<<16+5)
+	rb.AddRange(2<<16, 2<<16+5000)
+	rb.AddRange(2<<16+6000, 2<<16+7000)
+	for i := uint32(0); i < 10000; i += 3 {
+		rb.Add(3<<16 + i)
+	}
+	rb.RunOptimize()
+	buf, err := rb.ToBytes()
+	require.NoError(t, err)
+	other, err := BitmapOf(2, 1<<16+5, 2<<16+10, 3<<16+9).ToBytes()
+	require.NoError(t, err)
+
+	aggregations := map[string]func(buf []byte) (*Bitmap, error){
+		"or":           func(buf []byte) (*Bitmap, error) { return OrSerialized(buf, other) },
+		"and":          func(buf []byte) (*Bitmap, error) { return AndSerialized(buf, other) },
+		"and not":      func(buf []byte) (*Bitmap, error) { return AndNotSerialized(buf, other) },
+		"and not from": func(buf []byte) (*Bitmap, error) { return AndNotSerialized(other, buf) },
+		"or readers":   func(buf []byte) (*Bitmap, error) { return OrReaders(readersOf([][]byte{buf, other})...) },
+	}
+
+	// truncated input is reported
+	for n := 0; n < len(buf); n++ {
+		for name, aggregate := range aggregations {
+			_, err := aggregate(buf[:n])
+			assert.Error(t, err, "%s %d", name, n)
+		}
+	}
+
+	// a run container whose runs overlap is reported
+	rc := newRunContainer16TakeOwnership([]interval16{newInterval16Range(0, 10), newInterval16Range(5, 20)})
+	bad := NewBitmap()
+	bad.highlowcontainer.appendContainer(2, rc, false)
+	badBuf, err := bad.ToBytes()
+	require.NoError(t, err)
+	for name, aggregate := range aggregations {
+		_, err := aggregate(badBuf)
+		assert.Error(t, err, name)
+	}
+
+	// flipped bits either make another valid bitmap or are reported, but
+	// never panic
+	for i := 0; i < len(buf)*8; i++ {
+		flipped := append([]byte(nil), buf...)
+		flipped[i/8] ^= 1 << (i % 8)
+		for name, aggregate := range aggregations {
+			assert.NotPanics(t, func() {
+				got, err := aggregate(flipped)
+				if err == nil {
+					assert.NoError(t, got.Validate(), "%s %d", name, i)
+				}
+			}, "%s %d", name, i)
+		}
+	}
+}